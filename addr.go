@@ -57,6 +57,10 @@ func (s *AlternateServer) GetFrom(m *Message) error {
 	return a.GetFromAs(m, AttrAlternateServer)
 }
 
+func (s AlternateServer) String() string {
+	return net.JoinHostPort(s.IP.String(), strconv.Itoa(s.Port))
+}
+
 func (a MappedAddress) String() string {
 	return net.JoinHostPort(a.IP.String(), strconv.Itoa(a.Port))
 }
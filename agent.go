@@ -4,8 +4,12 @@
 package stun
 
 import (
+	"container/heap"
 	"errors"
+	"fmt"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,25 +25,125 @@ func NewAgent(h Handler) *Agent {
 		h = NoopHandler()
 	}
 	a := &Agent{
-		transactions: make(map[transactionID]agentTransaction),
-		handler:      h,
+		handler: h,
+	}
+	for i := range a.shards {
+		a.shards[i].transactions = make(map[transactionID]*agentTransaction)
 	}
 	return a
 }
 
+// agentShards is the number of Agent shards, must be power of two.
+const agentShards = 16
+
 // Agent is low-level abstraction over transaction list that
 // handles concurrency (all calls are goroutine-safe) and
 // time outs (via Collect call).
+//
+// Transactions are distributed over shards by id to reduce lock
+// contention, each shard keeps deadlines in min-heap, so Collect
+// only visits timed out transactions.
 type Agent struct {
-	// transactions is map of transactions that are currently
-	// in progress. Event handling is done in such way when
-	// transaction is unregistered before agentTransaction access,
-	// minimizing mux lock and protecting agentTransaction from
-	// data races via unexpected concurrent access.
-	transactions map[transactionID]agentTransaction
-	closed       bool       // all calls are invalid if true
-	mux          sync.Mutex // protects transactions and closed
-	handler      Handler    // handles transactions
+	shards   [agentShards]agentShard
+	inFlight int32        // number of transactions in progress, atomic
+	limit    int32        // maximum of inFlight, zero is unlimited
+	closed   bool         // all calls are invalid if true
+	mux      sync.RWMutex // protects closed, limit and handler
+	handler  Handler      // handles transactions without own handler
+}
+
+// agentShard is part of transactions that are currently in progress.
+// Event handling is done in such way when transaction is unregistered
+// before agentTransaction access, minimizing mux lock and protecting
+// agentTransaction from data races via unexpected concurrent access.
+type agentShard struct {
+	mux          sync.Mutex // protects fields below
+	transactions map[transactionID]*agentTransaction
+	deadlines    agentDeadlines
+	free         []*agentTransaction // reused to prevent allocations
+}
+
+// shard returns shard of transaction with provided id.
+func (a *Agent) shard(id transactionID) *agentShard {
+	// FNV-1a, as id can be not random.
+	h := uint32(2166136261)
+	for _, b := range id {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return &a.shards[h&(agentShards-1)]
+}
+
+// add registers transaction with id, deadline and handler h.
+func (s *agentShard) add(id transactionID, deadline time.Time, h Handler) error {
+	if _, exists := s.transactions[id]; exists {
+		return ErrTransactionExists
+	}
+	var t *agentTransaction
+	if n := len(s.free); n > 0 {
+		t = s.free[n-1]
+		s.free[n-1] = nil
+		s.free = s.free[:n-1]
+	} else {
+		t = new(agentTransaction)
+	}
+	t.id = id
+	t.deadline = deadline
+	t.h = h
+	s.transactions[id] = t
+	heap.Push(&s.deadlines, t)
+	return nil
+}
+
+// remove un-registers transaction with id, returning its handler and
+// false if it does not exist.
+func (s *agentShard) remove(id transactionID) (Handler, bool) {
+	t, exists := s.transactions[id]
+	if !exists {
+		return nil, false
+	}
+	h := t.h
+	heap.Remove(&s.deadlines, t.index)
+	s.release(t)
+	return h, true
+}
+
+// release puts removed transaction t to free list.
+func (s *agentShard) release(t *agentTransaction) {
+	delete(s.transactions, t.id)
+	*t = agentTransaction{}
+	s.free = append(s.free, t)
+}
+
+// agentDeadlines is min-heap of transactions by deadline, implementing
+// heap.Interface.
+type agentDeadlines []*agentTransaction
+
+func (d agentDeadlines) Len() int { return len(d) }
+
+func (d agentDeadlines) Less(i, j int) bool {
+	return d[i].deadline.Before(d[j].deadline)
+}
+
+func (d agentDeadlines) Swap(i, j int) {
+	d[i], d[j] = d[j], d[i]
+	d[i].index = i
+	d[j].index = j
+}
+
+func (d *agentDeadlines) Push(x interface{}) {
+	t := x.(*agentTransaction) //nolint:forcetypeassert
+	t.index = len(*d)
+	*d = append(*d, t)
+}
+
+func (d *agentDeadlines) Pop() interface{} {
+	old := *d
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	*d = old[:n-1]
+	return t
 }
 
 // Handler handles state changes of transaction.
@@ -55,6 +159,25 @@ type Event struct {
 	TransactionID [TransactionIDSize]byte
 	Message       *Message
 	Error         error
+	// Stats is set by Client for completed transactions.
+	Stats TransactionStats
+}
+
+// TransactionStats describes transaction that was performed by Client.
+type TransactionStats struct {
+	// Start is the time when the first request was sent.
+	Start time.Time
+	// Duration is the time from the first request to completion.
+	Duration time.Duration
+	// RTT is the time from the last request to response, zero if there
+	// is no response. Can be inaccurate if request was retransmitted,
+	// as it is unknown which request the response belongs to.
+	RTT time.Duration
+	// Attempts is the number of requests sent, including retransmissions.
+	Attempts int
+	// Remote is the address of server, nil if connection does not
+	// provide it.
+	Remote net.Addr
 }
 
 // agentTransaction represents transaction in progress.
@@ -62,6 +185,8 @@ type Event struct {
 type agentTransaction struct {
 	id       transactionID
 	deadline time.Time
+	index    int     // in agentDeadlines
+	h        Handler // nil if agent handler is used
 }
 
 var (
@@ -77,20 +202,27 @@ var (
 // StopWithError removes transaction from list and calls handler with
 // provided error. Can return ErrTransactionNotExists and ErrAgentClosed.
 func (a *Agent) StopWithError(id [TransactionIDSize]byte, err error) error {
-	a.mux.Lock()
+	a.mux.RLock()
 	if a.closed {
-		a.mux.Unlock()
+		a.mux.RUnlock()
 		return ErrAgentClosed
 	}
-	t, exists := a.transactions[id]
-	delete(a.transactions, id)
-	h := a.handler
-	a.mux.Unlock()
+	s := a.shard(id)
+	s.mux.Lock()
+	h, exists := s.remove(id)
+	s.mux.Unlock()
+	if exists {
+		a.done(1)
+	}
+	if h == nil {
+		h = a.handler
+	}
+	a.mux.RUnlock()
 	if !exists {
 		return ErrTransactionNotExists
 	}
 	h(Event{
-		TransactionID: t.id,
+		TransactionID: id,
 		Error:         err,
 	})
 	return nil
@@ -106,25 +238,67 @@ func (a *Agent) Stop(id [TransactionIDSize]byte) error {
 // to handle transactions.
 var ErrAgentClosed = errors.New("agent is closed")
 
+// TransactionLimitError indicates that transaction can't be started as
+// the limit of transactions in progress is reached, see
+// Agent.SetTransactionLimit. Caller should retry later.
+type TransactionLimitError struct {
+	Limit int
+}
+
+func (e TransactionLimitError) Error() string {
+	return fmt.Sprintf("limit of %d transactions in progress is reached", e.Limit)
+}
+
+// SetTransactionLimit sets the maximum number of transactions in
+// progress, Start returns TransactionLimitError if it is reached.
+// Zero or negative limit means no limit, which is the default.
+func (a *Agent) SetTransactionLimit(limit int) error {
+	if limit < 0 {
+		limit = 0
+	}
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.closed {
+		return ErrAgentClosed
+	}
+	a.limit = int32(limit)
+	return nil
+}
+
 // Start registers transaction with provided id and deadline.
-// Could return ErrAgentClosed, ErrTransactionExists.
+// Could return ErrAgentClosed, ErrTransactionExists and
+// TransactionLimitError.
 //
 // Agent handler is guaranteed to be eventually called.
 func (a *Agent) Start(id [TransactionIDSize]byte, deadline time.Time) error {
-	a.mux.Lock()
-	defer a.mux.Unlock()
+	return a.StartWithHandler(id, deadline, nil)
+}
+
+// StartWithHandler is like Start, but events of transaction are passed to
+// h instead of agent handler. If h is nil, agent handler is used.
+func (a *Agent) StartWithHandler(id [TransactionIDSize]byte, deadline time.Time, h Handler) error {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
 	if a.closed {
 		return ErrAgentClosed
 	}
-	_, exists := a.transactions[id]
-	if exists {
-		return ErrTransactionExists
+	if n := atomic.AddInt32(&a.inFlight, 1); a.limit > 0 && n > a.limit {
+		a.done(1)
+		return TransactionLimitError{Limit: int(a.limit)}
 	}
-	a.transactions[id] = agentTransaction{
-		id:       id,
-		deadline: deadline,
+	s := a.shard(id)
+	s.mux.Lock()
+	err := s.add(id, deadline, h)
+	s.mux.Unlock()
+	if err != nil {
+		a.done(1)
 	}
-	return nil
+	return err
+}
+
+// done decrements the number of transactions in progress by n.
+func (a *Agent) done(n int) {
+	atomic.AddInt32(&a.inFlight, -int32(n))
 }
 
 // agentCollectCap is initial capacity for Agent.Collect slices,
@@ -138,60 +312,84 @@ var ErrTransactionTimeOut = errors.New("transaction is timed out")
 // time, blocking until all handlers will process ErrTransactionTimeOut.
 // Will return ErrAgentClosed if agent is already closed.
 //
+// Complexity is proportional to the number of timed out transactions,
+// not to the number of transactions in progress.
+//
 // It is safe to call Collect concurrently but makes no sense.
 func (a *Agent) Collect(gcTime time.Time) error {
-	toRemove := make([]transactionID, 0, agentCollectCap)
-	a.mux.Lock()
+	toRemove := make([]agentTimeout, 0, agentCollectCap)
+	a.mux.RLock()
 	if a.closed {
 		// Doing nothing if agent is closed.
 		// All transactions should be already closed
 		// during Close() call.
-		a.mux.Unlock()
+		a.mux.RUnlock()
 		return ErrAgentClosed
 	}
-	// Adding all transactions with deadline before gcTime
-	// to toCall and toRemove slices.
+	// Un-registering all transactions with deadline before gcTime
+	// and adding them to toRemove slice.
 	// No allocs if there are less than agentCollectCap
 	// timed out transactions.
-	for id, t := range a.transactions {
-		if t.deadline.Before(gcTime) {
-			toRemove = append(toRemove, id)
+	for i := range a.shards {
+		s := &a.shards[i]
+		s.mux.Lock()
+		for len(s.deadlines) > 0 && s.deadlines[0].deadline.Before(gcTime) {
+			t := heap.Pop(&s.deadlines).(*agentTransaction) //nolint:forcetypeassert
+			toRemove = append(toRemove, agentTimeout{id: t.id, h: t.h})
+			s.release(t)
 		}
+		s.mux.Unlock()
 	}
-	// Un-registering timed out transactions.
-	for _, id := range toRemove {
-		delete(a.transactions, id)
-	}
+	a.done(len(toRemove))
 	// Calling handler does not require locked mutex,
 	// reducing lock time.
 	h := a.handler
-	a.mux.Unlock()
+	a.mux.RUnlock()
 	// Sending ErrTransactionTimeOut to handler for all transactions,
 	// blocking until last one.
 	event := Event{
 		Error: ErrTransactionTimeOut,
 	}
-	for _, id := range toRemove {
-		event.TransactionID = id
-		h(event)
+	for _, t := range toRemove {
+		event.TransactionID = t.id
+		if t.h != nil {
+			t.h(event)
+		} else {
+			h(event)
+		}
 	}
 	return nil
 }
 
-// Process incoming message, synchronously passing it to handler.
+// agentTimeout is transaction that is timed out in Collect.
+type agentTimeout struct {
+	id transactionID
+	h  Handler
+}
+
+// Process incoming message, synchronously passing it to handler of
+// transaction or to agent handler if there is no such transaction.
 func (a *Agent) Process(m *Message) error {
 	e := Event{
 		TransactionID: m.TransactionID,
 		Message:       m,
 	}
-	a.mux.Lock()
+	a.mux.RLock()
 	if a.closed {
-		a.mux.Unlock()
+		a.mux.RUnlock()
 		return ErrAgentClosed
 	}
-	h := a.handler
-	delete(a.transactions, m.TransactionID)
-	a.mux.Unlock()
+	s := a.shard(m.TransactionID)
+	s.mux.Lock()
+	h, exists := s.remove(m.TransactionID)
+	s.mux.Unlock()
+	if exists {
+		a.done(1)
+	}
+	if h == nil {
+		h = a.handler
+	}
+	a.mux.RUnlock()
 	h(e)
 	return nil
 }
@@ -219,11 +417,23 @@ func (a *Agent) Close() error {
 		a.mux.Unlock()
 		return ErrAgentClosed
 	}
-	for _, t := range a.transactions {
-		e.TransactionID = t.id
-		a.handler(e)
+	for i := range a.shards {
+		s := &a.shards[i]
+		s.mux.Lock()
+		for _, t := range s.transactions {
+			e.TransactionID = t.id
+			if t.h != nil {
+				t.h(e)
+			} else {
+				a.handler(e)
+			}
+		}
+		s.transactions = nil
+		s.deadlines = nil
+		s.free = nil
+		s.mux.Unlock()
 	}
-	a.transactions = nil
+	atomic.StoreInt32(&a.inFlight, 0)
 	a.closed = true
 	a.handler = nil
 	a.mux.Unlock()
@@ -5,6 +5,7 @@ package stun
 
 import (
 	"errors"
+	"math/rand"
 	"testing"
 	"time"
 )
@@ -171,6 +172,175 @@ func TestAgent_GC(t *testing.T) {
 	}
 }
 
+func TestAgent_CollectDeadlines(t *testing.T) {
+	var (
+		rnd       = rand.New(rand.NewSource(1)) //nolint:gosec
+		start     = time.Date(2027, time.November, 21, 23, 0, 0, 0, time.UTC)
+		deadlines = make(map[transactionID]time.Time)
+		timedOut  = make(map[transactionID]bool)
+	)
+	a := NewAgent(func(e Event) {
+		if !errors.Is(e.Error, ErrTransactionTimeOut) {
+			return
+		}
+		if timedOut[e.TransactionID] {
+			t.Errorf("%x timed out twice", e.TransactionID)
+		}
+		timedOut[e.TransactionID] = true
+	})
+	for i := 0; i < 1000; i++ {
+		id := NewTransactionID()
+		deadlines[id] = start.Add(time.Duration(rnd.Intn(1000)) * time.Millisecond)
+		if err := a.Start(id, deadlines[id]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Stopped transactions should be removed from deadlines.
+	stopped := 0
+	for id := range deadlines {
+		if stopped == 100 {
+			break
+		}
+		if err := a.Stop(id); err != nil {
+			t.Fatal(err)
+		}
+		delete(deadlines, id)
+		stopped++
+	}
+	for gcTime := start; gcTime.Before(start.Add(time.Second)); gcTime = gcTime.Add(100 * time.Millisecond) {
+		if err := a.Collect(gcTime); err != nil {
+			t.Fatal(err)
+		}
+		for id, deadline := range deadlines {
+			if deadline.Before(gcTime) != timedOut[id] {
+				t.Fatalf("%x with deadline %s: timed out %v at %s",
+					id, deadline.Sub(start), timedOut[id], gcTime.Sub(start),
+				)
+			}
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAgent_StartWithHandler(t *testing.T) {
+	var agentEvents, events []Event
+	a := NewAgent(func(e Event) { agentEvents = append(agentEvents, e) })
+	h := func(e Event) { events = append(events, e) }
+	deadline := time.Date(2027, time.November, 21, 23, 0, 0, 0, time.UTC)
+	var ids [4]transactionID
+	for i := range ids {
+		ids[i] = NewTransactionID()
+		if err := a.StartWithHandler(ids[i], deadline.Add(time.Duration(i)*time.Second), h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.StartWithHandler(ids[0], deadline, h); !errors.Is(err, ErrTransactionExists) {
+		t.Errorf("unexpected error %v", err)
+	}
+	noHandler := NewTransactionID()
+	if err := a.StartWithHandler(noHandler, deadline.Add(time.Hour), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Collect(deadline.Add(time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Stop(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	m := MustBuild(NewTransactionIDSetter(ids[2]))
+	if err := a.Process(m); err != nil {
+		t.Fatal(err)
+	}
+	// Message of unknown transaction is passed to agent handler.
+	if err := a.Process(MustBuild(TransactionID)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range []struct {
+		id  transactionID
+		err error
+	}{
+		{ids[0], ErrTransactionTimeOut},
+		{ids[1], ErrTransactionStopped},
+		{ids[2], nil},
+		{ids[3], ErrAgentClosed},
+	} {
+		if len(events) <= i {
+			t.Fatalf("no event for %x", tc.id)
+		}
+		e := events[i]
+		if e.TransactionID != tc.id || !errors.Is(e.Error, tc.err) {
+			t.Errorf("unexpected event %x: %v, expected %x: %v", e.TransactionID, e.Error, tc.id, tc.err)
+		}
+	}
+	if len(events) != 4 {
+		t.Errorf("unexpected events count %d", len(events))
+	}
+	if len(agentEvents) != 2 {
+		t.Fatalf("unexpected agent events count %d", len(agentEvents))
+	}
+	if agentEvents[0].Message == nil || agentEvents[1].TransactionID != noHandler {
+		t.Error("unexpected agent events")
+	}
+}
+
+func TestAgent_SetTransactionLimit(t *testing.T) {
+	a := NewAgent(nil)
+	if err := a.SetTransactionLimit(2); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Date(2027, time.November, 21, 23, 0, 0, 0, time.UTC)
+	first, second := NewTransactionID(), NewTransactionID()
+	if err := a.Start(first, deadline); err != nil {
+		t.Fatal(err)
+	}
+	// Duplicate should not be counted.
+	if err := a.Start(first, deadline); !errors.Is(err, ErrTransactionExists) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := a.Start(second, deadline); err != nil {
+		t.Fatal(err)
+	}
+	start := func() error {
+		return a.Start(NewTransactionID(), deadline.Add(time.Hour))
+	}
+	var limitErr TransactionLimitError
+	if err := start(); !errors.As(err, &limitErr) || limitErr.Limit != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := a.Stop(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := start(); !errors.As(err, &limitErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := a.Collect(deadline.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetTransactionLimit(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetTransactionLimit(1); !errors.Is(err, ErrAgentClosed) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
 func BenchmarkAgent_GC(b *testing.B) {
 	a := NewAgent(nil)
 	deadline := time.Now().AddDate(0, 0, 1)
@@ -214,3 +384,80 @@ func BenchmarkAgent_Process(b *testing.B) {
 		}
 	}
 }
+
+// agentInFlight is the number of transactions in progress for benchmarks.
+const agentInFlight = 100000
+
+// agentDeadlineStep is the interval between deadlines of transactions in
+// benchmarks, agentInFlight transactions span 40 seconds, like timeout of
+// STUN transaction.
+const agentDeadlineStep = 400 * time.Microsecond
+
+// newBenchmarkAgent returns agent with agentInFlight transactions, i-th
+// transaction having deadline start + i * agentDeadlineStep.
+func newBenchmarkAgent(b *testing.B, start time.Time) *Agent {
+	a := NewAgent(nil)
+	for i := 0; i < agentInFlight; i++ {
+		if err := a.Start(NewTransactionID(), start.Add(time.Duration(i)*agentDeadlineStep)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.Cleanup(func() {
+		if err := a.Close(); err != nil {
+			b.Error(err)
+		}
+	})
+	return a
+}
+
+func BenchmarkAgent_Collect100k(b *testing.B) {
+	start := time.Now()
+	a := newBenchmarkAgent(b, start)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := a.Collect(start); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkAgent_StartCollect100k starts transaction and collects the
+// oldest one, keeping agentInFlight transactions in progress.
+func BenchmarkAgent_StartCollect100k(b *testing.B) {
+	var (
+		start = time.Now()
+		a     = newBenchmarkAgent(b, start)
+		id    transactionID
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id[0], id[1], id[2], id[3] = byte(i), byte(i>>8), byte(i>>16), byte(i>>24)
+		if err := a.Start(id, start.Add(time.Duration(agentInFlight+i)*agentDeadlineStep)); err != nil {
+			b.Fatal(err)
+		}
+		if err := a.Collect(start.Add(time.Duration(i)*agentDeadlineStep + time.Nanosecond)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAgent_StartStopParallel100k(b *testing.B) {
+	start := time.Now()
+	a := newBenchmarkAgent(b, start)
+	deadline := start.Add(time.Minute)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		id := NewTransactionID()
+		for pb.Next() {
+			if err := a.Start(id, deadline); err != nil {
+				b.Fatal(err)
+			}
+			if err := a.Stop(id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
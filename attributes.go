@@ -6,6 +6,8 @@ package stun
 import (
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 )
 
 // Attributes is list of message attributes.
@@ -157,11 +159,19 @@ func attrNames() map[AttrType]string {
 		AttrUserhash:               "USERHASH",
 		AttrPasswordAlgorithms:     "PASSWORD-ALGORITHMS",
 		AttrAlternateDomain:        "ALTERNATE-DOMAIN",
+		AttrChangeRequest:          "CHANGE-REQUEST",
+		AttrPadding:                "PADDING",
+		AttrResponsePort:           "RESPONSE-PORT",
+		AttrCacheTimeout:           "CACHE-TIMEOUT",
+		AttrResponseOrigin:         "RESPONSE-ORIGIN",
+		AttrOtherAddress:           "OTHER-ADDRESS",
 	}
 }
 
+var attrNameTable = attrNames() //nolint:gochecknoglobals
+
 func (t AttrType) String() string {
-	s, ok := attrNames()[t]
+	s, ok := attrNameTable[t]
 	if !ok {
 		// Just return hex representation of unknown attribute type.
 		return fmt.Sprintf("0x%x", uint16(t))
@@ -169,6 +179,50 @@ func (t AttrType) String() string {
 	return s
 }
 
+// appendString appends name of t to b, or hex representation of unknown
+// attribute type.
+func (t AttrType) appendString(b []byte) []byte {
+	if s, ok := attrNameTable[t]; ok {
+		return append(b, s...)
+	}
+	return strconv.AppendUint(append(b, "0x"...), uint64(t), 16)
+}
+
+// AttrSet is a set of attribute types, e.g. comprehension-required
+// attributes that are understood by agent.
+type AttrSet map[AttrType]struct{}
+
+// NewAttrSet returns set of types.
+func NewAttrSet(types ...AttrType) AttrSet {
+	s := make(AttrSet, len(types))
+	s.Add(types...)
+	return s
+}
+
+// KnownAttrs returns set of all attribute types that are known to this
+// package. Note that agent that does not implement some of them, e.g.
+// CHANGE-REQUEST of RFC 5780, should not treat them as understood.
+func KnownAttrs() AttrSet {
+	s := make(AttrSet, len(attrNameTable))
+	for t := range attrNameTable {
+		s[t] = struct{}{}
+	}
+	return s
+}
+
+// Add adds types to set.
+func (s AttrSet) Add(types ...AttrType) {
+	for _, t := range types {
+		s[t] = struct{}{}
+	}
+}
+
+// Contains reports whether t is in set.
+func (s AttrSet) Contains(t AttrType) bool {
+	_, ok := s[t]
+	return ok
+}
+
 // RawAttribute is a Type-Length-Value (TLV) object that
 // can be added to a STUN message. Attributes are divided into two
 // types: comprehension-required and comprehension-optional.  STUN
@@ -220,11 +274,145 @@ var ErrAttributeNotFound = errors.New("attribute not found")
 // if there is no attribute with such type,
 // ErrAttributeNotFound is returned.
 func (m *Message) Get(t AttrType) ([]byte, error) {
-	v, ok := m.Attributes.Get(t)
-	if !ok {
+	i := m.find(t)
+	if i < 0 {
 		return nil, ErrAttributeNotFound
 	}
-	return v.Value, nil
+	return m.Attributes[i].Value, nil
+}
+
+// find returns position of the first attribute of type t in m.Attributes,
+// or -1 if there is none.
+func (m *Message) find(t AttrType) int {
+	if i, ok := m.index.find(m.Attributes, t); ok {
+		return i
+	}
+	for i, a := range m.Attributes {
+		if a.Type == t {
+			return i
+		}
+	}
+	return -1
+}
+
+// attrIndexSize is the number of distinct attribute types in attrIndex,
+// which is enough for typical STUN messages.
+const attrIndexSize = 16
+
+// attrIndex is a fixed index of positions of the first attribute of each
+// type in Message.Attributes, so lookups do not scan all attributes. It
+// is built by Decode and extended by Add. Index is valid only for the
+// Attributes slice it was built for: if Attributes is replaced or resized
+// directly, or message has more than attrIndexSize distinct attribute
+// types, lookups fall back to linear scan until Decode or Reset. Changing
+// attributes in place or appending to Attributes without Add after resizing
+// it is not detected, Decode or Reset should be used instead.
+type attrIndex struct {
+	first *RawAttribute // &Attributes[0]
+	n     int           // len(Attributes), -1 if index is not valid
+	size  int           // number of indexed types
+	types [attrIndexSize]AttrType
+	pos   [attrIndexSize]uint16
+}
+
+func (x *attrIndex) reset() {
+	x.first = nil
+	x.n = 0
+	x.size = 0
+}
+
+// valid reports whether x can be used for lookups in attrs.
+func (x *attrIndex) valid(attrs Attributes) bool {
+	if x.n != len(attrs) {
+		return false
+	}
+	return x.n == 0 || x.first == &attrs[0]
+}
+
+// add indexes the last attribute of attrs. The x must be valid for attrs
+// without the last attribute.
+func (x *attrIndex) add(attrs Attributes) {
+	last := len(attrs) - 1
+	x.first = &attrs[0]
+	x.n = len(attrs)
+	t := attrs[last].Type
+	for i := 0; i < x.size; i++ {
+		if x.types[i] == t {
+			return
+		}
+	}
+	if x.size == attrIndexSize || last > math.MaxUint16 {
+		x.n = -1
+		return
+	}
+	x.types[x.size] = t
+	x.pos[x.size] = uint16(last)
+	x.size++
+}
+
+// find returns position of the first attribute of type t in attrs, or -1
+// if there is none. Returns false if x is not valid for attrs.
+func (x *attrIndex) find(attrs Attributes, t AttrType) (int, bool) {
+	if !x.valid(attrs) {
+		return 0, false
+	}
+	for i := 0; i < x.size; i++ {
+		if x.types[i] == t {
+			return int(x.pos[i]), true
+		}
+	}
+	return -1, true
+}
+
+// AttrIterator iterates over message attributes without allocations. Use
+// Message.Iter or Message.IterType to get one:
+//
+//	it := m.IterType(stun.AttrSoftware)
+//	for it.Next() {
+//		fmt.Println(string(it.Attr().Value))
+//	}
+//
+// Attribute values are views into Message.Raw, valid only until it is
+// modified.
+type AttrIterator struct {
+	attrs  Attributes
+	t      AttrType
+	filter bool
+	cur    RawAttribute
+}
+
+// Iter returns iterator over all attributes of m.
+func (m *Message) Iter() AttrIterator {
+	return AttrIterator{attrs: m.Attributes}
+}
+
+// IterType returns iterator over attributes of m with type t.
+func (m *Message) IterType(t AttrType) AttrIterator {
+	i := m.find(t)
+	if i < 0 {
+		return AttrIterator{}
+	}
+	return AttrIterator{attrs: m.Attributes[i:], t: t, filter: true}
+}
+
+// Next advances iterator to the next attribute, returning false if there
+// are no more attributes.
+func (it *AttrIterator) Next() bool {
+	for len(it.attrs) > 0 {
+		a := it.attrs[0]
+		it.attrs = it.attrs[1:]
+		if !it.filter || a.Type == it.t {
+			it.cur = a
+			return true
+		}
+	}
+	it.cur = RawAttribute{}
+	return false
+}
+
+// Attr returns current attribute.
+func (it *AttrIterator) Attr() RawAttribute {
+	return it.cur
 }
 
 // STUN aligns attributes on 32-bit boundaries, attributes whose content
@@ -25,6 +25,223 @@ func BenchmarkMessage_Get(b *testing.B) {
 	}
 }
 
+// newServerRequest returns decoded request like ones that ICE agent
+// receives.
+func newServerRequest(tb testing.TB) *Message {
+	tb.Helper()
+	m := MustBuild(BindingRequest, TransactionID,
+		NewUsername("local:remote"), Priority(1), ICEControlling(2), UseCandidate,
+		NewShortTermIntegrity("password"), Fingerprint,
+	)
+	decoded := new(Message)
+	if err := m.CloneTo(decoded); err != nil {
+		tb.Fatal(err)
+	}
+	return decoded
+}
+
+// BenchmarkMessage_GetServer gets attributes that server checks in
+// ICE connectivity check, with index built by Decode and with linear scan.
+func BenchmarkMessage_GetServer(b *testing.B) {
+	types := []AttrType{
+		AttrUsername, AttrPriority, AttrUseCandidate, AttrMessageIntegrity, AttrFingerprint, AttrRealm,
+	}
+	run := func(b *testing.B, m *Message) {
+		var n int
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, t := range types {
+				v, _ := m.Get(t)
+				n += len(v)
+			}
+		}
+		if n == 0 {
+			b.Fatal("no attributes")
+		}
+	}
+	b.Run("Indexed", func(b *testing.B) {
+		run(b, newServerRequest(b))
+	})
+	b.Run("Linear", func(b *testing.B) {
+		m := newServerRequest(b)
+		// Replacing attributes invalidates index.
+		m.Attributes = append(Attributes{}, m.Attributes...)
+		run(b, m)
+	})
+}
+
+func BenchmarkMessage_Contains(b *testing.B) {
+	m := newServerRequest(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !m.Contains(AttrUseCandidate) {
+			b.Fatal("no USE-CANDIDATE")
+		}
+	}
+}
+
+func BenchmarkMessage_IterType(b *testing.B) {
+	m := newServerRequest(b)
+	var n int
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		it := m.IterType(AttrMessageIntegrity)
+		for it.Next() {
+			n += len(it.Attr().Value)
+		}
+	}
+	if n == 0 {
+		b.Fatal("no attributes")
+	}
+}
+
+func BenchmarkAttrIterator(b *testing.B) {
+	m := newServerRequest(b)
+	var n int
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		it := m.Iter()
+		for it.Next() {
+			n += len(it.Attr().Value)
+		}
+	}
+	if n == 0 {
+		b.Fatal("no attributes")
+	}
+}
+
+func TestAttrIterator(t *testing.T) {
+	m := MustBuild(
+		NewSoftware("a"), NewUsername("user"), NewSoftware("b"), Fingerprint,
+	)
+	var types []AttrType
+	for it := m.Iter(); it.Next(); {
+		types = append(types, it.Attr().Type)
+	}
+	if len(types) != 4 || types[0] != AttrSoftware || types[1] != AttrUsername || types[3] != AttrFingerprint {
+		t.Errorf("unexpected types %v", types)
+	}
+	var values []string
+	it := m.IterType(AttrSoftware)
+	for it.Next() {
+		values = append(values, string(it.Attr().Value))
+	}
+	if len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("unexpected values %q", values)
+	}
+	if it.Next() || it.Attr().Value != nil {
+		t.Error("exhausted iterator should not return attributes")
+	}
+	if it = m.IterType(AttrRealm); it.Next() {
+		t.Error("unexpected attribute")
+	}
+	t.Run("ZeroCopy", func(t *testing.T) {
+		it := m.IterType(AttrUsername)
+		if !it.Next() {
+			t.Fatal("no username")
+		}
+		it.Attr().Value[0] = 'U'
+		var u Username
+		if err := u.GetFrom(m); err != nil {
+			t.Fatal(err)
+		}
+		if u.String() != "User" {
+			t.Errorf("value should be view into message, got %q", u)
+		}
+	})
+}
+
+func TestMessage_Index(t *testing.T) {
+	t.Run("Duplicate", func(t *testing.T) {
+		m := new(Message)
+		if err := MustBuild(NewSoftware("a"), NewUsername("user"), NewSoftware("b")).CloneTo(m); err != nil {
+			t.Fatal(err)
+		}
+		var s Software
+		if err := s.GetFrom(m); err != nil || s.String() != "a" {
+			t.Errorf("first attribute expected, got %q, %v", s, err)
+		}
+		if m.Contains(AttrRealm) {
+			t.Error("unexpected REALM")
+		}
+	})
+	t.Run("Overflow", func(t *testing.T) {
+		b := New()
+		for i := 0; i <= attrIndexSize; i++ {
+			b.Add(AttrType(0x8100+i), []byte{byte(i)})
+		}
+		b.WriteHeader()
+		m := new(Message)
+		if err := b.CloneTo(m); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i <= attrIndexSize; i++ {
+			v, err := m.Get(AttrType(0x8100 + i))
+			if err != nil || !bytes.Equal(v, []byte{byte(i)}) {
+				t.Errorf("%d: unexpected %v, %v", i, v, err)
+			}
+		}
+	})
+	t.Run("Replaced", func(t *testing.T) {
+		m := newServerRequest(t)
+		m.Attributes = Attributes{{Type: AttrRealm, Value: []byte("realm")}}
+		if m.Contains(AttrUsername) || !m.Contains(AttrRealm) {
+			t.Error("attributes should be looked up in replaced slice")
+		}
+		m.Attributes = m.Attributes[:0]
+		if m.Contains(AttrRealm) {
+			t.Error("attributes should be looked up in truncated slice")
+		}
+	})
+	t.Run("TruncatedAdd", func(t *testing.T) {
+		m := MustBuild(NewUsername("user"), NewSoftware("software"))
+		m.Attributes = m.Attributes[:0]
+		m.Add(AttrSoftware, []byte("new-sw"))
+		m.Add(AttrRealm, []byte("realm"))
+		if v, err := m.Get(AttrSoftware); err != nil || string(v) != "new-sw" {
+			t.Errorf("unexpected SOFTWARE %q, %v", v, err)
+		}
+		if m.Contains(AttrUsername) {
+			t.Error("USERNAME should be removed")
+		}
+		if v, err := m.Get(AttrRealm); err != nil || string(v) != "realm" {
+			t.Errorf("unexpected REALM %q, %v", v, err)
+		}
+	})
+	t.Run("Add", func(t *testing.T) {
+		m := newServerRequest(t)
+		m.Reset()
+		m.Add(AttrRealm, []byte("realm"))
+		m.Add(AttrNonce, []byte("nonce"))
+		if !m.index.valid(m.Attributes) {
+			t.Error("index should be valid after Add")
+		}
+		if v, err := m.Get(AttrNonce); err != nil || string(v) != "nonce" {
+			t.Errorf("unexpected %q, %v", v, err)
+		}
+		if m.Contains(AttrUsername) {
+			t.Error("unexpected USERNAME")
+		}
+	})
+	t.Run("ForEach", func(t *testing.T) {
+		m := MustBuild(NewSoftware("a"), NewUsername("user"), NewSoftware("b"))
+		var values []string
+		if err := m.ForEach(AttrSoftware, func(m *Message) error {
+			var s Software
+			if err := s.GetFrom(m); err != nil {
+				return err
+			}
+			values = append(values, s.String())
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(values) != 2 || values[0] != "a" || values[1] != "b" {
+			t.Errorf("unexpected values %q", values)
+		}
+	})
+}
+
 func TestRawAttribute_AddTo(t *testing.T) {
 	v := []byte{1, 2, 3, 4}
 	m, err := Build(RawAttribute{
@@ -64,6 +281,34 @@ func TestMessage_GetNoAllocs(t *testing.T) {
 			t.Error("allocated memory, but should not")
 		}
 	})
+	t.Run("Server", func(t *testing.T) {
+		req := newServerRequest(t)
+		allocs := testing.AllocsPerRun(10, func() {
+			for _, attr := range []AttrType{AttrUsername, AttrPriority, AttrMessageIntegrity, AttrFingerprint} {
+				if _, err := req.Get(attr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			req.Contains(AttrUseCandidate)
+		})
+		if allocs > 0 {
+			t.Error("allocated memory, but should not")
+		}
+	})
+	t.Run("Iterator", func(t *testing.T) {
+		req := newServerRequest(t)
+		allocs := testing.AllocsPerRun(10, func() {
+			for it := req.Iter(); it.Next(); {
+				_ = it.Attr()
+			}
+			for it := req.IterType(AttrUsername); it.Next(); {
+				_ = it.Attr()
+			}
+		})
+		if allocs > 0 {
+			t.Error("allocated memory, but should not")
+		}
+	})
 }
 
 func TestPadding(t *testing.T) {
@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+)
+
+// channelDataHeaderSize is the size of ChannelData header:
+// channel number and length, 2 bytes each.
+const channelDataHeaderSize = 4
+
+var (
+	// ErrUnexpectedChannelDataEOF means that there were not enough bytes
+	// to read ChannelData header or data.
+	ErrUnexpectedChannelDataEOF = errors.New("unexpected EOF: not enough bytes to read ChannelData")
+	// ErrBadChannelDataLength means that ChannelData has trailing bytes
+	// beyond the padding.
+	ErrBadChannelDataLength = errors.New("channelData length does not match message size")
+	// ErrInvalidChannelNumber means that channel number is not in
+	// [0x4000, 0x7FFF] range.
+	ErrInvalidChannelNumber = errors.New("channel number not in [0x4000, 0x7FFF]")
+)
+
+// ChannelData represents TURN ChannelData message that is used to send
+// application data over bound channel without STUN overhead.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|         Channel Number        |            Length             |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                                                               |
+//	/                       Application Data                        /
+//	/                                                               /
+//	|                                                               |
+//	|                               +-------------------------------+
+//	|                               |
+//	+-------------------------------+
+//
+// RFC 5766 Section 11.4
+type ChannelData struct {
+	Number ChannelNumber
+	Data   []byte // can be subslice of Raw
+	Raw    []byte
+	// Padded enables padding of Raw to multiple of 4 bytes on Encode,
+	// which is required on stream transports (TCP, TLS).
+	Padded bool
+}
+
+// Encode encodes c to c.Raw, reusing its underlying buffer.
+func (c *ChannelData) Encode() {
+	size := channelDataHeaderSize + len(c.Data)
+	if c.Padded {
+		size = channelDataHeaderSize + nearestPaddedValueLength(len(c.Data))
+	}
+	c.grow(size)
+	bin.PutUint16(c.Raw[0:2], uint16(c.Number))
+	bin.PutUint16(c.Raw[2:4], uint16(len(c.Data)))
+	copy(c.Raw[channelDataHeaderSize:], c.Data)
+	// Zeroing the padding.
+	for i := channelDataHeaderSize + len(c.Data); i < size; i++ {
+		c.Raw[i] = 0
+	}
+}
+
+// grow ensures that c.Raw has length of n, reallocating if needed.
+func (c *ChannelData) grow(n int) {
+	if cap(c.Raw) >= n {
+		c.Raw = c.Raw[:n]
+		return
+	}
+	c.Raw = make([]byte, n)
+}
+
+// Decode decodes c.Raw into c. Padding is allowed, so c.Raw can be read
+// both from datagram and from stream transport. Data is subslice of Raw.
+func (c *ChannelData) Decode() error {
+	buf := c.Raw
+	if len(buf) < channelDataHeaderSize {
+		return ErrUnexpectedChannelDataEOF
+	}
+	number := ChannelNumber(bin.Uint16(buf[0:2]))
+	if !number.Valid() {
+		return ErrInvalidChannelNumber
+	}
+	l := int(bin.Uint16(buf[2:4]))
+	size := len(buf) - channelDataHeaderSize
+	if size < l {
+		return ErrUnexpectedChannelDataEOF
+	}
+	if size > nearestPaddedValueLength(l) {
+		return ErrBadChannelDataLength
+	}
+	c.Number = number
+	c.Data = buf[channelDataHeaderSize : channelDataHeaderSize+l]
+	c.Padded = size != l
+	return nil
+}
+
+// Reset resets Raw, Data and Number, retaining Raw buffer.
+func (c *ChannelData) Reset() {
+	c.Raw = c.Raw[:0]
+	c.Data = nil
+	c.Number = 0
+}
+
+// ChannelDataSize returns the size of ChannelData message that starts
+// with header, including padding if padded is true. The header must
+// contain at least 4 bytes.
+func ChannelDataSize(header []byte, padded bool) int {
+	l := int(bin.Uint16(header[2:4]))
+	if padded {
+		l = nearestPaddedValueLength(l)
+	}
+	return channelDataHeaderSize + l
+}
+
+// IsChannelData returns true if b looks like ChannelData message: channel
+// number is valid and b contains the whole data. The first two bits
+// distinguish ChannelData (0b01) from STUN messages (0b00).
+func IsChannelData(b []byte) bool {
+	if len(b) < channelDataHeaderSize {
+		return false
+	}
+	if !ChannelNumber(bin.Uint16(b[0:2])).Valid() {
+		return false
+	}
+	return len(b) >= ChannelDataSize(b, false)
+}
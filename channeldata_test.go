@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChannelData_Encode(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		padded bool
+		raw    []byte
+	}{
+		{"Datagram", false, []byte{0x40, 0x01, 0, 3, 1, 2, 3}},
+		{"Stream", true, []byte{0x40, 0x01, 0, 3, 1, 2, 3, 0}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &ChannelData{
+				Number: 0x4001,
+				Data:   []byte{1, 2, 3},
+				Raw:    []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+				Padded: tc.padded,
+			}
+			c.Encode()
+			if !bytes.Equal(c.Raw, tc.raw) {
+				t.Errorf("unexpected raw 0x%x", c.Raw)
+			}
+			if !IsChannelData(c.Raw) {
+				t.Error("should be ChannelData")
+			}
+			if ChannelDataSize(c.Raw, tc.padded) != len(tc.raw) {
+				t.Errorf("unexpected size %d", ChannelDataSize(c.Raw, tc.padded))
+			}
+			decoded := &ChannelData{Raw: c.Raw}
+			if err := decoded.Decode(); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Number != c.Number || !bytes.Equal(decoded.Data, c.Data) || decoded.Padded != tc.padded {
+				t.Errorf("unexpected %+v", decoded)
+			}
+			decoded.Reset()
+			if len(decoded.Raw) != 0 || decoded.Data != nil || decoded.Number != 0 {
+				t.Error("should be reset")
+			}
+		})
+	}
+}
+
+func TestChannelData_Decode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		err  error
+	}{
+		{"Header", []byte{0x40, 0x01, 0}, ErrUnexpectedChannelDataEOF},
+		{"Number", []byte{0x80, 0x01, 0, 0}, ErrInvalidChannelNumber},
+		{"Data", []byte{0x40, 0x01, 0, 4, 1, 2, 3}, ErrUnexpectedChannelDataEOF},
+		{"Trailing", []byte{0x40, 0x01, 0, 1, 1, 0, 0, 0, 0}, ErrBadChannelDataLength},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &ChannelData{Raw: tc.raw}
+			if err := c.Decode(); !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestIsChannelData(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		buf  []byte
+		ok   bool
+	}{
+		{"Short", []byte{0x40, 0x01}, false},
+		{"STUN", MustBuild(TransactionID, BindingRequest).Raw, false},
+		{"Partial", []byte{0x40, 0x01, 0, 2, 1}, false},
+		{"Empty", []byte{0x40, 0x01, 0, 0}, true},
+		{"Valid", []byte{0x7f, 0xff, 0, 1, 1}, true},
+	} {
+		if IsChannelData(tc.buf) != tc.ok {
+			t.Errorf("%s: should be %t", tc.name, tc.ok)
+		}
+	}
+	if IsMessage([]byte{0x40, 0x01, 0, 0}) {
+		t.Error("ChannelData should not be STUN message")
+	}
+}
+
+func BenchmarkChannelData_Encode(b *testing.B) {
+	c := &ChannelData{
+		Number: MinChannelNumber,
+		Data:   make([]byte, 1200),
+	}
+	b.ReportAllocs()
+	b.SetBytes(1200)
+	for i := 0; i < b.N; i++ {
+		c.Encode()
+	}
+}
+
+func BenchmarkChannelData_Decode(b *testing.B) {
+	c := &ChannelData{
+		Number: MinChannelNumber,
+		Data:   make([]byte, 1200),
+	}
+	c.Encode()
+	d := &ChannelData{}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(c.Raw)))
+	for i := 0; i < b.N; i++ {
+		d.Raw = c.Raw
+		if err := d.Decode(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
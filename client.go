@@ -40,12 +40,15 @@ type DialConfig struct {
 	TLSConfig  tls.Config
 
 	Net transport.Net
+
+	// MaxRedirects is the maximum number of ALTERNATE-SERVER redirects
+	// followed by client, zero disables redirects. See WithRedirects.
+	MaxRedirects int
 }
 
 // DialURI connect to the STUN/TURN URI and then
 // initializes Client on that connection, returning error if any.
 func DialURI(uri *URI, cfg *DialConfig) (*Client, error) {
-	var conn Connection
 	var err error
 
 	nw := cfg.Net
@@ -57,6 +60,31 @@ func DialURI(uri *URI, cfg *DialConfig) (*Client, error) {
 	}
 
 	addr := net.JoinHostPort(uri.Host, strconv.Itoa(uri.Port))
+	conn, err := dialURI(nw, uri, cfg, addr, uri.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxRedirects <= 0 {
+		return NewClient(conn)
+	}
+	return NewClient(conn, WithRedirects(func(server AlternateServer, domain string) (Connection, error) {
+		// Alternate server is verified against the original domain
+		// if ALTERNATE-DOMAIN is not provided.
+		//
+		// RFC 8489 Section 10
+		if domain == "" {
+			domain = uri.Host
+		}
+		return dialURI(nw, uri, cfg, server.String(), domain)
+	}, cfg.MaxRedirects))
+}
+
+// dialURI connects to addr using scheme and transport of uri, serverName
+// is used for TLS and DTLS.
+func dialURI(nw transport.Net, uri *URI, cfg *DialConfig, addr, serverName string) (Connection, error) {
+	var conn Connection
+	var err error
 
 	switch {
 	case uri.Scheme == SchemeTypeSTUN:
@@ -76,7 +104,7 @@ func DialURI(uri *URI, cfg *DialConfig) (*Client, error) {
 
 	case uri.Scheme == SchemeTypeTURNS && uri.Proto == ProtoTypeUDP:
 		dtlsCfg := cfg.DTLSConfig // Copy
-		dtlsCfg.ServerName = uri.Host
+		dtlsCfg.ServerName = serverName
 
 		udpConn, err := nw.Dial("udp", addr)
 		if err != nil {
@@ -89,7 +117,7 @@ func DialURI(uri *URI, cfg *DialConfig) (*Client, error) {
 
 	case (uri.Scheme == SchemeTypeTURNS || uri.Scheme == SchemeTypeSTUNS) && uri.Proto == ProtoTypeTCP:
 		tlsCfg := cfg.TLSConfig //nolint:govet
-		tlsCfg.ServerName = uri.Host
+		tlsCfg.ServerName = serverName
 
 		tcpConn, err := nw.Dial("tcp", addr)
 		if err != nil {
@@ -102,7 +130,7 @@ func DialURI(uri *URI, cfg *DialConfig) (*Client, error) {
 		return nil, ErrUnsupportedURI
 	}
 
-	return NewClient(conn)
+	return conn, nil
 }
 
 // ErrNoConnection means that ClientOptions.Connection is nil.
@@ -120,6 +148,42 @@ func WithHandler(h Handler) ClientOption {
 	}
 }
 
+// ChannelDataHandler is called on ChannelData message. Usage of c is
+// valid only during call, user must copy Data explicitly.
+type ChannelDataHandler func(c *ChannelData)
+
+// WithChannelDataHandler sets handler for TURN ChannelData messages that
+// are received on client connection. Without handler such messages
+// are dropped.
+func WithChannelDataHandler(h ChannelDataHandler) ClientOption {
+	return func(c *Client) {
+		c.channelDataHandler = h
+	}
+}
+
+// WithFraming sets the way messages are delimited on connection. By default,
+// FramingStream is used for TCP connections and FramingDatagram otherwise.
+// With FramingRFC4571, every write is prefixed by length too.
+func WithFraming(f Framing) ClientOption {
+	return func(c *Client) {
+		c.framing = f
+	}
+}
+
+// WithRetransmitPolicy sets timeouts and retransmissions of requests. By
+// default, datagram connections retransmit requests defaultMaxAttempts
+// times with linearly growing timeout, (attempt+1)*RTO, and stream
+// connections use ReliableRetransmitPolicy, see WithFraming.
+//
+// RFC 8489 behavior on datagram connections is opt-in: pass zero
+// RetransmitPolicy to get its schedule with doubled timeout.
+func WithRetransmitPolicy(p RetransmitPolicy) ClientOption {
+	return func(c *Client) {
+		c.policy = p
+		c.policySet = true
+	}
+}
+
 // WithRTO sets client RTO as defined in STUN RFC.
 func WithRTO(rto time.Duration) ClientOption {
 	return func(c *Client) {
@@ -172,9 +236,11 @@ func WithNoConnClose() ClientOption {
 // defaultMaxAttempts * defaultRTO which will be effectively time out
 // if not set.
 //
-// Useful for TCP connections where transport handles RTO.
+// Useful for TCP connections where transport handles RTO, however
+// ReliableRetransmitPolicy is used for them by default.
 func WithNoRetransmit(c *Client) {
-	c.maxAttempts = 0
+	c.policy = RetransmitPolicy{Rc: 1, Rm: 1}
+	c.policySet = true
 	if c.rto == 0 {
 		c.rto = defaultMaxAttempts * int64(defaultRTO)
 	}
@@ -199,14 +265,14 @@ const (
 // connection with your (de-)multiplexer and pass the wrapper as conn.
 func NewClient(conn Connection, options ...ClientOption) (*Client, error) {
 	c := &Client{
-		close:       make(chan struct{}),
-		c:           conn,
-		clock:       systemClock(),
-		rto:         int64(defaultRTO),
-		rtoRate:     defaultTimeoutRate,
-		t:           make(map[transactionID]*clientTransaction, 100),
-		maxAttempts: defaultMaxAttempts,
-		closeConn:   true,
+		close:     make(chan struct{}),
+		c:         conn,
+		clock:     systemClock(),
+		rto:       int64(defaultRTO),
+		rtoRate:   defaultTimeoutRate,
+		t:         make(map[transactionID]*clientTransaction, 100),
+		rtt:       make(map[string]*rttEstimator),
+		closeConn: true,
 	}
 	for _, o := range options {
 		o(c)
@@ -214,6 +280,20 @@ func NewClient(conn Connection, options ...ClientOption) (*Client, error) {
 	if c.c == nil {
 		return nil, ErrNoConnection
 	}
+	if c.framing == FramingAuto {
+		c.framing = detectFraming(c.c)
+	}
+	c.remote = remoteAddr(c.c)
+	if c.framing == FramingRFC4571 {
+		c.c = rfc4571Conn{Connection: c.c}
+	}
+	if !c.policySet {
+		if c.framing != FramingDatagram {
+			c.policy = ReliableRetransmitPolicy()
+		} else {
+			c.policy = linearRetransmitPolicy()
+		}
+	}
 	if c.a == nil {
 		c.a = NewAgent(nil)
 	}
@@ -231,8 +311,9 @@ func NewClient(conn Connection, options ...ClientOption) (*Client, error) {
 	}); err != nil {
 		return nil, err
 	}
+	c.replaced = make(chan struct{})
 	c.wg.Add(1)
-	go c.readUntilClosed()
+	go c.readUntilClosed(c.c, c.replaced)
 	runtime.SetFinalizer(c, clientFinalizer)
 	return c, nil
 }
@@ -277,17 +358,30 @@ type Client struct {
 	c           Connection
 	close       chan struct{}
 	rtoRate     time.Duration
-	maxAttempts int32
+	policy      RetransmitPolicy
+	policySet   bool
 	closed      bool
 	closeConn   bool // should call c.Close() while closing
 	wg          sync.WaitGroup
 	clock       Clock
 	handler     Handler
 	collector   Collector
+	credentials *clientCredentials
 	t           map[transactionID]*clientTransaction
 
-	// mux guards closed and t
+	channelDataHandler ChannelDataHandler
+	framing            Framing
+	redirectDial       RedirectDialer
+	maxRedirects       int
+	replaced           chan struct{} // closed when c is replaced on redirect
+	remote             net.Addr      // address of server that c is connected to
+	metrics            Metrics
+
+	// mux guards closed, t, c, closeConn, replaced and remote
 	mux sync.RWMutex
+
+	rtt    map[string]*rttEstimator // server -> RTO estimation
+	rttMux sync.Mutex
 }
 
 // clientTransaction represents transaction in progress.
@@ -301,6 +395,9 @@ type clientTransaction struct {
 	h       Handler
 	start   time.Time
 	rto     time.Duration
+	policy  *RetransmitPolicy
+	remote  net.Addr
+	sent    time.Time // last request
 	raw     []byte
 }
 
@@ -327,11 +424,14 @@ func putClientTransaction(t *clientTransaction) {
 	t.start = time.Time{}
 	t.attempt = 0
 	t.id = transactionID{}
+	t.policy = nil
+	t.remote = nil
+	t.sent = time.Time{}
 	clientTransactionPool.Put(t)
 }
 
 func (t *clientTransaction) nextTimeout(now time.Time) time.Time {
-	return now.Add(time.Duration(t.attempt+1) * t.rto)
+	return now.Add(t.policy.timeout(t.attempt, t.rto))
 }
 
 // start registers transaction.
@@ -364,9 +464,13 @@ func systemClock() systemClockService {
 	return systemClockService{}
 }
 
-// SetRTO sets current RTO value.
+// SetRTO sets current RTO value, discarding RTO that was estimated from
+// round-trip times.
 func (c *Client) SetRTO(rto time.Duration) {
 	atomic.StoreInt64(&c.rto, int64(rto))
+	c.rttMux.Lock()
+	c.rtt = make(map[string]*rttEstimator)
+	c.rttMux.Unlock()
 }
 
 // StopErr occurs when Client fails to stop transaction while
@@ -401,25 +505,78 @@ func (c CloseErr) Error() string {
 	return fmt.Sprintf("failed to close: %s (connection), %s (agent)", sprintErr(c.ConnectionErr), sprintErr(c.AgentErr))
 }
 
-func (c *Client) readUntilClosed() {
+// readUntilClosed reads messages from conn until client is closed or conn
+// is replaced.
+func (c *Client) readUntilClosed(conn Connection, replaced <-chan struct{}) {
 	defer c.wg.Done()
-	m := new(Message)
-	m.Raw = make([]byte, 1024)
+	var (
+		m  = new(Message)
+		cd = new(ChannelData)
+	)
+	if c.framing == FramingDatagram {
+		// Enough for TURN Data indications carrying MTU-sized datagrams.
+		buf := make([]byte, 2048)
+		for {
+			select {
+			case <-c.close:
+				return
+			case <-replaced:
+				return
+			default:
+			}
+			n, err := conn.Read(buf)
+			if err != nil {
+				continue
+			}
+			if c.processFrame(buf[:n], m, cd) {
+				return
+			}
+		}
+	}
+	var r *StreamReader
+	if c.framing == FramingRFC4571 {
+		r = NewRFC4571Reader(conn)
+	} else {
+		r = NewStreamReader(conn)
+	}
 	for {
+		b, err := r.Next()
+		if err != nil {
+			// Message boundaries are lost, so stream can't be read
+			// further. Pending transactions will time out.
+			return
+		}
 		select {
-		case <-c.close:
+		case <-replaced:
 			return
 		default:
 		}
-		_, err := m.ReadFrom(c.c)
-		if err == nil {
-			if pErr := c.a.Process(m); errors.Is(pErr, ErrAgentClosed) {
-				return
-			}
+		if c.processFrame(b, m, cd) {
+			return
 		}
 	}
 }
 
+// processFrame passes ChannelData to handler and STUN message to agent,
+// returning true if agent is closed.
+func (c *Client) processFrame(b []byte, m *Message, cd *ChannelData) bool {
+	if IsChannelData(b) {
+		if c.channelDataHandler == nil {
+			return false
+		}
+		cd.Raw = b
+		if cd.Decode() == nil {
+			c.channelDataHandler(cd)
+		}
+		return false
+	}
+	m.Raw = b
+	if m.Decode() != nil {
+		return false
+	}
+	return errors.Is(c.a.Process(m), ErrAgentClosed)
+}
+
 func closedOrPanic(err error) {
 	if err == nil || errors.Is(err, ErrAgentClosed) {
 		return
@@ -479,14 +636,15 @@ func (c *Client) Close() error {
 		return ErrClientClosed
 	}
 	c.closed = true
+	conn, closeConn := c.c, c.closeConn
 	c.mux.Unlock()
 	if closeErr := c.collector.Close(); closeErr != nil {
 		return closeErr
 	}
 	var connErr error
 	agentErr := c.a.Close()
-	if c.closeConn {
-		connErr = c.c.Close()
+	if closeConn {
+		connErr = conn.Close()
 	}
 	close(c.close)
 	c.wg.Wait()
@@ -505,6 +663,27 @@ func (c *Client) Indicate(m *Message) error {
 	return c.Start(m, nil)
 }
 
+// WriteChannelData encodes cd and sends it to server over current
+// connection, framing it the same way as messages. Data is padded to
+// 4 bytes on stream connections.
+//
+// RFC 5766 Section 11.5
+func (c *Client) WriteChannelData(cd *ChannelData) error {
+	if err := c.checkInit(); err != nil {
+		return err
+	}
+	c.mux.RLock()
+	closed := c.closed
+	c.mux.RUnlock()
+	if closed {
+		return ErrClientClosed
+	}
+	cd.Padded = c.framing != FramingDatagram
+	cd.Encode()
+	_, err := c.conn().Write(cd.Raw)
+	return err
+}
+
 // callbackWaitHandler blocks on wait() call until callback is called.
 type callbackWaitHandler struct {
 	handler   Handler
@@ -558,17 +737,25 @@ var callbackWaitHandlerPool = sync.Pool{ //nolint:gochecknoglobals
 var ErrClientNotInitialized = errors.New("client not initialized")
 
 func (c *Client) checkInit() error {
-	if c == nil || c.c == nil || c.a == nil || c.close == nil {
+	if c == nil || c.a == nil || c.close == nil || c.conn() == nil {
 		return ErrClientNotInitialized
 	}
 	return nil
 }
 
+// conn returns current connection, which is changed on redirect.
+func (c *Client) conn() Connection {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.c
+}
+
 // Do is Start wrapper that waits until callback is called. If no callback
 // provided, Indicate is called instead.
 //
 // Do has cpu overhead due to blocking, see BenchmarkClient_Do.
-// Use Start method for less overhead.
+// Use Start method for less overhead. Use DoContext for cancellation
+// and per-call deadlines.
 func (c *Client) Do(m *Message, f func(Event)) error {
 	if err := c.checkInit(); err != nil {
 		return err
@@ -588,6 +775,54 @@ func (c *Client) Do(m *Message, f func(Event)) error {
 	return nil
 }
 
+// DoTo is Do that copies response to res, returning transaction error if
+// any. Error responses are copied without error, use ErrorCodeAttribute
+// to check them, except 420 (Unknown Attribute) that is returned as
+// UnknownAttributeError. Does not allocate if res has enough capacity, so res
+// can be acquired by AcquireMessage and reused.
+//
+// Indications are sent without waiting and res is not modified.
+func (c *Client) DoTo(m, res *Message) error {
+	if m.Type.Class == ClassIndication {
+		return c.Do(m, nil)
+	}
+	r := responseCopierPool.Get().(*responseCopier) //nolint:forcetypeassert
+	r.res = res
+	err := c.Do(m, r.handler)
+	if err == nil {
+		err = r.err
+	}
+	r.res, r.err = nil, nil
+	responseCopierPool.Put(r)
+	return err
+}
+
+// responseCopier copies response of transaction to res.
+type responseCopier struct {
+	res     *Message
+	err     error
+	handler Handler
+}
+
+func (r *responseCopier) handleEvent(e Event) {
+	switch {
+	case e.Error != nil:
+		r.err = e.Error
+	case e.Message == nil:
+		r.res.Reset()
+	default:
+		r.err = e.Message.CloneTo(r.res)
+	}
+}
+
+var responseCopierPool = sync.Pool{ //nolint:gochecknoglobals
+	New: func() interface{} {
+		r := new(responseCopier)
+		r.handler = r.handleEvent
+		return r
+	},
+}
+
 func (c *Client) delete(id transactionID) {
 	c.mux.Lock()
 	if c.t != nil {
@@ -624,10 +859,14 @@ func (c *Client) handleAgentCallback(e Event) {
 		// Ignoring.
 		return
 	}
-	if atomic.LoadInt32(&c.maxAttempts) <= t.attempt || e.Error == nil {
-		// Transaction completed.
-		t.handle(e)
-		putClientTransaction(t)
+	now := c.clock.Now()
+	if e.Error == nil && e.Message != nil && t.attempt == 0 {
+		// Sampling only transactions without retransmissions.
+		c.sampleRTT(remoteKey(t.remote), now.Sub(t.start), now)
+	}
+	if t.policy.retransmissions() <= t.attempt || !errors.Is(e.Error, ErrTransactionTimeOut) {
+		// Transaction completed or stopped.
+		c.complete(t, e, now)
 		return
 	}
 	// Doing re-transmission.
@@ -636,28 +875,26 @@ func (c *Client) handleAgentCallback(e Event) {
 	b.buf = b.buf[:copy(b.buf[:cap(b.buf)], t.raw)]
 	defer bufferPool.Put(b)
 	var (
-		now     = c.clock.Now()
 		timeOut = t.nextTimeout(now)
 		id      = t.id
 	)
+	t.sent = now
 	// Starting client transaction.
 	if startErr := c.start(t); startErr != nil {
 		c.delete(id)
 		e.Error = startErr
-		t.handle(e)
-		putClientTransaction(t)
+		c.complete(t, e, now)
 		return
 	}
 	// Starting agent transaction.
 	if startErr := c.a.Start(id, timeOut); startErr != nil {
 		c.delete(id)
 		e.Error = startErr
-		t.handle(e)
-		putClientTransaction(t)
+		c.complete(t, e, now)
 		return
 	}
 	// Writing message to connection again.
-	_, writeErr := c.c.Write(b.buf)
+	_, writeErr := c.conn().Write(b.buf)
 	if writeErr != nil {
 		c.delete(id)
 		e.Error = writeErr
@@ -671,12 +908,33 @@ func (c *Client) handleAgentCallback(e Event) {
 				Cause: writeErr,
 			}
 		}
-		t.handle(e)
-		putClientTransaction(t)
+		c.complete(t, e, now)
 		return
 	}
 }
 
+// complete sets stats of transaction t that is completed at now to e,
+// passing it to metrics and transaction handler.
+func (c *Client) complete(t *clientTransaction, e Event, now time.Time) {
+	e.Stats = TransactionStats{
+		Start:    t.start,
+		Duration: now.Sub(t.start),
+		Attempts: int(t.attempt) + 1,
+		Remote:   t.remote,
+	}
+	if e.Error == nil && e.Message != nil {
+		e.Stats.RTT = now.Sub(t.sent)
+		// Request with same comprehension-required attributes would be
+		// rejected again, so 420 completes transaction with error.
+		e.Error = unknownAttributeError(e.Message)
+	}
+	if c.metrics != nil {
+		c.metrics.ObserveTransaction(e)
+	}
+	t.handle(e)
+	putClientTransaction(t)
+}
+
 // Start starts transaction (if h set) and writes message to server, handler
 // is called asynchronously.
 func (c *Client) Start(m *Message, h Handler) error {
@@ -689,13 +947,35 @@ func (c *Client) Start(m *Message, h Handler) error {
 	if closed {
 		return ErrClientClosed
 	}
+	if h != nil && c.redirectDial != nil && m.Type.Class == ClassRequest {
+		return c.startRedirect(m, h)
+	}
+	return c.startRequest(m, h)
+}
+
+// startRequest starts transaction for m, handling authentication
+// challenges if needed.
+func (c *Client) startRequest(m *Message, h Handler) error {
+	if h != nil && c.needsAuth(m) {
+		return c.startAuth(m, h)
+	}
+	return c.startTransaction(m, h)
+}
+
+// startTransaction starts transaction if h is set and writes m to server.
+func (c *Client) startTransaction(m *Message, h Handler) error {
 	if h != nil {
 		// Starting transaction only if h is set. Useful for indications.
 		t := acquireClientTransaction()
 		t.id = m.TransactionID
 		t.start = c.clock.Now()
 		t.h = h
-		t.rto = time.Duration(atomic.LoadInt64(&c.rto))
+		c.mux.RLock()
+		t.remote = c.remote
+		c.mux.RUnlock()
+		t.sent = t.start
+		t.rto = c.transactionRTO(remoteKey(t.remote), t.start)
+		t.policy = &c.policy
 		t.attempt = 0
 		t.raw = append(t.raw[:0], m.Raw...)
 		t.calls = 0
@@ -704,10 +984,11 @@ func (c *Client) Start(m *Message, h Handler) error {
 			return err
 		}
 		if err := c.a.Start(m.TransactionID, d); err != nil {
+			c.delete(m.TransactionID)
 			return err
 		}
 	}
-	_, err := m.WriteTo(c.c)
+	_, err := m.WriteTo(c.conn())
 	if err != nil && h != nil {
 		c.delete(m.TransactionID)
 		// Stopping transaction instead of waiting until deadline.
@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"bytes"
+	"sync"
+)
+
+// WithCredentials enables the long-term credential mechanism for requests
+// sent by client.
+//
+// The first request is sent without credentials. When server responds with
+// 401 (Unauthorized) or 438 (Stale Nonce), client saves REALM and NONCE from
+// the response, negotiates password algorithm and transparently retries the
+// request with USERNAME, REALM, NONCE and MESSAGE-INTEGRITY in a new
+// transaction. Subsequent requests are signed with the saved values right
+// away, so handler only gets the final response.
+//
+// Requests that already contain MESSAGE-INTEGRITY or MESSAGE-INTEGRITY-SHA256
+// are sent as-is.
+//
+// RFC 8489 Section 9.2
+func WithCredentials(username, password string) ClientOption {
+	return func(c *Client) {
+		c.credentials = &clientCredentials{
+			username: username,
+			password: password,
+		}
+	}
+}
+
+// maxAuthAttempts is the maximum number of times request is re-sent due to
+// 401 and 438 error responses.
+const maxAuthAttempts = 3
+
+// clientCredentials holds long-term credentials and the state of the
+// last authentication challenge.
+type clientCredentials struct {
+	username string
+	password string
+
+	mux        sync.RWMutex // guards fields below
+	realm      Realm
+	nonce      Nonce
+	algorithm  PasswordAlgorithm
+	algorithms PasswordAlgorithms
+	key        []byte
+}
+
+// ready reports whether credentials can be used to sign requests.
+func (c *clientCredentials) ready() bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.key != nil
+}
+
+// update saves realm, nonce and password algorithm from the 401 or 438
+// error response res.
+func (c *clientCredentials) update(res *Message) error {
+	var (
+		realm Realm
+		nonce Nonce
+	)
+	if err := nonce.GetFrom(res); err != nil {
+		return err
+	}
+	alg, algorithms, err := NegotiatePasswordAlgorithm(res)
+	if err != nil {
+		return err
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if realmErr := realm.GetFrom(res); realmErr != nil {
+		if c.realm == nil {
+			return realmErr
+		}
+		// Stale nonce response can omit realm, using the saved one.
+		realm = c.realm
+	}
+	key, err := NewLongTermKey(alg.Type, c.username, realm.String(), c.password)
+	if err != nil {
+		return err
+	}
+	// Copying values to make them valid after res.Raw change.
+	c.realm = append(Realm{}, realm...)
+	c.nonce = append(Nonce{}, nonce...)
+	c.algorithm = alg
+	c.algorithms = algorithms
+	c.key = key
+	return nil
+}
+
+// rejected reports whether credentials were rejected, i.e. res is 401 for
+// request that was signed with the current nonce.
+func (c *clientCredentials) rejected(req, res *Message) bool {
+	var sent, nonce Nonce
+	if err := sent.GetFrom(req); err != nil {
+		return false
+	}
+	if err := nonce.GetFrom(res); err != nil {
+		return true
+	}
+	return bytes.Equal(sent, nonce)
+}
+
+// sign returns a copy of req with transaction id set to id, signed with
+// saved credentials. Authentication attributes of req are replaced.
+func (c *clientCredentials) sign(req *Message, id [TransactionIDSize]byte) (*Message, error) {
+	m := New()
+	m.Type = req.Type
+	m.TransactionID = id
+	m.WriteHeader()
+	for _, a := range req.Attributes {
+		switch a.Type {
+		case AttrUsername, AttrUserhash, AttrRealm, AttrNonce,
+			AttrPasswordAlgorithm, AttrPasswordAlgorithms,
+			AttrMessageIntegrity, AttrMessageIntegritySHA256, AttrFingerprint:
+			continue
+		}
+		m.Add(a.Type, a.Value)
+	}
+	c.mux.RLock()
+	setters := []Setter{NewUsername(c.username), c.realm, c.nonce}
+	if c.algorithms != nil {
+		// Server supports RFC 8489, so using its integrity attribute.
+		setters = append(setters, c.algorithm, c.algorithms, MessageIntegritySHA256(c.key))
+	} else {
+		setters = append(setters, MessageIntegrity(c.key))
+	}
+	c.mux.RUnlock()
+	if req.Contains(AttrFingerprint) {
+		setters = append(setters, Fingerprint)
+	}
+	for _, s := range setters {
+		if err := s.AddTo(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// authTransaction handles authentication challenges for the request,
+// passing only the final event to h.
+type authTransaction struct {
+	c       *Client
+	req     *Message // request without credentials
+	sent    *Message // last sent request
+	h       Handler
+	attempt int
+}
+
+func (t *authTransaction) handleEvent(e Event) {
+	if e.Error != nil || e.Message == nil || e.Message.Type.Class != ClassErrorResponse ||
+		t.attempt >= maxAuthAttempts {
+		t.h(e)
+		return
+	}
+	var code ErrorCodeAttribute
+	if err := code.GetFrom(e.Message); err != nil {
+		t.h(e)
+		return
+	}
+	switch code.Code {
+	case CodeUnauthorized:
+		if t.c.credentials.rejected(t.sent, e.Message) {
+			t.h(e)
+			return
+		}
+	case CodeStaleNonce:
+	default:
+		t.h(e)
+		return
+	}
+	if err := t.c.credentials.update(e.Message); err != nil {
+		e.Error = err
+		t.h(e)
+		return
+	}
+	// Retrying in a new transaction, RFC 8489 Section 9.2.5.
+	m, err := t.c.credentials.sign(t.req, NewTransactionID())
+	if err != nil {
+		e.Error = err
+		t.h(e)
+		return
+	}
+	t.attempt++
+	t.sent = m
+	if err = t.c.startTransaction(m, t.handleEvent); err != nil {
+		e.Error = err
+		t.h(e)
+	}
+}
+
+// startAuth starts transaction for request m, handling authentication
+// challenges.
+func (c *Client) startAuth(m *Message, h Handler) error {
+	t := &authTransaction{
+		c:   c,
+		req: new(Message),
+		h:   h,
+	}
+	if err := m.CloneTo(t.req); err != nil {
+		return err
+	}
+	t.sent = t.req
+	if c.credentials.ready() {
+		// Keeping transaction id of m, so caller can still refer to it.
+		signed, err := c.credentials.sign(t.req, t.req.TransactionID)
+		if err != nil {
+			return err
+		}
+		t.sent = signed
+	}
+	return c.startTransaction(t.sent, t.handleEvent)
+}
+
+// needsAuth reports whether request m should be handled by startAuth.
+func (c *Client) needsAuth(m *Message) bool {
+	return c.credentials != nil && m.Type.Class == ClassRequest &&
+		!m.Contains(AttrMessageIntegrity) && !m.Contains(AttrMessageIntegritySHA256)
+}
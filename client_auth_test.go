@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package stun
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/pion/stun/v2/stuntest"
+)
+
+// authResponder emulates server that uses long-term credentials.
+type authResponder struct {
+	realm      string
+	password   string
+	algorithms PasswordAlgorithms
+
+	mux      sync.Mutex
+	nonce    Nonce
+	requests []*Message
+}
+
+func (r *authResponder) setNonce(nonce string) {
+	r.mux.Lock()
+	if r.algorithms != nil {
+		r.nonce = NewNonceWithFeatures(FeaturePasswordAlgorithms, nonce)
+	} else {
+		r.nonce = NewNonce(nonce)
+	}
+	r.mux.Unlock()
+}
+
+func (r *authResponder) handle(b []byte) ([]byte, error) {
+	req := new(Message)
+	if err := Decode(b, req); err != nil {
+		return nil, err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.requests = append(r.requests, req)
+	errorResponse := func(code ErrorCode) ([]byte, error) {
+		setters := []Setter{
+			req, NewType(req.Type.Method, ClassErrorResponse), code,
+			NewRealm(r.realm), r.nonce,
+		}
+		if r.algorithms != nil {
+			setters = append(setters, r.algorithms)
+		}
+		res, err := Build(setters...)
+		if err != nil {
+			return nil, err
+		}
+		return res.Raw, nil
+	}
+	var (
+		username Username
+		nonce    Nonce
+	)
+	if err := req.Parse(&username, &nonce); err != nil {
+		return errorResponse(CodeUnauthorized)
+	}
+	if nonce.String() != r.nonce.String() {
+		return errorResponse(CodeStaleNonce)
+	}
+	alg, err := CheckPasswordAlgorithm(req, r.algorithms)
+	if err != nil {
+		return errorResponse(CodeBadRequest)
+	}
+	key, err := NewLongTermKey(alg.Type, username.String(), r.realm, r.password)
+	if err != nil {
+		return nil, err
+	}
+	if r.algorithms != nil {
+		err = MessageIntegritySHA256(key).Check(req)
+	} else {
+		err = MessageIntegrity(key).Check(req)
+	}
+	if err != nil {
+		return errorResponse(CodeUnauthorized)
+	}
+	res, err := Build(req, BindingSuccess, MessageIntegrity(key))
+	if err != nil {
+		return nil, err
+	}
+	return res.Raw, nil
+}
+
+// do performs binding request, returning response error code, if any.
+func (r *authResponder) do(t *testing.T, c *Client) ErrorCode {
+	t.Helper()
+	var (
+		code ErrorCodeAttribute
+		res  *Message
+	)
+	if err := c.Do(MustBuild(TransactionID, BindingRequest, Fingerprint), func(e Event) {
+		if e.Error != nil {
+			t.Error(e.Error)
+			return
+		}
+		res = new(Message)
+		if err := e.Message.CloneTo(res); err != nil {
+			t.Error(err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if res == nil {
+		t.FailNow()
+	}
+	if res.Type.Class == ClassSuccessResponse {
+		return 0
+	}
+	if err := code.GetFrom(res); err != nil {
+		t.Fatal(err)
+	}
+	return code.Code
+}
+
+func (r *authResponder) requestCount() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.requests)
+}
+
+func (r *authResponder) lastRequest() *Message {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.requests[len(r.requests)-1]
+}
+
+func testClientCredentials(t *testing.T, r *authResponder, password string) *Client {
+	t.Helper()
+	addr, closeServer, err := stuntest.NewUDPServer(t, "udp4", 1500, r.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeServer(t) })
+	conn, err := net.Dial("udp4", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(conn, WithCredentials("user", password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if closeErr := c.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	})
+	return c
+}
+
+func TestClient_WithCredentials(t *testing.T) {
+	t.Run("MD5", func(t *testing.T) {
+		r := &authResponder{realm: "realm", password: "pass"}
+		r.setNonce("nonce")
+		c := testClientCredentials(t, r, "pass")
+		if code := r.do(t, c); code != 0 {
+			t.Fatalf("unexpected code %d", code)
+		}
+		if n := r.requestCount(); n != 2 {
+			t.Errorf("unexpected request count %d", n)
+		}
+		last := r.lastRequest()
+		if !last.Contains(AttrMessageIntegrity) || last.Contains(AttrMessageIntegritySHA256) {
+			t.Error("MESSAGE-INTEGRITY expected")
+		}
+		if err := Fingerprint.Check(last); err != nil {
+			t.Error(err)
+		}
+
+		// Saved realm and nonce should be used right away.
+		if code := r.do(t, c); code != 0 {
+			t.Fatalf("unexpected code %d", code)
+		}
+		if n := r.requestCount(); n != 3 {
+			t.Errorf("unexpected request count %d", n)
+		}
+
+		// Stale nonce should be refreshed.
+		r.setNonce("nonce2")
+		if code := r.do(t, c); code != 0 {
+			t.Fatalf("unexpected code %d", code)
+		}
+		if n := r.requestCount(); n != 5 {
+			t.Errorf("unexpected request count %d", n)
+		}
+	})
+	t.Run("SHA256", func(t *testing.T) {
+		r := &authResponder{
+			realm:    "realm",
+			password: "pass",
+			algorithms: PasswordAlgorithms{
+				{Type: PasswordAlgorithmMD5},
+				{Type: PasswordAlgorithmSHA256},
+			},
+		}
+		r.setNonce("nonce")
+		c := testClientCredentials(t, r, "pass")
+		if code := r.do(t, c); code != 0 {
+			t.Fatalf("unexpected code %d", code)
+		}
+		var alg PasswordAlgorithm
+		last := r.lastRequest()
+		if err := alg.GetFrom(last); err != nil {
+			t.Fatal(err)
+		}
+		if alg.Type != PasswordAlgorithmSHA256 {
+			t.Errorf("unexpected algorithm %s", alg)
+		}
+		if !last.Contains(AttrMessageIntegritySHA256) {
+			t.Error("MESSAGE-INTEGRITY-SHA256 expected")
+		}
+	})
+	t.Run("Rejected", func(t *testing.T) {
+		r := &authResponder{realm: "realm", password: "pass"}
+		r.setNonce("nonce")
+		c := testClientCredentials(t, r, "bad")
+		if code := r.do(t, c); code != CodeUnauthorized {
+			t.Fatalf("unexpected code %d", code)
+		}
+		if n := r.requestCount(); n != 2 {
+			t.Errorf("unexpected request count %d", n)
+		}
+	})
+	t.Run("TransactionID", func(t *testing.T) {
+		r := &authResponder{realm: "realm", password: "pass"}
+		r.setNonce("nonce")
+		c := testClientCredentials(t, r, "pass")
+		if code := r.do(t, c); code != 0 {
+			t.Fatalf("unexpected code %d", code)
+		}
+		// Signed right away, so transaction id should be kept.
+		m := MustBuild(TransactionID, BindingRequest)
+		if err := c.Do(m, func(e Event) {
+			if e.TransactionID != m.TransactionID {
+				t.Error("unexpected event transaction id")
+			}
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if r.lastRequest().TransactionID != m.TransactionID {
+			t.Error("transaction id of signed request should be kept")
+		}
+
+		// Retry after stale nonce should use new transaction id.
+		r.setNonce("nonce2")
+		m = MustBuild(TransactionID, BindingRequest)
+		if err := c.Do(m, func(e Event) {}); err != nil {
+			t.Fatal(err)
+		}
+		if n := r.requestCount(); n != 5 {
+			t.Fatalf("unexpected request count %d", n)
+		}
+		if r.lastRequest().TransactionID == m.TransactionID {
+			t.Error("retry should use new transaction id")
+		}
+	})
+	t.Run("Manual", func(t *testing.T) {
+		r := &authResponder{realm: "realm", password: "pass"}
+		r.setNonce("nonce")
+		c := testClientCredentials(t, r, "bad")
+		// Request with integrity should be sent as-is.
+		m := MustBuild(TransactionID, BindingRequest,
+			NewUsername("user"), NewRealm("realm"), NewNonce("nonce"),
+			NewLongTermIntegrity("user", "realm", "pass"),
+		)
+		if err := c.Do(m, func(e Event) {
+			if e.Error != nil {
+				t.Error(e.Error)
+				return
+			}
+			if e.Message.Type != BindingSuccess {
+				t.Errorf("unexpected response %s", e.Message)
+			}
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if n := r.requestCount(); n != 1 {
+			t.Errorf("unexpected request count %d", n)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"context"
+	"sync"
+)
+
+// errorStopper is implemented by agents that can stop transaction with
+// custom error, like Agent.
+type errorStopper interface {
+	StopWithError(id [TransactionIDSize]byte, err error) error
+}
+
+// contextTransaction calls handler exactly once, either with transaction
+// result or with context error.
+type contextTransaction struct {
+	h    Handler
+	once sync.Once
+	done chan struct{}
+}
+
+func (t *contextTransaction) handleEvent(e Event) {
+	t.once.Do(func() {
+		close(t.done)
+		t.h(e)
+	})
+}
+
+// StartContext is Start that stops transaction with ctx.Err() if ctx is
+// done before transaction completes. Handler is called exactly once.
+//
+// Returns ctx.Err() without sending m if ctx is already done.
+func (c *Client) StartContext(ctx context.Context, m *Message, h Handler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if h == nil {
+		return c.Start(m, nil)
+	}
+	t := &contextTransaction{
+		h:    h,
+		done: make(chan struct{}),
+	}
+	if err := c.Start(m, t.handleEvent); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		// Context can't be canceled.
+		return nil
+	}
+	id := m.TransactionID
+	go func() {
+		select {
+		case <-t.done:
+		case <-ctx.Done():
+			c.stopWithError(t, id, ctx.Err())
+		}
+	}()
+	return nil
+}
+
+// stopWithError stops agent transaction id with err. If agent can't stop
+// it, e.g. because request was re-sent in another transaction due to
+// authentication, handler of t is called directly and the underlying
+// transaction result is ignored.
+func (c *Client) stopWithError(t *contextTransaction, id [TransactionIDSize]byte, err error) {
+	if s, ok := c.a.(errorStopper); ok && s.StopWithError(id, err) == nil {
+		return
+	}
+	t.handleEvent(Event{
+		TransactionID: id,
+		Error:         err,
+	})
+}
+
+// DoContext performs transaction for request m, blocking until response
+// is received, transaction fails or ctx is done. Error responses are
+// returned as message without error, use ErrorCodeAttribute to check them,
+// except for 420 (Unknown Attribute), which is returned as
+// UnknownAttributeError with nil message.
+// The returned message is a copy and can be used after call.
+//
+// Indications are sent without waiting, returning nil message.
+func (c *Client) DoContext(ctx context.Context, m *Message) (*Message, error) {
+	if m.Type.Class == ClassIndication {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, c.Indicate(m)
+	}
+	var (
+		res    *Message
+		resErr error
+		done   = make(chan struct{})
+	)
+	if err := c.StartContext(ctx, m, func(e Event) {
+		defer close(done)
+		if e.Error != nil {
+			resErr = e.Error
+			return
+		}
+		res = new(Message)
+		resErr = e.Message.CloneTo(res)
+	}); err != nil {
+		return nil, err
+	}
+	<-done
+	if resErr != nil {
+		return nil, resErr
+	}
+	return res, nil
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package stun
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v2/stuntest"
+)
+
+// silentClient returns client connected to server that never responds.
+func silentClient(t *testing.T) *Client {
+	t.Helper()
+	server, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+	c, err := Dial("udp4", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := c.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return c
+}
+
+func TestClient_DoContext(t *testing.T) {
+	t.Run("Response", func(t *testing.T) {
+		addr, closeServer, err := stuntest.NewUDPServer(t, "udp4", 1500, func(b []byte) ([]byte, error) {
+			req := new(Message)
+			if err := Decode(b, req); err != nil {
+				return nil, err
+			}
+			return MustBuild(req, BindingSuccess, NewSoftware("server")).Raw, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeServer(t)
+		c, err := Dial("udp4", addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close() //nolint:errcheck
+		req := MustBuild(TransactionID, BindingRequest)
+		res, err := c.DoContext(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var software Software
+		if err = software.GetFrom(res); err != nil || software.String() != "server" {
+			t.Errorf("unexpected response %s", res)
+		}
+		if res.TransactionID != req.TransactionID {
+			t.Error("unexpected transaction")
+		}
+	})
+	t.Run("Deadline", func(t *testing.T) {
+		c := silentClient(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, err := c.DoContext(ctx, MustBuild(TransactionID, BindingRequest)); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("unexpected error %v", err)
+		}
+		if time.Since(start) > defaultRTO {
+			t.Error("should not wait for RTO")
+		}
+		c.mux.RLock()
+		pending := len(c.t)
+		c.mux.RUnlock()
+		if pending != 0 {
+			t.Errorf("transaction should be removed, got %d", pending)
+		}
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		c := silentClient(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := c.DoContext(ctx, MustBuild(TransactionID, BindingRequest)); !errors.Is(err, context.Canceled) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("Indication", func(t *testing.T) {
+		c := silentClient(t)
+		res, err := c.DoContext(context.Background(), MustBuild(TransactionID, NewType(MethodBinding, ClassIndication)))
+		if err != nil || res != nil {
+			t.Errorf("unexpected %v, %v", res, err)
+		}
+	})
+}
+
+func TestClient_StartContext(t *testing.T) {
+	c := silentClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan Event, 2)
+	req := MustBuild(TransactionID, BindingRequest)
+	if err := c.StartContext(ctx, req, func(e Event) {
+		events <- e
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case e := <-events:
+		if !errors.Is(e.Error, context.Canceled) || e.TransactionID != req.TransactionID {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out")
+	}
+	// Handler is called exactly once.
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestContextTransaction_Fallback(t *testing.T) {
+	// Agent that can't stop transactions with error.
+	a := &TestAgent{e: make(chan Event, 1)}
+	c, err := NewClient(noopConnection{}, WithAgent(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close() //nolint:errcheck
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = c.DoContext(ctx, MustBuild(TransactionID, BindingRequest)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooManyRedirects means that request was redirected by 300 (Try
+// Alternate) responses more times than allowed.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// RedirectDialer connects to the alternate server from 300 (Try Alternate)
+// response. The domain is the ALTERNATE-DOMAIN value or empty string if
+// server did not provide it, and should be used to verify certificate of
+// alternate server when using TLS or DTLS.
+type RedirectDialer func(server AlternateServer, domain string) (Connection, error)
+
+// WithRedirects enables following of ALTERNATE-SERVER redirects.
+//
+// When server responds with 300 (Try Alternate), client connects to the
+// alternate server with dial, replacing its connection, and re-sends the
+// request there. Handler only gets the final response or
+// ErrTooManyRedirects if request was redirected more than maxRedirects
+// times. Transactions that are in progress on the previous connection
+// continue on the new one.
+//
+// RFC 8489 Section 10
+func WithRedirects(dial RedirectDialer, maxRedirects int) ClientOption {
+	return func(c *Client) {
+		c.redirectDial = dial
+		c.maxRedirects = maxRedirects
+	}
+}
+
+// redirectTransaction re-sends req to alternate servers until response
+// other than 300 (Try Alternate) is received.
+type redirectTransaction struct {
+	c     *Client
+	req   *Message
+	h     Handler
+	depth int
+}
+
+func (t *redirectTransaction) handleEvent(e Event) {
+	if e.Error != nil || e.Message == nil || e.Message.Type.Class != ClassErrorResponse {
+		t.h(e)
+		return
+	}
+	var code ErrorCodeAttribute
+	if err := code.GetFrom(e.Message); err != nil || code.Code != CodeTryAlternate {
+		t.h(e)
+		return
+	}
+	if t.depth >= t.c.maxRedirects {
+		e.Error = ErrTooManyRedirects
+		t.h(e)
+		return
+	}
+	var (
+		server AlternateServer
+		domain AlternateDomain
+	)
+	if err := server.GetFrom(e.Message); err != nil {
+		e.Error = fmt.Errorf("invalid redirect: %w", err)
+		t.h(e)
+		return
+	}
+	if err := domain.GetFrom(e.Message); err != nil && !errors.Is(err, ErrAttributeNotFound) {
+		e.Error = fmt.Errorf("invalid redirect: %w", err)
+		t.h(e)
+		return
+	}
+	t.depth++
+	// Event is processed by the read loop of connection that is being
+	// replaced, so reconnecting asynchronously.
+	server.IP = append(server.IP[:0:0], server.IP...)
+	go t.redirect(e.TransactionID, server, domain.String())
+}
+
+// redirect connects to server and re-sends request.
+func (t *redirectTransaction) redirect(id [TransactionIDSize]byte, server AlternateServer, domain string) {
+	if err := t.c.reconnect(server, domain); err != nil {
+		t.h(Event{TransactionID: id, Error: err})
+		return
+	}
+	if err := t.c.startRequest(t.req, t.handleEvent); err != nil {
+		t.h(Event{TransactionID: id, Error: err})
+	}
+}
+
+// startRedirect starts transaction for request m, following redirects.
+func (c *Client) startRedirect(m *Message, h Handler) error {
+	t := &redirectTransaction{
+		c:   c,
+		req: new(Message),
+		h:   h,
+	}
+	if err := m.CloneTo(t.req); err != nil {
+		return err
+	}
+	return c.startRequest(t.req, t.handleEvent)
+}
+
+// reconnect replaces client connection with connection to server.
+func (c *Client) reconnect(server AlternateServer, domain string) error {
+	conn, err := c.redirectDial(server, domain)
+	if err != nil {
+		return fmt.Errorf("failed to connect to alternate server %s: %w", server, err)
+	}
+	remote := remoteAddr(conn)
+	if c.framing == FramingRFC4571 {
+		conn = rfc4571Conn{Connection: conn}
+	}
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		_ = conn.Close()
+		return ErrClientClosed
+	}
+	prev, closePrev := c.c, c.closeConn
+	c.c = conn
+	c.remote = remote
+	// Connections to alternate servers are owned by client.
+	c.closeConn = true
+	close(c.replaced)
+	c.replaced = make(chan struct{})
+	replaced := c.replaced
+	c.wg.Add(1)
+	c.mux.Unlock()
+	go c.readUntilClosed(conn, replaced)
+	if closePrev {
+		// Error is irrelevant, as connection is not used anymore.
+		_ = prev.Close()
+	}
+	return nil
+}
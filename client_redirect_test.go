@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package stun
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/pion/stun/v2/stuntest"
+)
+
+// redirectResponder responds with 300 (Try Alternate) if alternate is
+// set, or with success otherwise.
+type redirectResponder struct {
+	alternate *net.UDPAddr
+	domain    string
+
+	mux      sync.Mutex
+	requests int
+}
+
+func (r *redirectResponder) handle(b []byte) ([]byte, error) {
+	req := new(Message)
+	if err := Decode(b, req); err != nil {
+		return nil, err
+	}
+	if err := Fingerprint.Check(req); err != nil {
+		return nil, err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.requests++
+	if r.alternate == nil {
+		return MustBuild(req, BindingSuccess, NewSoftware("alternate")).Raw, nil
+	}
+	setters := []Setter{
+		req, NewType(req.Type.Method, ClassErrorResponse), CodeTryAlternate,
+		&AlternateServer{IP: r.alternate.IP, Port: r.alternate.Port},
+	}
+	if r.domain != "" {
+		setters = append(setters, NewAlternateDomain(r.domain))
+	}
+	return MustBuild(setters...).Raw, nil
+}
+
+func (r *redirectResponder) setAlternate(addr *net.UDPAddr) {
+	r.mux.Lock()
+	r.alternate = addr
+	r.mux.Unlock()
+}
+
+func (r *redirectResponder) count() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.requests
+}
+
+func (r *redirectResponder) serve(t *testing.T) *net.UDPAddr {
+	t.Helper()
+	addr, closeServer, err := stuntest.NewUDPServer(t, "udp4", 1500, r.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeServer(t) })
+	return addr.(*net.UDPAddr) //nolint:forcetypeassert
+}
+
+// bind performs binding request, returning SOFTWARE from response or
+// error.
+func bind(t *testing.T, c *Client) (string, error) {
+	t.Helper()
+	var (
+		software string
+		resErr   error
+	)
+	if err := c.Do(MustBuild(TransactionID, BindingRequest, Fingerprint), func(e Event) {
+		if e.Error != nil {
+			resErr = e.Error
+			return
+		}
+		var s Software
+		if err := s.GetFrom(e.Message); err != nil {
+			resErr = err
+			return
+		}
+		software = s.String()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return software, resErr
+}
+
+func dialRedirect(t *testing.T, addr *net.UDPAddr, maxRedirects int) *Client {
+	t.Helper()
+	uri, err := ParseURI("stun:" + addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DialURI(uri, &DialConfig{MaxRedirects: maxRedirects})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := c.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return c
+}
+
+func TestClient_Redirect(t *testing.T) {
+	t.Run("Follow", func(t *testing.T) {
+		alternate := &redirectResponder{}
+		primary := &redirectResponder{alternate: alternate.serve(t)}
+		c := dialRedirect(t, primary.serve(t), 2)
+		for i := 0; i < 2; i++ {
+			software, err := bind(t, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if software != "alternate" {
+				t.Errorf("unexpected software %q", software)
+			}
+		}
+		// Client should stay on alternate server.
+		if primary.count() != 1 || alternate.count() != 2 {
+			t.Errorf("unexpected request count %d, %d", primary.count(), alternate.count())
+		}
+	})
+	t.Run("Loop", func(t *testing.T) {
+		r := &redirectResponder{}
+		addr := r.serve(t)
+		r.setAlternate(addr)
+		c := dialRedirect(t, addr, 2)
+		if _, err := bind(t, c); !errors.Is(err, ErrTooManyRedirects) {
+			t.Errorf("unexpected error %v", err)
+		}
+		if r.count() != 3 {
+			t.Errorf("unexpected request count %d", r.count())
+		}
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		alternate := &redirectResponder{}
+		primary := &redirectResponder{alternate: alternate.serve(t)}
+		c := dialRedirect(t, primary.serve(t), 0)
+		if err := c.Do(MustBuild(TransactionID, BindingRequest, Fingerprint), func(e Event) {
+			var code ErrorCodeAttribute
+			if e.Error != nil {
+				t.Error(e.Error)
+			} else if err := code.GetFrom(e.Message); err != nil || code.Code != CodeTryAlternate {
+				t.Errorf("unexpected response %s", e.Message)
+			}
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if alternate.count() != 0 {
+			t.Error("redirect should not be followed")
+		}
+	})
+	t.Run("Dialer", func(t *testing.T) {
+		alternate := &redirectResponder{}
+		primary := &redirectResponder{alternate: alternate.serve(t), domain: "example.org"}
+		errDial := errors.New("dial error")
+		var domains []string
+		conn, err := net.Dial("udp4", primary.serve(t).String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewClient(conn, WithRedirects(func(server AlternateServer, domain string) (Connection, error) {
+			domains = append(domains, domain)
+			if len(domains) > 1 {
+				return nil, errDial
+			}
+			return net.Dial("udp4", server.String())
+		}, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close() //nolint:errcheck
+		if _, err = bind(t, c); err != nil {
+			t.Fatal(err)
+		}
+		if len(domains) != 1 || domains[0] != "example.org" {
+			t.Errorf("unexpected domains %q", domains)
+		}
+		// Alternate server redirects back to primary, dial fails.
+		alternate.setAlternate(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1})
+		if _, err = bind(t, c); !errors.Is(err, errDial) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
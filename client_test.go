@@ -1002,6 +1002,69 @@ func TestClientDefaultHandler(t *testing.T) {
 	a.h(Event{})
 }
 
+func TestClientChannelDataHandler(t *testing.T) {
+	data := &ChannelData{Number: MinChannelNumber, Data: []byte("hello")}
+	data.Encode()
+	response := MustBuild(TransactionID, BindingSuccess)
+	frames := make(chan []byte, 2)
+	frames <- data.Raw
+	frames <- response.Raw
+	closed := make(chan struct{})
+	conn := &testConnection{
+		read: func(b []byte) (int, error) {
+			select {
+			case f := <-frames:
+				return copy(b, f), nil
+			case <-closed:
+				return 0, io.EOF
+			}
+		},
+		write: func(b []byte) (int, error) {
+			return len(b), nil
+		},
+		close: func() error {
+			close(closed)
+			return nil
+		},
+	}
+	received := make(chan string, 1)
+	events := make(chan Event, 1)
+	c, err := NewClient(conn,
+		WithChannelDataHandler(func(cd *ChannelData) {
+			if cd.Number != MinChannelNumber {
+				t.Errorf("unexpected number %s", cd.Number)
+			}
+			received <- string(cd.Data)
+		}),
+		WithHandler(func(e Event) {
+			events <- e
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-received:
+		if s != "hello" {
+			t.Errorf("unexpected data %q", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out")
+	}
+	// STUN messages are still processed by agent.
+	select {
+	case e := <-events:
+		if e.TransactionID != response.TransactionID {
+			t.Error("unexpected transaction")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out")
+	}
+	if err = c.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestClientClosedStart(t *testing.T) {
 	a := &TestAgent{
 		e: make(chan Event),
@@ -1505,3 +1568,148 @@ func TestClientImmediateTimeout(t *testing.T) {
 	})
 	<-gotReads
 }
+
+func TestClient_TransactionLimit(t *testing.T) {
+	agent := NewAgent(nil)
+	if err := agent.SetTransactionLimit(1); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(noopConnection{},
+		WithAgent(agent),
+		WithRTO(time.Hour),
+		WithCollector(new(manualCollector)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close() //nolint:errcheck
+	if err = c.Start(MustBuild(TransactionID, BindingRequest), func(Event) {}); err != nil {
+		t.Fatal(err)
+	}
+	m := MustBuild(TransactionID, BindingRequest)
+	var limitErr TransactionLimitError
+	if err = c.Start(m, func(Event) {}); !errors.As(err, &limitErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// Rejected transaction should be removed from client.
+	if err = agent.SetTransactionLimit(0); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Start(m, func(Event) {}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// responseAgent is TestAgent that completes transactions with res.
+type responseAgent struct {
+	TestAgent
+	res *Message
+	err error
+}
+
+func (n *responseAgent) Start(id [TransactionIDSize]byte, _ time.Time) error {
+	n.e <- Event{
+		TransactionID: id,
+		Message:       n.res,
+		Error:         n.err,
+	}
+	return nil
+}
+
+func newResponseClient(tb testing.TB, agent *responseAgent) *Client {
+	tb.Helper()
+	agent.e = make(chan Event, 1000)
+	go func() {
+		for e := range agent.e {
+			agent.h(e)
+		}
+	}()
+	c, err := NewClient(noopConnection{}, WithAgent(agent), WithNoRetransmit)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return c
+}
+
+func TestClient_DoTo(t *testing.T) {
+	agent := &responseAgent{res: MustBuild(TransactionID, BindingSuccess, NewSoftware("server"))}
+	c := newResponseClient(t, agent)
+	defer c.Close() //nolint:errcheck
+	res := AcquireMessage()
+	defer ReleaseMessage(res)
+	if err := c.DoTo(MustBuild(TransactionID, BindingRequest), res); err != nil {
+		t.Fatal(err)
+	}
+	var software Software
+	if err := software.GetFrom(res); err != nil || software.String() != "server" {
+		t.Errorf("unexpected response %s", res)
+	}
+	// Response is a copy.
+	if &res.Raw[0] == &agent.res.Raw[0] {
+		t.Error("response should be copied")
+	}
+
+	res.Reset()
+	if err := c.DoTo(MustBuild(TransactionID, NewType(MethodBinding, ClassIndication)), res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Attributes) != 0 {
+		t.Error("response should not be modified by indication")
+	}
+
+	agent.err = ErrTransactionTimeOut
+	if err := c.DoTo(MustBuild(TransactionID, BindingRequest), res); !errors.Is(err, ErrTransactionTimeOut) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestClient_UnknownAttribute(t *testing.T) {
+	agent := &responseAgent{res: MustBuild(TransactionID, BindingError,
+		CodeUnknownAttribute, UnknownAttributes{AttrChangeRequest},
+	)}
+	c := newResponseClient(t, agent)
+	defer c.Close() //nolint:errcheck
+	req := MustBuild(TransactionID, BindingRequest, ChangeRequest{ChangeIP: true})
+	var unknownErr UnknownAttributeError
+	if err := c.Do(req, func(e Event) {
+		if !errors.As(e.Error, &unknownErr) {
+			t.Errorf("unexpected error %v", e.Error)
+		}
+		if e.Message == nil {
+			t.Error("response should be set")
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(unknownErr.Attributes) != 1 || unknownErr.Attributes[0] != AttrChangeRequest {
+		t.Errorf("unexpected attributes: %s", unknownErr.Attributes)
+	}
+	res := AcquireMessage()
+	defer ReleaseMessage(res)
+	if err := c.DoTo(req, res); !errors.As(err, &unknownErr) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func BenchmarkClient_DoTo(b *testing.B) {
+	agent := &responseAgent{res: MustBuild(TransactionID, BindingSuccess, NewSoftware("server"))}
+	c := newResponseClient(b, agent)
+	defer c.Close() //nolint:errcheck
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		req := AcquireMessage()
+		res := AcquireMessage()
+		defer ReleaseMessage(req)
+		defer ReleaseMessage(res)
+		req.Type = BindingRequest
+		req.WriteHeader()
+		for pb.Next() {
+			if err := req.NewTransactionID(); err != nil {
+				b.Error(err)
+			}
+			if err := c.DoTo(req, res); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
@@ -6,30 +6,158 @@ package main
 
 import (
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/pion/stun/v2"
+	"github.com/pion/stun/v2/inspect"
+)
+
+var (
+	format   = flag.String("format", "text", "output format: text or json")
+	input    = flag.String("input", "auto", "input encoding: auto, hex, base64 or raw")
+	username = flag.String("username", "", "username of long-term credentials")
+	realm    = flag.String("realm", "", "realm of long-term credentials")
+	password = flag.String("password", "", "password to check MESSAGE-INTEGRITY, short-term unless username is set")
+	capture  = flag.String("pcap", "", "pcap or pcapng file to summarize STUN transactions of")
+)
+
+var (
+	errBadEncoding     = errors.New("neither hex nor base64 STUN message")
+	errUnknownEncoding = errors.New("unknown input encoding")
 )
 
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", "stun-decode")
+		fmt.Fprintln(os.Stderr, "stun-decode [flags] [message|file|-]...")
+		fmt.Fprintln(os.Stderr, "stun-decode [-format json] -pcap file")
 		fmt.Fprintln(os.Stderr, "stun-decode AAEAHCESpEJML0JTQWsyVXkwcmGALwAWaHR0cDovL2xvY2FsaG9zdDozMDAwLwAA")
-		fmt.Fprintln(os.Stderr, "First argument must be a base64.StdEncoding-encoded message")
+		fmt.Fprintln(os.Stderr, "Arguments are hex or base64 encoded messages, or files with raw or encoded messages.")
+		fmt.Fprintln(os.Stderr, "Message is read from stdin if there are no arguments or argument is \"-\".")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
-	data, err := base64.StdEncoding.DecodeString(flag.Arg(0))
-	if err != nil {
-		log.Fatalln("Unable to decode bas64 value:", err)
+	if *format != "text" && *format != "json" {
+		log.Fatalln("Unknown format:", *format)
+	}
+	if *capture != "" {
+		if err := writeSummary(*capture); err != nil {
+			log.Fatalln("Unable to read capture:", err)
+		}
+		return
+	}
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	var options []inspect.Option
+	switch {
+	case *username != "":
+		options = append(options, inspect.WithLongTermCredentials(*username, *realm, *password))
+	case *password != "":
+		options = append(options, inspect.WithShortTermCredentials(*password))
+	}
+	for i, arg := range args {
+		data, err := read(arg)
+		if err != nil {
+			log.Fatalln("Unable to read message:", err)
+		}
+		if data, err = decode(data, *input); err != nil {
+			log.Fatalln("Unable to decode value:", err)
+		}
+		m := new(stun.Message)
+		m.Raw = data
+		if err = m.Decode(); err != nil {
+			log.Fatalln("Unable to decode message:", err)
+		}
+		if err = write(inspect.New(m, options...), i); err != nil {
+			log.Fatalln("Unable to write message:", err)
+		}
+	}
+}
+
+// read returns contents of stdin if arg is "-", of file arg if it exists,
+// or arg itself.
+func read(arg string) ([]byte, error) {
+	if arg == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return ioutil.ReadFile(arg) //nolint:gosec
+	}
+	return []byte(arg), nil
+}
+
+// decode returns raw message from data in input encoding. In auto mode
+// data is used as is if it looks like STUN message, otherwise hex and
+// base64 are tried.
+func decode(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "raw":
+		return data, nil
+	case "hex":
+		return decodeHex(string(data))
+	case "base64":
+		return decodeBase64(string(data))
+	case "auto":
+	default:
+		return nil, fmt.Errorf("%w %q", errUnknownEncoding, encoding)
+	}
+	if stun.IsMessage(data) {
+		return data, nil
+	}
+	s := string(data)
+	if b, err := decodeHex(s); err == nil && stun.IsMessage(b) {
+		return b, nil
+	}
+	if b, err := decodeBase64(s); err == nil && stun.IsMessage(b) {
+		return b, nil
+	}
+	return nil, errBadEncoding
+}
+
+// decodeHex decodes hex string, ignoring whitespace, colons and 0x prefix
+// that are common in logs and packet dumps.
+func decodeHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', ':':
+			return -1
+		default:
+			return r
+		}
+	}, s)
+	return hex.DecodeString(s)
+}
+
+// decodeBase64 decodes padded or unpadded base64 string.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// write prints i-th message in output format.
+func write(m *inspect.Message, i int) error {
+	if *format == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.SetEscapeHTML(false)
+		return e.Encode(m)
 	}
-	m := new(stun.Message)
-	m.Raw = data
-	if err = m.Decode(); err != nil {
-		log.Fatalln("Unable to decode message:", err)
+	if i > 0 {
+		fmt.Println()
 	}
-	fmt.Println(m)
+	return m.WriteText(os.Stdout)
 }
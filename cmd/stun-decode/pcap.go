@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pion/stun/v2"
+	"github.com/pion/stun/v2/pcap"
+)
+
+// transaction is summary of STUN transaction found in capture.
+type transaction struct {
+	ID     string    `json:"id"`
+	Method string    `json:"method"`
+	Tuple  string    `json:"tuple"`
+	Start  time.Time `json:"start"`
+	// Requests is the number of requests including retransmissions, zero
+	// if only response is captured.
+	Requests   int           `json:"requests"`
+	Indication bool          `json:"indication,omitempty"`
+	Response   string        `json:"response,omitempty"`
+	RTT        time.Duration `json:"rtt,omitempty"`
+	// Mapped is XOR-MAPPED-ADDRESS of success response.
+	Mapped string `json:"mapped,omitempty"`
+
+	last time.Time // of the last request
+}
+
+func (t *transaction) String() string {
+	s := fmt.Sprintf("%s %s %s id=%s", t.Start.Format("15:04:05.000000"), t.Tuple, t.Method, t.ID)
+	switch {
+	case t.Indication:
+		return s + " indication"
+	case t.Requests == 0:
+		return s + " response without request: " + t.Response
+	case t.Requests > 1:
+		s += fmt.Sprintf(" %d requests", t.Requests)
+	}
+	if t.Response == "" {
+		return s + " no response"
+	}
+	s += fmt.Sprintf(" %s in %s", t.Response, t.RTT)
+	if t.Mapped != "" {
+		s += " mapped " + t.Mapped
+	}
+	return s
+}
+
+// captureSummary summarizes STUN traffic of capture.
+type captureSummary struct {
+	Messages     int            `json:"messages"`
+	ChannelData  int            `json:"channel_data"`
+	Transactions []*transaction `json:"transactions"`
+	Success      int            `json:"success"`
+	Errors       int            `json:"errors"`
+	Unanswered   int            `json:"unanswered"`
+}
+
+// summarize reads messages from capture and groups them into transactions.
+func summarize(r io.Reader) (*captureSummary, error) {
+	c, err := pcap.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		s    = new(captureSummary)
+		byID = make(map[[stun.TransactionIDSize]byte]*transaction)
+	)
+	for {
+		p, err := c.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.Message == nil {
+			s.ChannelData++
+			continue
+		}
+		s.Messages++
+		m := p.Message
+		t, ok := byID[m.TransactionID]
+		if !ok {
+			t = &transaction{
+				ID:     hex.EncodeToString(m.TransactionID[:]),
+				Method: m.Type.Method.String(),
+				Tuple:  p.Tuple.String(),
+				Start:  p.Time,
+			}
+			byID[m.TransactionID] = t
+			s.Transactions = append(s.Transactions, t)
+		}
+		switch m.Type.Class {
+		case stun.ClassRequest:
+			t.Requests++
+			t.last = p.Time
+		case stun.ClassIndication:
+			t.Indication = true
+		default:
+			if t.Response != "" {
+				// Response to retransmission.
+				continue
+			}
+			t.Response = response(m)
+			if t.Requests > 0 {
+				t.RTT = p.Time.Sub(t.last)
+			}
+			var mapped stun.XORMappedAddress
+			if mapped.GetFrom(m) == nil {
+				t.Mapped = mapped.String()
+			}
+		}
+	}
+	for _, t := range s.Transactions {
+		switch {
+		case t.Indication || t.Requests == 0:
+		case t.Response == "":
+			s.Unanswered++
+		case t.Response == stun.ClassSuccessResponse.String():
+			s.Success++
+		default:
+			s.Errors++
+		}
+	}
+	return s, nil
+}
+
+// response returns description of response m.
+func response(m *stun.Message) string {
+	if m.Type.Class != stun.ClassErrorResponse {
+		return m.Type.Class.String()
+	}
+	var code stun.ErrorCodeAttribute
+	if err := code.GetFrom(m); err != nil {
+		return m.Type.Class.String()
+	}
+	return fmt.Sprintf("%s %s", m.Type.Class, code)
+}
+
+// writeSummary writes summary of capture in file to stdout.
+func writeSummary(file string) error {
+	f, err := os.Open(file) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+	s, err := summarize(f)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.SetEscapeHTML(false)
+		return e.Encode(s)
+	}
+	for _, t := range s.Transactions {
+		fmt.Println(t)
+	}
+	fmt.Printf("%d messages, %d ChannelData, %d transactions: %d success, %d error, %d unanswered\n",
+		s.Messages, s.ChannelData, len(s.Transactions), s.Success, s.Errors, s.Unanswered,
+	)
+	return nil
+}
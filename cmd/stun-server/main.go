@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Command stun-server is a simple STUN server. If -other is set, it
+// serves requests in RFC 5780 NAT behavior discovery mode.
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/pion/stun/v2/server"
+)
+
+var (
+	network  = flag.String("network", "udp4", "network to listen on")                               //nolint:gochecknoglobals
+	addr     = flag.String("addr", "0.0.0.0:3478", "address to listen on")                          //nolint:gochecknoglobals
+	other    = flag.String("other", "", "alternate address for RFC 5780 mode, e.g. 192.0.2.2:3479") //nolint:gochecknoglobals
+	software = flag.String("software", "pion/stun", "SOFTWARE attribute value, empty to disable")   //nolint:gochecknoglobals
+)
+
+func main() {
+	flag.Parse()
+	s := server.New(server.WithSoftware(*software))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		sig := <-signals
+		log.Printf("Stopping on %s", sig)
+		if err := s.Close(); err != nil {
+			log.Printf("Failed to close server: %s", err)
+		}
+	}()
+
+	var err error
+	if *other == "" {
+		log.Printf("Listening on %s/%s", *addr, *network)
+		err = s.ListenAndServe(*network, *addr)
+	} else {
+		err = serveDiscovery(s)
+	}
+	if err != nil && !errors.Is(err, server.ErrServerClosed) {
+		log.Fatalf("Failed to serve: %s", err)
+	}
+}
+
+func serveDiscovery(s *server.Server) error {
+	primaryAddr, err := net.ResolveUDPAddr(*network, *addr)
+	if err != nil {
+		return err
+	}
+	otherAddr, err := net.ResolveUDPAddr(*network, *other)
+	if err != nil {
+		return err
+	}
+	d, err := server.ListenDiscovery(&server.DiscoveryConfig{
+		Network:       *network,
+		PrimaryAddr:   primaryAddr,
+		AlternateAddr: otherAddr,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Listening on %s with OTHER-ADDRESS %s", d.PrimaryAddr(), d.OtherAddr())
+	return s.ServeDiscovery(d)
+}
@@ -0,0 +1,413 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import ( //nolint:gci
+	"bytes"
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PasswordAlgorithmType is the algorithm number of PASSWORD-ALGORITHM
+// and PASSWORD-ALGORITHMS attributes.
+type PasswordAlgorithmType uint16
+
+// Password algorithms from RFC 8489.
+//
+// RFC 8489 Section 18.5
+const (
+	PasswordAlgorithmMD5    PasswordAlgorithmType = 0x0001
+	PasswordAlgorithmSHA256 PasswordAlgorithmType = 0x0002
+)
+
+func (t PasswordAlgorithmType) String() string {
+	switch t {
+	case PasswordAlgorithmMD5:
+		return "MD5"
+	case PasswordAlgorithmSHA256:
+		return "SHA-256"
+	default:
+		return fmt.Sprintf("0x%x", uint16(t))
+	}
+}
+
+// AddTo adds PASSWORD-ALGORITHM with t and no parameters to m.
+func (t PasswordAlgorithmType) AddTo(m *Message) error {
+	return PasswordAlgorithm{Type: t}.AddTo(m)
+}
+
+// ErrUnsupportedPasswordAlgorithm means that password algorithm is not
+// supported by package.
+var ErrUnsupportedPasswordAlgorithm = errors.New("unsupported password algorithm")
+
+// NewLongTermKey returns key for long-term credentials derived with
+// password algorithm t, that can be used as MessageIntegrity or
+// MessageIntegritySHA256. Username must be SASL-prepared, realm and
+// password must be processed by OpaqueString profile.
+//
+// RFC 8489 Section 9.2.2
+func NewLongTermKey(t PasswordAlgorithmType, username, realm, password string) ([]byte, error) {
+	k := strings.Join([]string{username, realm, password}, credentialsSep)
+	switch t {
+	case PasswordAlgorithmMD5:
+		h := md5.New() //nolint:gosec
+		fmt.Fprint(h, k)
+		return h.Sum(nil), nil
+	case PasswordAlgorithmSHA256:
+		h := sha256.New()
+		fmt.Fprint(h, k)
+		return h.Sum(nil), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPasswordAlgorithm, t)
+	}
+}
+
+// PasswordAlgorithm represents PASSWORD-ALGORITHM attribute, and also an
+// element of PASSWORD-ALGORITHMS.
+//
+// RFC 8489 Section 14.12
+type PasswordAlgorithm struct {
+	Type       PasswordAlgorithmType
+	Parameters []byte
+}
+
+func (a PasswordAlgorithm) String() string {
+	if len(a.Parameters) == 0 {
+		return a.Type.String()
+	}
+	return fmt.Sprintf("%s (0x%x)", a.Type, a.Parameters)
+}
+
+func (a PasswordAlgorithm) clone() PasswordAlgorithm {
+	if a.Parameters != nil {
+		a.Parameters = append([]byte(nil), a.Parameters...)
+	}
+	return a
+}
+
+// Equal returns true if a == b.
+func (a PasswordAlgorithm) Equal(b PasswordAlgorithm) bool {
+	return a.Type == b.Type && bytes.Equal(a.Parameters, b.Parameters)
+}
+
+// constants for PASSWORD-ALGORITHM encoding.
+const (
+	passwordAlgorithmHeaderSize = 4
+	passwordAlgorithmMaxParams  = 0xFFFF
+)
+
+// appendTo appends encoded algorithm to b, padding parameters if pad is true.
+func (a PasswordAlgorithm) appendTo(b []byte, pad bool) []byte {
+	var header [passwordAlgorithmHeaderSize]byte
+	bin.PutUint16(header[0:2], uint16(a.Type))
+	bin.PutUint16(header[2:4], uint16(len(a.Parameters)))
+	b = append(b, header[:]...)
+	b = append(b, a.Parameters...)
+	if pad {
+		for i := len(a.Parameters); i < nearestPaddedValueLength(len(a.Parameters)); i++ {
+			b = append(b, 0)
+		}
+	}
+	return b
+}
+
+// decode decodes algorithm from v, returning number of bytes read,
+// including padding if pad is true.
+func (a *PasswordAlgorithm) decode(v []byte, pad bool) (int, error) {
+	if len(v) < passwordAlgorithmHeaderSize {
+		return 0, io.ErrUnexpectedEOF
+	}
+	a.Type = PasswordAlgorithmType(bin.Uint16(v[0:2]))
+	n := int(bin.Uint16(v[2:4]))
+	v = v[passwordAlgorithmHeaderSize:]
+	if len(v) < n {
+		return 0, io.ErrUnexpectedEOF
+	}
+	a.Parameters = v[:n]
+	if pad {
+		n = nearestPaddedValueLength(n)
+		if len(v) < n {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	return passwordAlgorithmHeaderSize + n, nil
+}
+
+// AddTo adds PASSWORD-ALGORITHM to m.
+func (a PasswordAlgorithm) AddTo(m *Message) error {
+	if err := CheckOverflow(AttrPasswordAlgorithm, len(a.Parameters), passwordAlgorithmMaxParams); err != nil {
+		return err
+	}
+	m.Add(AttrPasswordAlgorithm, a.appendTo(make([]byte, 0, passwordAlgorithmHeaderSize+len(a.Parameters)), false))
+	return nil
+}
+
+// GetFrom decodes PASSWORD-ALGORITHM from m. Parameters are valid until
+// m.Raw is valid.
+func (a *PasswordAlgorithm) GetFrom(m *Message) error {
+	v, err := m.Get(AttrPasswordAlgorithm)
+	if err != nil {
+		return err
+	}
+	n, err := a.decode(v, false)
+	if err != nil {
+		return err
+	}
+	return CheckSize(AttrPasswordAlgorithm, len(v), n)
+}
+
+// PasswordAlgorithms represents PASSWORD-ALGORITHMS attribute, the list
+// of algorithms in order of preference.
+//
+// RFC 8489 Section 14.11
+type PasswordAlgorithms []PasswordAlgorithm
+
+func (a PasswordAlgorithms) String() string {
+	if len(a) == 0 {
+		return "<nil>"
+	}
+	s := make([]string, len(a))
+	for i, alg := range a {
+		s[i] = alg.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Equal returns true if a and b contain same algorithms in same order.
+func (a PasswordAlgorithms) Equal(b PasswordAlgorithms) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains returns true if alg is in a.
+func (a PasswordAlgorithms) Contains(alg PasswordAlgorithm) bool {
+	for _, candidate := range a {
+		if candidate.Equal(alg) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTo adds PASSWORD-ALGORITHMS to m.
+func (a PasswordAlgorithms) AddTo(m *Message) error {
+	v := make([]byte, 0, passwordAlgorithmHeaderSize*4)
+	for _, alg := range a {
+		v = alg.appendTo(v, true)
+	}
+	if err := CheckOverflow(AttrPasswordAlgorithms, len(v), passwordAlgorithmMaxParams); err != nil {
+		return err
+	}
+	m.Add(AttrPasswordAlgorithms, v)
+	return nil
+}
+
+// GetFrom decodes PASSWORD-ALGORITHMS from m. Parameters of algorithms are
+// valid until m.Raw is valid.
+func (a *PasswordAlgorithms) GetFrom(m *Message) error {
+	v, err := m.Get(AttrPasswordAlgorithms)
+	if err != nil {
+		return err
+	}
+	*a = (*a)[:0]
+	for len(v) > 0 {
+		var alg PasswordAlgorithm
+		n, err := alg.decode(v, true)
+		if err != nil {
+			return err
+		}
+		*a = append(*a, alg)
+		v = v[n:]
+	}
+	return nil
+}
+
+// Userhash represents USERHASH attribute.
+//
+// RFC 8489 Section 14.4
+type Userhash []byte
+
+// NewUserhash returns Userhash for username and realm. Username must be
+// SASL-prepared and realm must be processed by OpaqueString profile.
+func NewUserhash(username, realm string) Userhash {
+	h := sha256.Sum256([]byte(username + credentialsSep + realm))
+	return h[:]
+}
+
+func (u Userhash) String() string {
+	return fmt.Sprintf("0x%x", []byte(u))
+}
+
+const userhashSize = sha256.Size
+
+// AddTo adds USERHASH to m.
+func (u Userhash) AddTo(m *Message) error {
+	if err := CheckSize(AttrUserhash, len(u), userhashSize); err != nil {
+		return err
+	}
+	m.Add(AttrUserhash, u)
+	return nil
+}
+
+// GetFrom decodes USERHASH from m. Value is valid until m.Raw is valid.
+func (u *Userhash) GetFrom(m *Message) error {
+	v, err := m.Get(AttrUserhash)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(AttrUserhash, len(v), userhashSize); err != nil {
+		return err
+	}
+	*u = v
+	return nil
+}
+
+// SecurityFeatures is the STUN Security Feature set that server encodes
+// in NONCE.
+//
+// RFC 8489 Section 9.2
+type SecurityFeatures uint32
+
+// Security features from RFC 8489.
+//
+// RFC 8489 Section 18.1
+const (
+	FeaturePasswordAlgorithms SecurityFeatures = 1 << 23
+	FeatureUsernameAnonymity  SecurityFeatures = 1 << 22
+)
+
+// nonceCookie is the prefix of NONCE that carries security features.
+const (
+	nonceCookie         = "obMatJos2"
+	nonceFeaturesLength = 4 // base64 of 24 bits
+)
+
+// NewNonceWithFeatures returns NONCE that starts with the nonce cookie and
+// encoded features followed by nonce.
+func NewNonceWithFeatures(features SecurityFeatures, nonce string) Nonce {
+	b := []byte{byte(features >> 16), byte(features >> 8), byte(features)}
+	return Nonce(nonceCookie + base64.StdEncoding.EncodeToString(b) + nonce)
+}
+
+// SecurityFeatures returns features encoded in n and true, or false if n does
+// not start with the nonce cookie.
+func (n Nonce) SecurityFeatures() (SecurityFeatures, bool) {
+	if len(n) < len(nonceCookie)+nonceFeaturesLength || string(n[:len(nonceCookie)]) != nonceCookie {
+		return 0, false
+	}
+	var b [3]byte
+	encoded := n[len(nonceCookie) : len(nonceCookie)+nonceFeaturesLength]
+	if _, err := base64.StdEncoding.Decode(b[:], encoded); err != nil {
+		return 0, false
+	}
+	return SecurityFeatures(b[0])<<16 | SecurityFeatures(b[1])<<8 | SecurityFeatures(b[2]), true
+}
+
+// ErrPasswordAlgorithmDowngrade means that password algorithm negotiation
+// failed because attributes are inconsistent, which is a possible
+// bid-down attack.
+var ErrPasswordAlgorithmDowngrade = errors.New("password algorithm negotiation failed")
+
+// supportedPasswordAlgorithms are algorithms supported by NewLongTermKey from
+// strongest to weakest.
+//
+//nolint:gochecknoglobals
+var supportedPasswordAlgorithms = []PasswordAlgorithmType{
+	PasswordAlgorithmSHA256,
+	PasswordAlgorithmMD5,
+}
+
+// NegotiatePasswordAlgorithm runs the client side of password algorithm
+// negotiation on 401 error response res, returning the algorithm that should
+// be used to derive the key and the PASSWORD-ALGORITHMS that should be
+// added to subsequent requests together with the algorithm. Returned
+// values do not reference res.
+//
+// If server does not support negotiation, MD5 and nil are returned, and
+// no attributes should be added. Otherwise, the strongest supported
+// algorithm that the server advertises is selected.
+//
+// RFC 8489 Section 9.2.4
+func NegotiatePasswordAlgorithm(res *Message) (PasswordAlgorithm, PasswordAlgorithms, error) {
+	var (
+		nonce      Nonce
+		algorithms PasswordAlgorithms
+	)
+	if err := nonce.GetFrom(res); err != nil {
+		return PasswordAlgorithm{}, nil, err
+	}
+	features, _ := nonce.SecurityFeatures()
+	hasAlgorithms := res.Contains(AttrPasswordAlgorithms)
+	if hasAlgorithms != (features&FeaturePasswordAlgorithms != 0) {
+		return PasswordAlgorithm{}, nil, ErrPasswordAlgorithmDowngrade
+	}
+	if !hasAlgorithms {
+		return PasswordAlgorithm{Type: PasswordAlgorithmMD5}, nil, nil
+	}
+	if err := algorithms.GetFrom(res); err != nil {
+		return PasswordAlgorithm{}, nil, err
+	}
+	for _, t := range supportedPasswordAlgorithms {
+		for _, alg := range algorithms {
+			if alg.Type == t {
+				// Copying values to make them valid after res.Raw change.
+				advertised := make(PasswordAlgorithms, len(algorithms))
+				for i, a := range algorithms {
+					advertised[i] = a.clone()
+				}
+				return alg.clone(), advertised, nil
+			}
+		}
+	}
+	return PasswordAlgorithm{}, nil, fmt.Errorf("%w: %s", ErrUnsupportedPasswordAlgorithm, algorithms)
+}
+
+// CheckPasswordAlgorithm runs the server side of password algorithm
+// negotiation on request req, given the algorithms that server advertised
+// in PASSWORD-ALGORITHMS. Returns the algorithm that client used to derive
+// the key, or ErrPasswordAlgorithmDowngrade if server should respond with
+// 400 (Bad Request).
+//
+// If advertised is empty, request must not contain algorithm attributes and
+// MD5 is returned.
+//
+// RFC 8489 Section 9.2.4
+func CheckPasswordAlgorithm(req *Message, advertised PasswordAlgorithms) (PasswordAlgorithm, error) {
+	var (
+		hasAlgorithm  = req.Contains(AttrPasswordAlgorithm)
+		hasAlgorithms = req.Contains(AttrPasswordAlgorithms)
+	)
+	if len(advertised) == 0 {
+		if hasAlgorithm || hasAlgorithms {
+			return PasswordAlgorithm{}, ErrPasswordAlgorithmDowngrade
+		}
+		return PasswordAlgorithm{Type: PasswordAlgorithmMD5}, nil
+	}
+	if !hasAlgorithm || !hasAlgorithms {
+		return PasswordAlgorithm{}, ErrPasswordAlgorithmDowngrade
+	}
+	var (
+		alg        PasswordAlgorithm
+		algorithms PasswordAlgorithms
+	)
+	if err := req.Parse(&alg, &algorithms); err != nil {
+		return PasswordAlgorithm{}, err
+	}
+	if !algorithms.Equal(advertised) || !advertised.Contains(alg) {
+		return PasswordAlgorithm{}, ErrPasswordAlgorithmDowngrade
+	}
+	return alg, nil
+}
@@ -0,0 +1,288 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestNewLongTermKey(t *testing.T) {
+	for _, tc := range []struct {
+		alg PasswordAlgorithmType
+		key string
+	}{
+		{PasswordAlgorithmMD5, "8493fbc53ba582fb4c044c456bdc40eb"},
+		{PasswordAlgorithmSHA256, "07e934117abd40836e7c6329b54731b2b2d2a5f9a71f544922d75e0730d8251b"},
+	} {
+		t.Run(tc.alg.String(), func(t *testing.T) {
+			key, err := NewLongTermKey(tc.alg, "user", "realm", "pass")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(key) != tc.key {
+				t.Errorf("unexpected key %x", key)
+			}
+		})
+	}
+	if !bytes.Equal(mustLongTermKey(t, PasswordAlgorithmMD5), NewLongTermIntegrity("user", "realm", "pass")) {
+		t.Error("MD5 key should be equal to NewLongTermIntegrity")
+	}
+	if _, err := NewLongTermKey(0x10, "user", "realm", "pass"); !errors.Is(err, ErrUnsupportedPasswordAlgorithm) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func mustLongTermKey(t *testing.T, alg PasswordAlgorithmType) []byte {
+	t.Helper()
+	key, err := NewLongTermKey(alg, "user", "realm", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestPasswordAlgorithm(t *testing.T) {
+	if PasswordAlgorithmType(0x10).String() != "0x10" {
+		t.Error("bad string")
+	}
+	m := New()
+	a := PasswordAlgorithm{Type: PasswordAlgorithmSHA256, Parameters: []byte{1, 2, 3}}
+	if a.String() != "SHA-256 (0x010203)" {
+		t.Errorf("bad string %q", a)
+	}
+	if err := a.AddTo(m); err != nil {
+		t.Fatal(err)
+	}
+	v, err := m.Get(AttrPasswordAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte{0, 2, 0, 3, 1, 2, 3}) {
+		t.Errorf("unexpected value 0x%x", v)
+	}
+	var got PasswordAlgorithm
+	if err = got.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(a) {
+		t.Errorf("%s != %s", got, a)
+	}
+	t.Run("Type", func(t *testing.T) {
+		m := MustBuild(PasswordAlgorithmMD5)
+		var got PasswordAlgorithm
+		if err := got.GetFrom(m); err != nil {
+			t.Fatal(err)
+		}
+		if got.Type != PasswordAlgorithmMD5 || len(got.Parameters) != 0 {
+			t.Errorf("unexpected %s", got)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		var got PasswordAlgorithm
+		for _, v := range [][]byte{
+			{0, 1},
+			{0, 1, 0, 2, 1},
+			{0, 1, 0, 0, 1},
+		} {
+			m := New()
+			m.Add(AttrPasswordAlgorithm, v)
+			if err := got.GetFrom(m); err == nil {
+				t.Errorf("0x%x should error", v)
+			}
+		}
+		if err := got.GetFrom(New()); !errors.Is(err, ErrAttributeNotFound) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+func TestPasswordAlgorithms(t *testing.T) {
+	m := New()
+	a := PasswordAlgorithms{
+		{Type: PasswordAlgorithmSHA256},
+		{Type: 0x10, Parameters: []byte{1}},
+		{Type: PasswordAlgorithmMD5},
+	}
+	if a.String() != "SHA-256, 0x10 (0x01), MD5" {
+		t.Errorf("bad string %q", a)
+	}
+	if (PasswordAlgorithms{}).String() != "<nil>" {
+		t.Error("bad blank string")
+	}
+	if err := a.AddTo(m); err != nil {
+		t.Fatal(err)
+	}
+	v, err := m.Get(AttrPasswordAlgorithms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte{0, 2, 0, 0, 0, 0x10, 0, 1, 1, 0, 0, 0, 0, 1, 0, 0}) {
+		t.Errorf("unexpected value 0x%x", v)
+	}
+	var got PasswordAlgorithms
+	if err = got.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(a) {
+		t.Errorf("%s != %s", got, a)
+	}
+	if got.Equal(a[:2]) || got.Equal(PasswordAlgorithms{a[0], a[2], a[1]}) {
+		t.Error("should not be equal")
+	}
+	if !got.Contains(PasswordAlgorithm{Type: 0x10, Parameters: []byte{1}}) {
+		t.Error("should contain")
+	}
+	if got.Contains(PasswordAlgorithm{Type: 0x10}) {
+		t.Error("should not contain")
+	}
+	t.Run("Invalid", func(t *testing.T) {
+		for _, v := range [][]byte{
+			{0, 1, 0},
+			{0, 1, 0, 1, 1},
+		} {
+			m := New()
+			m.Add(AttrPasswordAlgorithms, v)
+			if err := got.GetFrom(m); err == nil {
+				t.Errorf("0x%x should error", v)
+			}
+		}
+	})
+}
+
+func TestUserhash(t *testing.T) {
+	u := NewUserhash("user", "realm")
+	if u.String() != "0x"+hex.EncodeToString(u) {
+		t.Error("bad string")
+	}
+	m := New()
+	if err := u.AddTo(m); err != nil {
+		t.Fatal(err)
+	}
+	var got Userhash
+	if err := got.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, u) {
+		t.Errorf("%s != %s", got, u)
+	}
+	if err := Userhash([]byte{1}).AddTo(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+	m = New()
+	m.Add(AttrUserhash, []byte{1})
+	if err := got.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestNonce_SecurityFeatures(t *testing.T) {
+	n := NewNonceWithFeatures(FeaturePasswordAlgorithms, "nonce")
+	if n.String() != "obMatJos2gAAAnonce" {
+		t.Errorf("unexpected nonce %q", n)
+	}
+	f, ok := n.SecurityFeatures()
+	if !ok || f != FeaturePasswordAlgorithms {
+		t.Errorf("unexpected features %x", f)
+	}
+	f, ok = NewNonceWithFeatures(FeaturePasswordAlgorithms|FeatureUsernameAnonymity, "").SecurityFeatures()
+	if !ok || f != FeaturePasswordAlgorithms|FeatureUsernameAnonymity {
+		t.Errorf("unexpected features %x", f)
+	}
+	for _, n := range []Nonce{
+		NewNonce("nonce"),
+		NewNonce("obMatJos2"),
+		NewNonce("obMatJos2!!!!nonce"),
+	} {
+		if _, ok := n.SecurityFeatures(); ok {
+			t.Errorf("%q should not have features", n)
+		}
+	}
+}
+
+func TestNegotiatePasswordAlgorithm(t *testing.T) {
+	unauthorized := NewType(MethodBinding, ClassErrorResponse)
+	advertised := PasswordAlgorithms{
+		{Type: PasswordAlgorithmMD5},
+		{Type: PasswordAlgorithmSHA256},
+	}
+	t.Run("Negotiated", func(t *testing.T) {
+		res := MustBuild(unauthorized, CodeUnauthorized,
+			NewNonceWithFeatures(FeaturePasswordAlgorithms, "nonce"), advertised,
+		)
+		alg, algorithms, err := NegotiatePasswordAlgorithm(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alg.Type != PasswordAlgorithmSHA256 {
+			t.Errorf("unexpected algorithm %s", alg)
+		}
+		if !algorithms.Equal(advertised) {
+			t.Errorf("unexpected algorithms %s", algorithms)
+		}
+
+		// Server should accept request with negotiated algorithm.
+		req := MustBuild(BindingRequest, alg, algorithms)
+		got, err := CheckPasswordAlgorithm(req, advertised)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(alg) {
+			t.Errorf("%s != %s", got, alg)
+		}
+	})
+	t.Run("Legacy", func(t *testing.T) {
+		res := MustBuild(unauthorized, CodeUnauthorized, NewNonce("nonce"))
+		alg, algorithms, err := NegotiatePasswordAlgorithm(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alg.Type != PasswordAlgorithmMD5 || algorithms != nil {
+			t.Errorf("unexpected %s, %s", alg, algorithms)
+		}
+		if _, err = CheckPasswordAlgorithm(MustBuild(BindingRequest), nil); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("Downgrade", func(t *testing.T) {
+		for _, res := range []*Message{
+			MustBuild(unauthorized, CodeUnauthorized, NewNonce("nonce"), advertised),
+			MustBuild(unauthorized, CodeUnauthorized, NewNonceWithFeatures(FeaturePasswordAlgorithms, "nonce")),
+		} {
+			if _, _, err := NegotiatePasswordAlgorithm(res); !errors.Is(err, ErrPasswordAlgorithmDowngrade) {
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+		for _, req := range []*Message{
+			MustBuild(BindingRequest),
+			MustBuild(BindingRequest, PasswordAlgorithmMD5),
+			MustBuild(BindingRequest, PasswordAlgorithmMD5, advertised[:1]),
+			MustBuild(BindingRequest, PasswordAlgorithm{Type: 0x10}, advertised),
+		} {
+			if _, err := CheckPasswordAlgorithm(req, advertised); !errors.Is(err, ErrPasswordAlgorithmDowngrade) {
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+		req := MustBuild(BindingRequest, PasswordAlgorithmMD5, advertised)
+		if _, err := CheckPasswordAlgorithm(req, nil); !errors.Is(err, ErrPasswordAlgorithmDowngrade) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		res := MustBuild(unauthorized, CodeUnauthorized,
+			NewNonceWithFeatures(FeaturePasswordAlgorithms, "nonce"),
+			PasswordAlgorithms{{Type: 0x10}},
+		)
+		if _, _, err := NegotiatePasswordAlgorithm(res); !errors.Is(err, ErrUnsupportedPasswordAlgorithm) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("NoNonce", func(t *testing.T) {
+		if _, _, err := NegotiatePasswordAlgorithm(MustBuild(unauthorized)); !errors.Is(err, ErrAttributeNotFound) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
@@ -4,6 +4,7 @@
 package stun
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"testing"
@@ -44,6 +45,28 @@ func FuzzMessage(f *testing.F) {
 	})
 }
 
+func FuzzChannelData(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c1 := &ChannelData{Raw: data}
+		if err := c1.Decode(); err != nil {
+			return
+		}
+		c2 := &ChannelData{
+			Number: c1.Number,
+			Data:   c1.Data,
+			Padded: c1.Padded,
+		}
+		c2.Encode()
+		c3 := &ChannelData{Raw: c2.Raw}
+		if err := c3.Decode(); err != nil {
+			t.Fatalf("Failed to decode: %s", err)
+		}
+		if c3.Number != c1.Number || !bytes.Equal(c3.Data, c1.Data) {
+			t.Fatal("ChannelData mismatch")
+		}
+	})
+}
+
 func FuzzType(f *testing.F) {
 	f.Fuzz(func(t *testing.T, data uint16) {
 		v := data & 0x1fff // First 3 bits are empty
@@ -83,11 +106,20 @@ func FuzzSetters(f *testing.F) {
 			{new(Nonce), AttrNonce},
 			{new(Software), AttrSoftware},
 			{new(AlternateServer), AttrAlternateServer},
+			{new(AlternateDomain), AttrAlternateDomain},
 			{new(ErrorCodeAttribute), AttrErrorCode},
 			{new(UnknownAttributes), AttrUnknownAttributes},
 			{new(Username), AttrUsername},
 			{new(MappedAddress), AttrMappedAddress},
 			{new(Realm), AttrRealm},
+			{new(Lifetime), AttrLifetime},
+			{new(ChannelNumber), AttrChannelNumber},
+			{new(XORPeerAddress), AttrXORPeerAddress},
+			{new(XORRelayedAddress), AttrXORRelayedAddress},
+			{new(Data), AttrData},
+			{new(RequestedTransport), AttrRequestedTransport},
+			{new(EvenPort), AttrEvenPort},
+			{new(ReservationToken), AttrReservationToken},
 		}
 		attr := attrs.pick(firstByte)
 
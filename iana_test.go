@@ -76,6 +76,8 @@ func TestIANA(t *testing.T) {
 		// Not registered in IANA.
 		for k, v := range map[string]AttrType{
 			"ORIGIN": 0x802F,
+			// Reserved, but still used by RFC 5780.
+			"CHANGE-REQUEST": 0x0003,
 		} {
 			m[k] = v
 		}
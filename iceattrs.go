@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	prioritySize   = 4 // 32 bit
+	tieBreakerSize = 8 // 64 bit
+)
+
+// Priority represents PRIORITY attribute.
+//
+// RFC 8445 Section 7.1.1
+type Priority uint32
+
+func (p Priority) String() string {
+	return fmt.Sprintf("%d", uint32(p))
+}
+
+// AddTo adds PRIORITY to message.
+func (p Priority) AddTo(m *Message) error {
+	var v [prioritySize]byte
+	bin.PutUint32(v[:], uint32(p))
+	m.Add(AttrPriority, v[:])
+	return nil
+}
+
+// GetFrom decodes PRIORITY from message.
+func (p *Priority) GetFrom(m *Message) error {
+	v, err := m.Get(AttrPriority)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(AttrPriority, len(v), prioritySize); err != nil {
+		return err
+	}
+	*p = Priority(bin.Uint32(v))
+	return nil
+}
+
+// UseCandidateAttr represents USE-CANDIDATE attribute.
+//
+// RFC 8445 Section 7.1.2
+type UseCandidateAttr struct{}
+
+// UseCandidate is shorthand for UseCandidateAttr.
+var UseCandidate UseCandidateAttr //nolint:gochecknoglobals
+
+func (UseCandidateAttr) String() string {
+	return "USE-CANDIDATE"
+}
+
+// AddTo adds USE-CANDIDATE to message.
+func (UseCandidateAttr) AddTo(m *Message) error {
+	m.Add(AttrUseCandidate, nil)
+	return nil
+}
+
+// GetFrom returns nil if message contains valid USE-CANDIDATE
+// attribute.
+func (UseCandidateAttr) GetFrom(m *Message) error {
+	v, err := m.Get(AttrUseCandidate)
+	if err != nil {
+		return err
+	}
+	return CheckSize(AttrUseCandidate, len(v), 0)
+}
+
+// IsSet returns true if USE-CANDIDATE attribute is set.
+func (UseCandidateAttr) IsSet(m *Message) bool {
+	return m.Contains(AttrUseCandidate)
+}
+
+// iceTieBreaker is common implementation for ICE-CONTROLLING and
+// ICE-CONTROLLED attributes.
+type iceTieBreaker uint64
+
+func (a iceTieBreaker) AddToAs(m *Message, t AttrType) error {
+	var v [tieBreakerSize]byte
+	bin.PutUint64(v[:], uint64(a))
+	m.Add(t, v[:])
+	return nil
+}
+
+func (a *iceTieBreaker) GetFromAs(m *Message, t AttrType) error {
+	v, err := m.Get(t)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(t, len(v), tieBreakerSize); err != nil {
+		return err
+	}
+	*a = iceTieBreaker(bin.Uint64(v))
+	return nil
+}
+
+// ICEControlling represents ICE-CONTROLLING attribute, the value is
+// the tie-breaker of the controlling agent.
+//
+// RFC 8445 Section 7.1.3
+type ICEControlling uint64
+
+func (c ICEControlling) String() string {
+	return fmt.Sprintf("controlling: %d", uint64(c))
+}
+
+// AddTo adds ICE-CONTROLLING to message.
+func (c ICEControlling) AddTo(m *Message) error {
+	return iceTieBreaker(c).AddToAs(m, AttrICEControlling)
+}
+
+// GetFrom decodes ICE-CONTROLLING from message.
+func (c *ICEControlling) GetFrom(m *Message) error {
+	return (*iceTieBreaker)(c).GetFromAs(m, AttrICEControlling)
+}
+
+// ICEControlled represents ICE-CONTROLLED attribute, the value is
+// the tie-breaker of the controlled agent.
+//
+// RFC 8445 Section 7.1.3
+type ICEControlled uint64
+
+func (c ICEControlled) String() string {
+	return fmt.Sprintf("controlled: %d", uint64(c))
+}
+
+// AddTo adds ICE-CONTROLLED to message.
+func (c ICEControlled) AddTo(m *Message) error {
+	return iceTieBreaker(c).AddToAs(m, AttrICEControlled)
+}
+
+// GetFrom decodes ICE-CONTROLLED from message.
+func (c *ICEControlled) GetFrom(m *Message) error {
+	return (*iceTieBreaker)(c).GetFromAs(m, AttrICEControlled)
+}
+
+// ICERole is the role of ICE agent.
+type ICERole byte
+
+// Possible ICE agent roles.
+const (
+	ICERoleControlling ICERole = iota + 1
+	ICERoleControlled
+)
+
+func (r ICERole) String() string {
+	switch r {
+	case ICERoleControlling:
+		return "controlling"
+	case ICERoleControlled:
+		return "controlled"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrRoleConflict means that agent should keep its role and respond to the
+// request with 487 (Role Conflict) error, see NewRoleConflictResponse.
+var ErrRoleConflict = errors.New("role conflict")
+
+// ErrUnknownICERole means that ICE role is not one of ICERoleControlling or
+// ICERoleControlled.
+var ErrUnknownICERole = errors.New("unknown ICE role")
+
+// ResolveRoleConflict checks Binding request req for the role conflict with
+// the agent that has role and tieBreaker, returning the role that agent
+// should continue with. If agent keeps its role and the request should be
+// rejected, ErrRoleConflict is returned.
+//
+// RFC 8445 Section 7.3.1.1
+func ResolveRoleConflict(req *Message, role ICERole, tieBreaker uint64) (ICERole, error) {
+	switch role {
+	case ICERoleControlling:
+		if !req.Contains(AttrICEControlling) {
+			return role, nil
+		}
+		var remote ICEControlling
+		if err := remote.GetFrom(req); err != nil {
+			return role, err
+		}
+		if tieBreaker >= uint64(remote) {
+			return role, ErrRoleConflict
+		}
+		return ICERoleControlled, nil
+	case ICERoleControlled:
+		if !req.Contains(AttrICEControlled) {
+			return role, nil
+		}
+		var remote ICEControlled
+		if err := remote.GetFrom(req); err != nil {
+			return role, err
+		}
+		if tieBreaker >= uint64(remote) {
+			return ICERoleControlling, nil
+		}
+		return role, ErrRoleConflict
+	default:
+		return role, ErrUnknownICERole
+	}
+}
+
+// NewRoleConflictResponse builds 487 (Role Conflict) error response to
+// request req, applying setters after ERROR-CODE. Use them to add
+// MESSAGE-INTEGRITY and FINGERPRINT.
+func NewRoleConflictResponse(req *Message, setters ...Setter) (*Message, error) {
+	res := New()
+	if err := res.Build(req, NewType(req.Type.Method, ClassErrorResponse), CodeRoleConflict); err != nil {
+		return nil, err
+	}
+	for _, s := range setters {
+		if err := s.AddTo(res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPriority(t *testing.T) {
+	m := MustBuild(Priority(0x6e0001ff))
+	v, err := m.Get(AttrPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 4 || v[0] != 0x6e || v[3] != 0xff {
+		t.Errorf("unexpected value 0x%x", v)
+	}
+	var p Priority
+	if err = p.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if p != 0x6e0001ff {
+		t.Errorf("unexpected priority %s", p)
+	}
+	m = New()
+	m.Add(AttrPriority, []byte{1, 2, 3})
+	if err = p.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = p.GetFrom(New()); !errors.Is(err, ErrAttributeNotFound) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestUseCandidate(t *testing.T) {
+	m := New()
+	if UseCandidate.IsSet(m) {
+		t.Error("should not be set")
+	}
+	if err := UseCandidate.GetFrom(m); !errors.Is(err, ErrAttributeNotFound) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := m.Build(UseCandidate); err != nil {
+		t.Fatal(err)
+	}
+	if !UseCandidate.IsSet(m) {
+		t.Error("should be set")
+	}
+	if err := UseCandidate.GetFrom(m); err != nil {
+		t.Error(err)
+	}
+	m = New()
+	m.Add(AttrUseCandidate, []byte{1})
+	if err := UseCandidate.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestICEControl(t *testing.T) {
+	m := MustBuild(ICEControlling(4321), ICEControlled(1234))
+	var (
+		controlling ICEControlling
+		controlled  ICEControlled
+	)
+	if err := m.Parse(&controlling, &controlled); err != nil {
+		t.Fatal(err)
+	}
+	if controlling != 4321 || controlled != 1234 {
+		t.Errorf("unexpected %s, %s", controlling, controlled)
+	}
+	m = New()
+	m.Add(AttrICEControlling, []byte{1, 2, 3, 4})
+	m.Add(AttrICEControlled, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9})
+	if err := controlling.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := controlled.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestResolveRoleConflict(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		req    Setter
+		role   ICERole
+		tie    uint64
+		result ICERole
+		err    error
+	}{
+		{"ControllingNoConflict", ICEControlled(10), ICERoleControlling, 5, ICERoleControlling, nil},
+		{"ControllingWins", ICEControlling(10), ICERoleControlling, 10, ICERoleControlling, ErrRoleConflict},
+		{"ControllingLoses", ICEControlling(10), ICERoleControlling, 5, ICERoleControlled, nil},
+		{"ControlledNoConflict", ICEControlling(10), ICERoleControlled, 5, ICERoleControlled, nil},
+		{"ControlledWins", ICEControlled(10), ICERoleControlled, 10, ICERoleControlling, nil},
+		{"ControlledLoses", ICEControlled(10), ICERoleControlled, 5, ICERoleControlled, ErrRoleConflict},
+		{"Unknown", ICEControlled(10), 0, 5, 0, ErrUnknownICERole},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := MustBuild(TransactionID, BindingRequest, tc.req)
+			role, err := ResolveRoleConflict(req, tc.role, tc.tie)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error %v", err)
+			}
+			if role != tc.result {
+				t.Errorf("unexpected role %s", role)
+			}
+		})
+	}
+	t.Run("Invalid", func(t *testing.T) {
+		req := MustBuild(TransactionID, BindingRequest)
+		req.Add(AttrICEControlling, []byte{1})
+		if _, err := ResolveRoleConflict(req, ICERoleControlling, 1); !IsAttrSizeInvalid(err) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+func TestNewRoleConflictResponse(t *testing.T) {
+	req := MustBuild(TransactionID, BindingRequest, ICEControlling(1))
+	integrity := NewShortTermIntegrity("pwd")
+	res, err := NewRoleConflictResponse(req, integrity, Fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != NewType(MethodBinding, ClassErrorResponse) || res.TransactionID != req.TransactionID {
+		t.Errorf("unexpected response %s", res)
+	}
+	var code ErrorCodeAttribute
+	if err = code.GetFrom(res); err != nil {
+		t.Fatal(err)
+	}
+	if code.Code != CodeRoleConflict {
+		t.Errorf("unexpected code %d", code.Code)
+	}
+	decoded := new(Message)
+	if err = Decode(res.Raw, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err = decoded.Check(integrity, Fingerprint); err != nil {
+		t.Error(err)
+	}
+	if _, err = NewRoleConflictResponse(req, ErrorCode(0)); err == nil {
+		t.Error("should error")
+	}
+}
+
+func BenchmarkICEControlling(b *testing.B) {
+	m := New()
+	c := ICEControlling(1234)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m.Reset()
+		if err := c.AddTo(m); err != nil {
+			b.Fatal(err)
+		}
+		if err := c.GetFrom(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package inspect renders decoded STUN messages for humans and tools,
+// decoding every known attribute with its typed getter.
+package inspect
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pion/stun/v2"
+)
+
+// Message is a STUN message with decoded attributes. It can be rendered
+// as indented text by WriteText and String, or as JSON by encoding/json.
+type Message struct {
+	Type          string      `json:"type"`
+	Length        uint32      `json:"length"`
+	TransactionID string      `json:"transaction_id"`
+	Attributes    []Attribute `json:"attributes"`
+}
+
+// Attribute is a decoded attribute of Message.
+type Attribute struct {
+	// Name is the attribute name or hex representation of type if it is
+	// unknown.
+	Name   string `json:"name"`
+	Type   uint16 `json:"type"`
+	Length int    `json:"length"`
+	// Value is decoded attribute value, empty if attribute is unknown or
+	// failed to decode.
+	Value string `json:"value,omitempty"`
+	// Raw is hex representation of the attribute value.
+	Raw string `json:"raw"`
+	// Valid is the result of MESSAGE-INTEGRITY, MESSAGE-INTEGRITY-SHA256
+	// or FINGERPRINT check, nil if check was not performed.
+	Valid *bool `json:"valid,omitempty"`
+	// Error is the decoding or check error.
+	Error string `json:"error,omitempty"`
+}
+
+// Option sets some inspection option.
+type Option func(i *inspector)
+
+// WithShortTermCredentials sets password that is used to check integrity
+// attributes. Password must be SASL-prepared.
+func WithShortTermCredentials(password string) Option {
+	return func(i *inspector) {
+		i.password = password
+		i.longTerm = false
+	}
+}
+
+// WithLongTermCredentials sets long-term credentials that are used to
+// check integrity attributes. The key is derived with PASSWORD-ALGORITHM
+// of message, MD5 by default.
+func WithLongTermCredentials(username, realm, password string) Option {
+	return func(i *inspector) {
+		i.username = username
+		i.realm = realm
+		i.password = password
+		i.longTerm = true
+	}
+}
+
+type inspector struct {
+	username string
+	realm    string
+	password string
+	longTerm bool
+}
+
+// New decodes attributes of m. Integrity attributes are only checked if
+// credentials are provided, while FINGERPRINT is always checked.
+func New(m *stun.Message, options ...Option) *Message {
+	var i inspector
+	for _, o := range options {
+		o(&i)
+	}
+	res := &Message{
+		Type:          m.Type.String(),
+		Length:        m.Length,
+		TransactionID: hex.EncodeToString(m.TransactionID[:]),
+		Attributes:    make([]Attribute, 0, len(m.Attributes)),
+	}
+	for _, a := range m.Attributes {
+		res.Attributes = append(res.Attributes, i.attribute(m, a))
+	}
+	return res
+}
+
+// getter is attribute that can be decoded and printed.
+type getter interface {
+	stun.Getter
+	fmt.Stringer
+}
+
+// newGetter returns getter for attributes of type t or nil if t is unknown.
+func newGetter(t stun.AttrType) getter { //nolint:gocyclo,cyclop
+	switch t {
+	case stun.AttrMappedAddress:
+		return new(stun.MappedAddress)
+	case stun.AttrXORMappedAddress:
+		return new(stun.XORMappedAddress)
+	case stun.AttrAlternateServer:
+		return new(stun.AlternateServer)
+	case stun.AttrOtherAddress:
+		return new(stun.OtherAddress)
+	case stun.AttrResponseOrigin:
+		return new(stun.ResponseOrigin)
+	case stun.AttrErrorCode:
+		return new(stun.ErrorCodeAttribute)
+	case stun.AttrUnknownAttributes:
+		return new(stun.UnknownAttributes)
+	case stun.AttrUsername:
+		return new(stun.Username)
+	case stun.AttrRealm:
+		return new(stun.Realm)
+	case stun.AttrNonce:
+		return new(stun.Nonce)
+	case stun.AttrSoftware:
+		return new(stun.Software)
+	case stun.AttrAlternateDomain:
+		return new(stun.AlternateDomain)
+	case stun.AttrUserhash:
+		return new(stun.Userhash)
+	case stun.AttrPasswordAlgorithm:
+		return new(stun.PasswordAlgorithm)
+	case stun.AttrPasswordAlgorithms:
+		return new(stun.PasswordAlgorithms)
+	case stun.AttrPriority:
+		return new(stun.Priority)
+	case stun.AttrUseCandidate:
+		return new(stun.UseCandidateAttr)
+	case stun.AttrICEControlled:
+		return new(stun.ICEControlled)
+	case stun.AttrICEControlling:
+		return new(stun.ICEControlling)
+	case stun.AttrChangeRequest:
+		return new(stun.ChangeRequest)
+	case stun.AttrResponsePort:
+		return new(stun.ResponsePort)
+	case stun.AttrLifetime:
+		return new(stun.Lifetime)
+	case stun.AttrChannelNumber:
+		return new(stun.ChannelNumber)
+	case stun.AttrXORPeerAddress:
+		return new(stun.XORPeerAddress)
+	case stun.AttrXORRelayedAddress:
+		return new(stun.XORRelayedAddress)
+	case stun.AttrData:
+		return new(stun.Data)
+	case stun.AttrRequestedTransport:
+		return new(stun.RequestedTransport)
+	case stun.AttrEvenPort:
+		return new(stun.EvenPort)
+	case stun.AttrReservationToken:
+		return new(stun.ReservationToken)
+	case stun.AttrDontFragment:
+		return new(stun.DontFragmentAttr)
+	default:
+		return nil
+	}
+}
+
+func (i *inspector) attribute(m *stun.Message, a stun.RawAttribute) Attribute {
+	res := Attribute{
+		Name:   a.Type.String(),
+		Type:   a.Type.Value(),
+		Length: len(a.Value),
+		Raw:    hex.EncodeToString(a.Value),
+	}
+	switch a.Type {
+	case stun.AttrFingerprint:
+		res.Value = "0x" + res.Raw
+		res.setCheck(stun.Fingerprint.Check(m))
+		return res
+	case stun.AttrMessageIntegrity:
+		res.Value = "0x" + res.Raw
+		if key, err := i.key(m); err != nil {
+			res.Error = err.Error()
+		} else if key != nil {
+			res.setCheck(stun.MessageIntegrity(key).Check(m))
+		}
+		return res
+	case stun.AttrMessageIntegritySHA256:
+		res.Value = "0x" + res.Raw
+		if key, err := i.key(m); err != nil {
+			res.Error = err.Error()
+		} else if key != nil {
+			res.setCheck(stun.MessageIntegritySHA256(key).Check(m))
+		}
+		return res
+	}
+	g := newGetter(a.Type)
+	if g == nil {
+		return res
+	}
+	// Decoding exactly a, because m can contain multiple attributes
+	// of same type, e.g. XOR-PEER-ADDRESS in CreatePermission request.
+	single := &stun.Message{
+		TransactionID: m.TransactionID,
+		Attributes:    stun.Attributes{a},
+	}
+	if err := g.GetFrom(single); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Value = g.String()
+	return res
+}
+
+// key returns key to check integrity of m, or nil if credentials are not
+// provided.
+func (i *inspector) key(m *stun.Message) ([]byte, error) {
+	if !i.longTerm {
+		if i.password == "" {
+			return nil, nil
+		}
+		return []byte(i.password), nil
+	}
+	algorithm := stun.PasswordAlgorithm{Type: stun.PasswordAlgorithmMD5}
+	if err := algorithm.GetFrom(m); err != nil && !errors.Is(err, stun.ErrAttributeNotFound) {
+		return nil, err
+	}
+	return stun.NewLongTermKey(algorithm.Type, i.username, i.realm, i.password)
+}
+
+func (a *Attribute) setCheck(err error) {
+	valid := err == nil
+	a.Valid = &valid
+	if err != nil {
+		a.Error = err.Error()
+	}
+}
+
+// WriteText writes m as indented text, one attribute per line.
+func (m *Message) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%s l=%d id=%s\n", m.Type, m.Length, m.TransactionID); err != nil {
+		return err
+	}
+	for _, a := range m.Attributes {
+		if _, err := fmt.Fprintf(w, "  %s\n", a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Message) String() string {
+	var b strings.Builder
+	_ = m.WriteText(&b) // Writing to strings.Builder never fails.
+	return b.String()
+}
+
+func (a Attribute) String() string {
+	s := a.Name + ": "
+	switch {
+	case a.Value != "":
+		s += a.Value
+	case a.Length > 0:
+		s += "0x" + a.Raw
+	default:
+		s += "<empty>"
+	}
+	switch {
+	case a.Valid != nil && *a.Valid:
+		s += " (valid)"
+	case a.Valid != nil:
+		s += " (invalid: " + a.Error + ")"
+	case a.Error != "":
+		s += " (error: " + a.Error + ")"
+	}
+	return s
+}
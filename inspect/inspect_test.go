@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package inspect
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pion/stun/v2"
+)
+
+func decoded(t *testing.T, m *stun.Message) *stun.Message {
+	t.Helper()
+	res := new(stun.Message)
+	if err := stun.Decode(m.Raw, res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestNew(t *testing.T) {
+	m := decoded(t, stun.MustBuild(stun.TransactionID, stun.BindingSuccess,
+		&stun.XORMappedAddress{IP: net.IPv4(192, 0, 2, 1), Port: 32853},
+		stun.NewSoftware("test"),
+		&stun.XORPeerAddress{IP: net.IPv4(192, 0, 2, 2), Port: 1},
+		&stun.XORPeerAddress{IP: net.IPv4(192, 0, 2, 3), Port: 2},
+		stun.RawAttribute{Type: 0x7001, Value: []byte{1, 2}},
+		stun.RawAttribute{Type: stun.AttrErrorCode, Value: []byte{1}},
+		stun.NewShortTermIntegrity("pwd"),
+		stun.Fingerprint,
+	))
+	for _, tc := range []struct {
+		name    string
+		options []Option
+		valid   *bool
+		text    string
+	}{
+		{"NoCredentials", nil, nil, "MESSAGE-INTEGRITY: 0x"},
+		{"Valid", []Option{WithShortTermCredentials("pwd")}, newBool(true), " (valid)"},
+		{"Invalid", []Option{WithShortTermCredentials("bad")}, newBool(false), " (invalid: "},
+		{"LongTerm", []Option{WithLongTermCredentials("user", "realm", "pwd")}, newBool(false), " (invalid: "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := New(m, tc.options...)
+			if res.Type != "Binding success response" || res.Length != m.Length || len(res.Attributes) != 8 {
+				t.Fatalf("unexpected message %+v", res)
+			}
+			for i, expected := range []string{
+				"XOR-MAPPED-ADDRESS: 192.0.2.1:32853",
+				"SOFTWARE: test",
+				"XOR-PEER-ADDRESS: 192.0.2.2:1",
+				"XOR-PEER-ADDRESS: 192.0.2.3:2",
+				"0x7001: 0x0102",
+				"ERROR-CODE: 0x01 (error: ",
+			} {
+				if s := res.Attributes[i].String(); !strings.HasPrefix(s, expected) {
+					t.Errorf("%q does not start with %q", s, expected)
+				}
+			}
+			integrity := res.Attributes[6]
+			if (integrity.Valid == nil) != (tc.valid == nil) || (tc.valid != nil && *integrity.Valid != *tc.valid) {
+				t.Errorf("unexpected integrity %+v", integrity)
+			}
+			if !strings.Contains(integrity.String(), tc.text) {
+				t.Errorf("%q does not contain %q", integrity, tc.text)
+			}
+			if fingerprint := res.Attributes[7]; fingerprint.Valid == nil || !*fingerprint.Valid {
+				t.Errorf("unexpected fingerprint %+v", fingerprint)
+			}
+		})
+	}
+}
+
+func TestNew_LongTerm(t *testing.T) {
+	key, err := stun.NewLongTermKey(stun.PasswordAlgorithmSHA256, "user", "realm", "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := decoded(t, stun.MustBuild(stun.TransactionID, stun.BindingRequest,
+		stun.PasswordAlgorithm{Type: stun.PasswordAlgorithmSHA256},
+		stun.MessageIntegritySHA256(key),
+	))
+	res := New(m, WithLongTermCredentials("user", "realm", "pwd"))
+	if a := res.Attributes[1]; a.Valid == nil || !*a.Valid {
+		t.Errorf("unexpected integrity %+v", a)
+	}
+	m = decoded(t, stun.MustBuild(stun.TransactionID, stun.BindingRequest,
+		stun.PasswordAlgorithm{Type: 0x1000},
+		stun.MessageIntegritySHA256(key),
+	))
+	res = New(m, WithLongTermCredentials("user", "realm", "pwd"))
+	if a := res.Attributes[1]; a.Valid != nil || a.Error == "" {
+		t.Errorf("unexpected integrity %+v", a)
+	}
+}
+
+func TestMessage_JSON(t *testing.T) {
+	m := decoded(t, stun.MustBuild(stun.TransactionID, stun.BindingRequest,
+		stun.NewUsername("user"),
+		stun.Fingerprint,
+	))
+	b, err := json.Marshal(New(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res Message
+	if err = json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Attributes) != 2 {
+		t.Fatalf("unexpected attributes %+v", res.Attributes)
+	}
+	username := res.Attributes[0]
+	if username.Name != "USERNAME" || username.Type != 0x0006 || username.Value != "user" || username.Raw != "75736572" {
+		t.Errorf("unexpected username %+v", username)
+	}
+	if !strings.Contains(string(b), `"valid":true`) {
+		t.Errorf("unexpected JSON %s", b)
+	}
+}
+
+func TestMessage_String(t *testing.T) {
+	m := decoded(t, stun.MustBuild(stun.TransactionID, stun.BindingRequest,
+		stun.UseCandidate,
+	))
+	lines := strings.Split(New(m).String(), "\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "Binding request l=4 id=") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if lines[1] != "  USE-CANDIDATE: USE-CANDIDATE" {
+		t.Errorf("unexpected attribute %q", lines[1])
+	}
+}
+
+func newBool(v bool) *bool {
+	return &v
+}
@@ -6,6 +6,7 @@ package stun
 import ( //nolint:gci
 	"crypto/md5"  //nolint:gosec
 	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"strings"
@@ -56,6 +57,11 @@ const messageIntegritySize = 20
 // message, so MESSAGE-INTEGRITY attribute cannot be added.
 var ErrFingerprintBeforeIntegrity = errors.New("FINGERPRINT before MESSAGE-INTEGRITY attribute")
 
+// ErrIntegritySHA256BeforeIntegrity means that MESSAGE-INTEGRITY-SHA256
+// attribute is already in message, so MESSAGE-INTEGRITY attribute cannot
+// be added.
+var ErrIntegritySHA256BeforeIntegrity = errors.New("MESSAGE-INTEGRITY-SHA256 before MESSAGE-INTEGRITY attribute")
+
 // AddTo adds MESSAGE-INTEGRITY attribute to message.
 //
 // CPU costly, see BenchmarkMessageIntegrity_AddTo.
@@ -66,6 +72,10 @@ func (i MessageIntegrity) AddTo(m *Message) error {
 		if a.Type == AttrFingerprint {
 			return ErrFingerprintBeforeIntegrity
 		}
+		// MESSAGE-INTEGRITY-SHA256 should follow MESSAGE-INTEGRITY.
+		if a.Type == AttrMessageIntegritySHA256 {
+			return ErrIntegritySHA256BeforeIntegrity
+		}
 	}
 	// The text used as input to HMAC is the STUN message,
 	// including the header, up to and including the attribute preceding the
@@ -89,6 +99,25 @@ func (i MessageIntegrity) AddTo(m *Message) error {
 // ErrIntegrityMismatch means that computed HMAC differs from expected.
 var ErrIntegrityMismatch = errors.New("integrity check failed")
 
+// sizeAfter returns the size of all attributes that follow the first
+// attribute of type t in m.
+func sizeAfter(m *Message, t AttrType) int {
+	var (
+		after bool
+		size  int
+	)
+	for _, a := range m.Attributes {
+		if after {
+			size += nearestPaddedValueLength(int(a.Length))
+			size += attributeHeaderSize
+		}
+		if a.Type == t {
+			after = true
+		}
+	}
+	return size
+}
+
 // Check checks MESSAGE-INTEGRITY attribute.
 //
 // CPU costly, see BenchmarkMessageIntegrity_Check.
@@ -100,27 +129,131 @@ func (i MessageIntegrity) Check(m *Message) error {
 
 	// Adjusting length in header to match m.Raw that was
 	// used when computing HMAC.
-	var (
-		length         = m.Length
-		afterIntegrity = false
-		sizeReduced    int
-	)
+	length := m.Length
+	m.Length -= uint32(sizeAfter(m, AttrMessageIntegrity))
+	m.WriteLength()
+	// startOfHMAC should be first byte of integrity attribute.
+	startOfHMAC := messageHeaderSize + m.Length - (attributeHeaderSize + messageIntegritySize)
+	b := m.Raw[:startOfHMAC] // data before integrity attribute
+	expected := newHMAC(i, b, m.Raw[len(m.Raw):])
+	m.Length = length
+	m.WriteLength() // writing length back
+	return checkHMAC(v, expected)
+}
+
+// NewShortTermIntegritySHA256 returns new MessageIntegritySHA256 with key for
+// short-term credentials. Password must be processed by OpaqueString profile.
+func NewShortTermIntegritySHA256(password string) MessageIntegritySHA256 {
+	return MessageIntegritySHA256(password)
+}
+
+// MessageIntegritySHA256 represents MESSAGE-INTEGRITY-SHA256 attribute,
+// the value is the HMAC key.
+//
+// AddTo and Check methods are using pooled HMAC-SHA256 instances, see
+// internal/hmac/pool.go.
+//
+// RFC 8489 Section 14.6
+type MessageIntegritySHA256 []byte
+
+func newHMACSHA256(key, message, buf []byte) []byte {
+	mac := hmac.AcquireSHA256(key)
+	writeOrPanic(mac, message)
+	defer hmac.PutSHA256(mac)
+	return mac.Sum(buf)
+}
+
+func (i MessageIntegritySHA256) String() string {
+	return fmt.Sprintf("KEY: 0x%x", []byte(i))
+}
+
+// Bounds for MESSAGE-INTEGRITY-SHA256 value size.
+const (
+	messageIntegritySHA256MinSize = 16
+	messageIntegritySHA256Size    = sha256.Size
+)
+
+// ErrIntegritySHA256Size means that MESSAGE-INTEGRITY-SHA256 value size is
+// not a multiple of 4 in range from 16 to 32 bytes.
+var ErrIntegritySHA256Size = errors.New("invalid MESSAGE-INTEGRITY-SHA256 size")
+
+// ErrIntegrityExists means that message already contains integrity
+// attribute of the same type.
+var ErrIntegrityExists = errors.New("integrity attribute already exists")
+
+func checkIntegritySHA256Size(size int) error {
+	if size < messageIntegritySHA256MinSize || size > messageIntegritySHA256Size || size%padding != 0 {
+		return ErrIntegritySHA256Size
+	}
+	return nil
+}
+
+// AddTo adds MESSAGE-INTEGRITY-SHA256 attribute with full 32-byte HMAC
+// value to message.
+//
+// CPU costly, see BenchmarkMessageIntegritySHA256_AddTo.
+func (i MessageIntegritySHA256) AddTo(m *Message) error {
+	return i.AddToTruncated(m, messageIntegritySHA256Size)
+}
+
+// AddToTruncated adds MESSAGE-INTEGRITY-SHA256 attribute to message with HMAC
+// value truncated to size bytes, which must be a multiple of 4 in range
+// from 16 to 32.
+func (i MessageIntegritySHA256) AddToTruncated(m *Message, size int) error {
+	if err := checkIntegritySHA256Size(size); err != nil {
+		return err
+	}
 	for _, a := range m.Attributes {
-		if afterIntegrity {
-			sizeReduced += nearestPaddedValueLength(int(a.Length))
-			sizeReduced += attributeHeaderSize
+		// Message should not contain FINGERPRINT attribute
+		// before MESSAGE-INTEGRITY-SHA256.
+		if a.Type == AttrFingerprint {
+			return ErrFingerprintBeforeIntegrity
 		}
-		if a.Type == AttrMessageIntegrity {
-			afterIntegrity = true
+		if a.Type == AttrMessageIntegritySHA256 {
+			return ErrIntegrityExists
 		}
 	}
-	m.Length -= uint32(sizeReduced)
+	// The text used as input to HMAC is the STUN message, up to and
+	// including the attribute preceding the MESSAGE-INTEGRITY-SHA256
+	// attribute, with length adjusted to include it.
+	length := m.Length
+	m.Length += uint32(size + attributeHeaderSize)
+	m.WriteLength()
+	v := newHMACSHA256(i, m.Raw, m.Raw[len(m.Raw):])
+	m.Length = length
+
+	// Copy hmac value to temporary variable to protect it from resetting
+	// while processing m.Add call.
+	vBuf := make([]byte, sha256.Size)
+	copy(vBuf, v)
+
+	m.Add(AttrMessageIntegritySHA256, vBuf[:size])
+	return nil
+}
+
+// Check checks MESSAGE-INTEGRITY-SHA256 attribute, accepting any valid
+// truncated value.
+//
+// CPU costly, see BenchmarkMessageIntegritySHA256_Check.
+func (i MessageIntegritySHA256) Check(m *Message) error {
+	v, err := m.Get(AttrMessageIntegritySHA256)
+	if err != nil {
+		return err
+	}
+	if err = checkIntegritySHA256Size(len(v)); err != nil {
+		return err
+	}
+
+	// Adjusting length in header to match m.Raw that was
+	// used when computing HMAC.
+	length := m.Length
+	m.Length -= uint32(sizeAfter(m, AttrMessageIntegritySHA256))
 	m.WriteLength()
 	// startOfHMAC should be first byte of integrity attribute.
-	startOfHMAC := messageHeaderSize + m.Length - (attributeHeaderSize + messageIntegritySize)
+	startOfHMAC := messageHeaderSize + m.Length - uint32(attributeHeaderSize+len(v))
 	b := m.Raw[:startOfHMAC] // data before integrity attribute
-	expected := newHMAC(i, b, m.Raw[len(m.Raw):])
+	expected := newHMACSHA256(i, b, m.Raw[len(m.Raw):])
 	m.Length = length
 	m.WriteLength() // writing length back
-	return checkHMAC(v, expected)
+	return checkHMAC(v, expected[:len(v)])
 }
@@ -5,7 +5,10 @@ package stun
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"testing"
 )
 
@@ -91,6 +94,124 @@ func TestMessageIntegrityBeforeFingerprint(t *testing.T) {
 	}
 }
 
+func TestMessageIntegritySHA256(t *testing.T) {
+	i := NewShortTermIntegritySHA256("password")
+	if i.String() != "KEY: 0x70617373776f7264" {
+		t.Error("bad string", i)
+	}
+	for _, size := range []int{16, 20, 24, 28, 32} {
+		m := new(Message)
+		m.TransactionID = [TransactionIDSize]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+		m.WriteHeader()
+		NewSoftware("software").AddTo(m) //nolint:errcheck,gosec
+		if err := i.Check(m); !errors.Is(err, ErrAttributeNotFound) {
+			t.Errorf("unexpected error %v", err)
+		}
+		if err := i.AddToTruncated(m, size); err != nil {
+			t.Fatal(err)
+		}
+		v, err := m.Get(AttrMessageIntegritySHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v) != size {
+			t.Fatalf("unexpected size %d", len(v))
+		}
+		// HMAC input is message up to integrity with adjusted length.
+		mac := hmac.New(sha256.New, i)
+		mac.Write(m.Raw[:len(m.Raw)-size-attributeHeaderSize]) //nolint:errcheck,gosec
+		if expected := mac.Sum(nil)[:size]; !bytes.Equal(v, expected) {
+			t.Errorf("%d: 0x%x != 0x%x", size, v, expected)
+		}
+		if err = i.Check(m); err != nil {
+			t.Fatal(err)
+		}
+		if err = i.AddTo(m); !errors.Is(err, ErrIntegrityExists) {
+			t.Errorf("unexpected error %v", err)
+		}
+		if err = Fingerprint.AddTo(m); err != nil {
+			t.Fatal(err)
+		}
+		dM := new(Message)
+		if err = Decode(m.Raw, dM); err != nil {
+			t.Fatal(err)
+		}
+		if err = i.Check(dM); err != nil {
+			t.Fatal(err)
+		}
+		if err = NewShortTermIntegritySHA256("wrong").Check(dM); err == nil {
+			t.Error("should fail")
+		}
+		dM.Raw[24]++
+		if err = i.Check(dM); err == nil {
+			t.Error("should fail")
+		}
+	}
+	t.Run("Size", func(t *testing.T) {
+		for _, size := range []int{0, 12, 18, 33, 36} {
+			m := MustBuild(BindingRequest)
+			if err := i.AddToTruncated(m, size); !errors.Is(err, ErrIntegritySHA256Size) {
+				t.Errorf("%d: unexpected error %v", size, err)
+			}
+			m.Add(AttrMessageIntegritySHA256, make([]byte, size))
+			if err := i.Check(m); !errors.Is(err, ErrIntegritySHA256Size) {
+				t.Errorf("%d: unexpected error %v", size, err)
+			}
+		}
+	})
+	t.Run("BeforeFingerprint", func(t *testing.T) {
+		m := MustBuild(BindingRequest, Fingerprint)
+		if err := i.AddTo(m); !errors.Is(err, ErrFingerprintBeforeIntegrity) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("WithMessageIntegrity", func(t *testing.T) {
+		sha1Integrity := NewShortTermIntegrity("password")
+		m := MustBuild(BindingRequest, NewSoftware("software"), sha1Integrity, i, Fingerprint)
+		if err := m.Check(sha1Integrity, i, Fingerprint); err != nil {
+			t.Error(err)
+		}
+		m = MustBuild(BindingRequest, i)
+		if err := sha1Integrity.AddTo(m); !errors.Is(err, ErrIntegritySHA256BeforeIntegrity) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+func BenchmarkMessageIntegritySHA256_AddTo(b *testing.B) {
+	m := new(Message)
+	integrity := NewShortTermIntegritySHA256("password")
+	m.WriteHeader()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(m.Raw)))
+	for i := 0; i < b.N; i++ {
+		m.WriteHeader()
+		if err := integrity.AddTo(m); err != nil {
+			b.Error(err)
+		}
+		m.Reset()
+	}
+}
+
+func BenchmarkMessageIntegritySHA256_Check(b *testing.B) {
+	m := new(Message)
+	m.Raw = make([]byte, 0, 1024)
+	NewSoftware("software").AddTo(m) //nolint:errcheck,gosec
+	integrity := NewShortTermIntegritySHA256("password")
+	b.ReportAllocs()
+	m.WriteHeader()
+	b.SetBytes(int64(len(m.Raw)))
+	if err := integrity.AddTo(m); err != nil {
+		b.Error(err)
+	}
+	m.WriteLength()
+	for i := 0; i < b.N; i++ {
+		if err := integrity.Check(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkMessageIntegrity_AddTo(b *testing.B) {
 	m := new(Message)
 	integrity := NewShortTermIntegrity("password")
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 )
 
 const (
@@ -42,9 +43,11 @@ func IsMessage(b []byte) bool {
 	return len(b) >= messageHeaderSize && bin.Uint32(b[4:8]) == magicCookie
 }
 
+// defaultRawCapacity is the initial capacity of Message.Raw.
+const defaultRawCapacity = 120
+
 // New returns *Message with pre-allocated Raw.
 func New() *Message {
-	const defaultRawCapacity = 120
 	return &Message{
 		Raw: make([]byte, messageHeaderSize, defaultRawCapacity),
 	}
@@ -74,6 +77,8 @@ type Message struct {
 	TransactionID [TransactionIDSize]byte
 	Attributes    Attributes
 	Raw           []byte
+
+	index attrIndex
 }
 
 // MarshalBinary implements the encoding.BinaryMarshaler interface.
@@ -121,13 +126,30 @@ func (m *Message) NewTransactionID() error {
 	return err
 }
 
+// String returns human-readable summary of message. It is built in stack
+// buffer, so the only allocation is the result, unless message has TURN
+// attributes, values of which are formatted too.
 func (m *Message) String() string {
-	tID := base64.StdEncoding.EncodeToString(m.TransactionID[:])
-	aInfo := ""
+	var buf [256]byte
+	return string(m.appendString(buf[:0]))
+}
+
+func (m *Message) appendString(b []byte) []byte {
+	var tID [16]byte // base64 of transaction ID
+	base64.StdEncoding.Encode(tID[:], m.TransactionID[:])
+	b = m.Type.appendString(b)
+	b = strconv.AppendUint(append(b, " l="...), uint64(m.Length), 10)
+	b = strconv.AppendInt(append(b, " attrs="...), int64(len(m.Attributes)), 10)
+	b = append(append(append(b, " id="...), tID[:]...), ", "...)
 	for k, a := range m.Attributes {
-		aInfo += fmt.Sprintf("attr%d=%s ", k, a.Type)
+		b = strconv.AppendInt(append(b, "attr"...), int64(k), 10)
+		b = a.Type.appendString(append(b, '='))
+		if v := turnAttrString(m, a); v != "" {
+			b = append(append(append(b, '('), v...), ')')
+		}
+		b = append(b, ' ')
 	}
-	return fmt.Sprintf("%s l=%d attrs=%d id=%s, %s", m.Type, m.Length, len(m.Attributes), tID, aInfo)
+	return b
 }
 
 // Reset resets Message, attributes and underlying buffer length.
@@ -135,6 +157,7 @@ func (m *Message) Reset() {
 	m.Raw = m.Raw[:0]
 	m.Length = 0
 	m.Attributes = m.Attributes[:0]
+	m.index.reset()
 }
 
 // grow ensures that internal buffer has n length.
@@ -200,7 +223,15 @@ func (m *Message) Add(t AttrType, v []byte) {
 		m.Raw = m.Raw[:last]           // increasing buffer length
 		m.Length += uint32(bytesToAdd) // rendering length change
 	}
+	indexed := m.index.valid(m.Attributes)
 	m.Attributes = append(m.Attributes, attr)
+	if indexed {
+		m.index.add(m.Attributes)
+	} else {
+		// Attributes were changed directly, so positions in index can
+		// become stale after the slice regains its length.
+		m.index.n = -1
+	}
 	m.WriteLength()
 }
 
@@ -374,6 +405,7 @@ func (m *Message) Decode() error {
 	copy(m.TransactionID[:], buf[8:messageHeaderSize])
 
 	m.Attributes = m.Attributes[:0]
+	m.index.reset()
 	var (
 		offset = 0
 		b      = buf[messageHeaderSize:fullSize]
@@ -403,6 +435,7 @@ func (m *Message) Decode() error {
 		b = b[aBuffL:]
 
 		m.Attributes = append(m.Attributes, a)
+		m.index.add(m.Attributes)
 	}
 	return nil
 }
@@ -495,8 +528,10 @@ func methodName() map[Method]string {
 	}
 }
 
+var methodNameTable = methodName() //nolint:gochecknoglobals
+
 func (m Method) String() string {
-	s, ok := methodName()[m]
+	s, ok := methodNameTable[m]
 	if !ok {
 		// Falling back to hex representation.
 		s = fmt.Sprintf("0x%x", uint16(m))
@@ -504,6 +539,14 @@ func (m Method) String() string {
 	return s
 }
 
+// appendString appends name of m to b, or its hex representation.
+func (m Method) appendString(b []byte) []byte {
+	if s, ok := methodNameTable[m]; ok {
+		return append(b, s...)
+	}
+	return strconv.AppendUint(append(b, "0x"...), uint64(m), 16)
+}
+
 // MessageType is STUN Message Type Field.
 type MessageType struct {
 	Method Method       // e.g. binding
@@ -597,14 +640,14 @@ func (t MessageType) String() string {
 	return fmt.Sprintf("%s %s", t.Method, t.Class)
 }
 
+// appendString appends t.String() to b.
+func (t MessageType) appendString(b []byte) []byte {
+	return append(append(t.Method.appendString(b), ' '), t.Class.String()...)
+}
+
 // Contains return true if message contain t attribute.
 func (m *Message) Contains(t AttrType) bool {
-	for _, a := range m.Attributes {
-		if a.Type == t {
-			return true
-		}
-	}
-	return false
+	return m.find(t) >= 0
 }
 
 type transactionIDValueSetter [TransactionIDSize]byte
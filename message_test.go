@@ -501,6 +501,31 @@ func TestMessage_String(t *testing.T) {
 	if m.String() == "" {
 		t.Error("bad string")
 	}
+	m = MustBuild(NewTransactionIDSetter([TransactionIDSize]byte{1, 2, 3}), NewType(0x123, ClassIndication),
+		NewSoftware("software"), RawAttribute{Type: 0x8123, Value: []byte{1}},
+	)
+	expected := "0x123 indication l=20 attrs=2 id=AQIDAAAAAAAAAAAA, attr0=SOFTWARE attr1=0x8123 "
+	if s := m.String(); s != expected {
+		t.Errorf("%q != %q", s, expected)
+	}
+	t.Run("NoAllocs", func(t *testing.T) {
+		req := newServerRequest(t)
+		allocs := testing.AllocsPerRun(10, func() {
+			_ = req.String()
+		})
+		// The only allocation is the result.
+		if allocs > 1 {
+			t.Errorf("unexpected allocations %.0f", allocs)
+		}
+	})
+}
+
+func BenchmarkMessage_String(b *testing.B) {
+	m := newServerRequest(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = m.String()
+	}
 }
 
 func TestIsMessage(t *testing.T) {
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Metrics observes transactions that are completed by Client, e.g. to
+// export latency and error rates per server.
+type Metrics interface {
+	// ObserveTransaction is called for every completed transaction before
+	// its handler with e.Stats set. Retries due to authentication and
+	// redirects are separate transactions. Usage of e is valid only
+	// during call.
+	ObserveTransaction(e Event)
+}
+
+// WithMetrics sets Metrics that observes client transactions.
+func WithMetrics(m Metrics) ClientOption {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// TransactionOutcome is the result of transaction.
+type TransactionOutcome byte
+
+// Possible transaction outcomes.
+const (
+	// OutcomeSuccess means that success response is received.
+	OutcomeSuccess TransactionOutcome = iota
+	// OutcomeErrorResponse means that error response is received.
+	OutcomeErrorResponse
+	// OutcomeTimeout means that no response is received in time.
+	OutcomeTimeout
+	// OutcomeError means that transaction failed for other reason, e.g.
+	// write error or cancellation.
+	OutcomeError
+)
+
+func (o TransactionOutcome) String() string {
+	switch o {
+	case OutcomeSuccess:
+		return "success"
+	case OutcomeErrorResponse:
+		return "error response"
+	case OutcomeTimeout:
+		return "timeout"
+	case OutcomeError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Outcome returns outcome of transaction that e completes.
+func (e Event) Outcome() TransactionOutcome {
+	switch {
+	case errors.Is(e.Error, ErrTransactionTimeOut):
+		return OutcomeTimeout
+	case e.Message != nil && e.Message.Type.Class == ClassErrorResponse:
+		// Including error responses that are reported as errors, e.g.
+		// UnknownAttributeError.
+		return OutcomeErrorResponse
+	case e.Error != nil || e.Message == nil:
+		return OutcomeError
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// TransactionCount is snapshot of TransactionCounters.
+type TransactionCount struct {
+	Success       uint64
+	ErrorResponse uint64
+	Timeout       uint64
+	Error         uint64
+	// Retransmissions is the total number of retransmitted requests.
+	Retransmissions uint64
+	// RTT is the sum of RTT of transactions with response, use
+	// AverageRTT to get the mean.
+	RTT time.Duration
+}
+
+// Total returns the number of transactions.
+func (c TransactionCount) Total() uint64 {
+	return c.Success + c.ErrorResponse + c.Timeout + c.Error
+}
+
+// AverageRTT returns mean RTT of transactions with response.
+func (c TransactionCount) AverageRTT() time.Duration {
+	responses := c.Success + c.ErrorResponse
+	if responses == 0 {
+		return 0
+	}
+	return c.RTT / time.Duration(responses)
+}
+
+// TransactionCounters is Metrics that counts transaction outcomes, in
+// total and per server. Safe for concurrent use.
+type TransactionCounters struct {
+	mux    sync.Mutex
+	total  TransactionCount
+	remote map[string]*TransactionCount
+}
+
+// ObserveTransaction implements Metrics.
+func (m *TransactionCounters) ObserveTransaction(e Event) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.remote == nil {
+		m.remote = make(map[string]*TransactionCount)
+	}
+	key := ""
+	if e.Stats.Remote != nil {
+		key = e.Stats.Remote.String()
+	}
+	remote, ok := m.remote[key]
+	if !ok {
+		remote = new(TransactionCount)
+		m.remote[key] = remote
+	}
+	for _, c := range []*TransactionCount{&m.total, remote} {
+		c.add(e)
+	}
+}
+
+func (c *TransactionCount) add(e Event) {
+	switch e.Outcome() {
+	case OutcomeSuccess:
+		c.Success++
+		c.RTT += e.Stats.RTT
+	case OutcomeErrorResponse:
+		c.ErrorResponse++
+		c.RTT += e.Stats.RTT
+	case OutcomeTimeout:
+		c.Timeout++
+	case OutcomeError:
+		c.Error++
+	}
+	if e.Stats.Attempts > 1 {
+		c.Retransmissions += uint64(e.Stats.Attempts - 1)
+	}
+}
+
+// Count returns total counts.
+func (m *TransactionCounters) Count() TransactionCount {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.total
+}
+
+// RemoteCount returns counts of transactions with server at remote
+// address, as returned by net.Addr.String. Empty string is used if
+// connection does not provide remote address.
+func (m *TransactionCounters) RemoteCount(remote string) TransactionCount {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if c, ok := m.remote[remote]; ok {
+		return *c
+	}
+	return TransactionCount{}
+}
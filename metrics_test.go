@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEvent_Outcome(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		e       Event
+		outcome TransactionOutcome
+	}{
+		{"Success", Event{Message: MustBuild(BindingSuccess)}, OutcomeSuccess},
+		{"ErrorResponse", Event{Message: MustBuild(BindingError)}, OutcomeErrorResponse},
+		{"UnknownAttribute", Event{
+			Message: MustBuild(BindingError, CodeUnknownAttribute),
+			Error:   UnknownAttributeError{},
+		}, OutcomeErrorResponse},
+		{"Timeout", Event{Error: ErrTransactionTimeOut}, OutcomeTimeout},
+		{"Stopped", Event{Error: ErrTransactionStopped}, OutcomeError},
+		{"NoMessage", Event{}, OutcomeError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if o := tc.e.Outcome(); o != tc.outcome {
+				t.Errorf("%s (got) != %s (expected)", o, tc.outcome)
+			}
+		})
+	}
+	if s := TransactionOutcome(100).String(); s != "unknown" {
+		t.Errorf("unexpected %q", s)
+	}
+}
+
+func TestTransactionCounters(t *testing.T) {
+	var (
+		m = new(TransactionCounters)
+		a = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478}
+		b = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 3478}
+	)
+	m.ObserveTransaction(Event{
+		Message: MustBuild(BindingSuccess),
+		Stats:   TransactionStats{RTT: 100 * time.Millisecond, Attempts: 1, Remote: a},
+	})
+	m.ObserveTransaction(Event{
+		Message: MustBuild(BindingError),
+		Stats:   TransactionStats{RTT: 300 * time.Millisecond, Attempts: 3, Remote: a},
+	})
+	m.ObserveTransaction(Event{
+		Error: ErrTransactionTimeOut,
+		Stats: TransactionStats{Attempts: 7, Remote: b},
+	})
+	m.ObserveTransaction(Event{Error: io.EOF, Stats: TransactionStats{Attempts: 1}})
+
+	total := m.Count()
+	if total != (TransactionCount{
+		Success:         1,
+		ErrorResponse:   1,
+		Timeout:         1,
+		Error:           1,
+		Retransmissions: 8,
+		RTT:             400 * time.Millisecond,
+	}) {
+		t.Errorf("unexpected total %+v", total)
+	}
+	if total.Total() != 4 {
+		t.Errorf("unexpected total count %d", total.Total())
+	}
+	if rtt := total.AverageRTT(); rtt != 200*time.Millisecond {
+		t.Errorf("unexpected average RTT %s", rtt)
+	}
+	if c := m.RemoteCount(a.String()); c.Total() != 2 || c.Retransmissions != 2 {
+		t.Errorf("unexpected count of %s: %+v", a, c)
+	}
+	if c := m.RemoteCount(b.String()); c.Timeout != 1 || c.AverageRTT() != 0 {
+		t.Errorf("unexpected count of %s: %+v", b, c)
+	}
+	if c := m.RemoteCount(""); c.Error != 1 {
+		t.Errorf("unexpected count without remote: %+v", c)
+	}
+	if c := m.RemoteCount("127.0.0.3:3478"); c.Total() != 0 {
+		t.Errorf("unexpected count of unknown remote: %+v", c)
+	}
+}
+
+// udpAddrConn is Connection with UDP remote address.
+type udpAddrConn struct {
+	Connection
+}
+
+func (udpAddrConn) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478}
+}
+
+func TestClient_Metrics(t *testing.T) {
+	var (
+		clock   = &manualClock{current: time.Now()}
+		agent   = &manualAgent{}
+		metrics = new(TransactionCounters)
+		closed  = make(chan struct{})
+	)
+	agent.start = func([TransactionIDSize]byte, time.Time) error { return nil }
+	conn := udpAddrConn{Connection: &testConnection{
+		write: func(b []byte) (int, error) { return len(b), nil },
+		read: func([]byte) (int, error) {
+			<-closed
+			return 0, io.EOF
+		},
+		close: func() error {
+			close(closed)
+			return nil
+		},
+	}}
+	c, err := NewClient(conn,
+		WithAgent(agent),
+		WithClock(clock),
+		WithCollector(new(manualCollector)),
+		WithRTO(time.Second),
+		WithMetrics(metrics),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close() //nolint:errcheck
+	var stats TransactionStats
+	transaction := func() transactionID {
+		req := MustBuild(TransactionID, BindingRequest)
+		if err := c.Start(req, func(e Event) { stats = e.Stats }); err != nil {
+			t.Fatal(err)
+		}
+		return req.TransactionID
+	}
+	respond := func(id transactionID) {
+		agent.h(Event{TransactionID: id, Message: MustBuild(NewTransactionIDSetter(id), BindingSuccess)})
+	}
+
+	id := transaction()
+	start := clock.Now()
+	clock.Add(200 * time.Millisecond)
+	respond(id)
+	if stats.Attempts != 1 || stats.RTT != 200*time.Millisecond || stats.Duration != 200*time.Millisecond {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if !stats.Start.Equal(start) {
+		t.Errorf("unexpected start %s", stats.Start)
+	}
+	if stats.Remote == nil || stats.Remote.String() != "127.0.0.1:3478" {
+		t.Errorf("unexpected remote %v", stats.Remote)
+	}
+
+	// RTT is measured from the last retransmission.
+	id = transaction()
+	clock.Add(600 * time.Millisecond)
+	agent.h(Event{TransactionID: id, Error: ErrTransactionTimeOut})
+	clock.Add(100 * time.Millisecond)
+	respond(id)
+	if stats.Attempts != 2 || stats.RTT != 100*time.Millisecond || stats.Duration != 700*time.Millisecond {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	id = transaction()
+	clock.Add(time.Second)
+	agent.h(Event{TransactionID: id, Error: errors.New("failed")})
+	if stats.Attempts != 1 || stats.RTT != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	count := metrics.RemoteCount("127.0.0.1:3478")
+	if count.Success != 2 || count.Error != 1 || count.Retransmissions != 1 {
+		t.Errorf("unexpected count %+v", count)
+	}
+	if count.AverageRTT() != 150*time.Millisecond {
+		t.Errorf("unexpected average RTT %s", count.AverageRTT())
+	}
+}
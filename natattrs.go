@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import "fmt"
+
+// ChangeRequest represents CHANGE-REQUEST attribute.
+//
+// RFC 5780 Section 7.2
+type ChangeRequest struct {
+	ChangeIP   bool
+	ChangePort bool
+}
+
+// flags for CHANGE-REQUEST encoding.
+const (
+	changeRequestSize       = 4
+	changeRequestIPFlag     = 0x04 // "A" flag
+	changeRequestPortFlag   = 0x02 // "B" flag
+	changeRequestFlagsIndex = 3
+)
+
+func (c ChangeRequest) String() string {
+	return fmt.Sprintf("change ip: %t, change port: %t", c.ChangeIP, c.ChangePort)
+}
+
+// AddTo adds CHANGE-REQUEST to message.
+func (c ChangeRequest) AddTo(m *Message) error {
+	v := make([]byte, changeRequestSize)
+	if c.ChangeIP {
+		v[changeRequestFlagsIndex] |= changeRequestIPFlag
+	}
+	if c.ChangePort {
+		v[changeRequestFlagsIndex] |= changeRequestPortFlag
+	}
+	m.Add(AttrChangeRequest, v)
+	return nil
+}
+
+// GetFrom decodes CHANGE-REQUEST from message.
+func (c *ChangeRequest) GetFrom(m *Message) error {
+	v, err := m.Get(AttrChangeRequest)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(AttrChangeRequest, len(v), changeRequestSize); err != nil {
+		return err
+	}
+	flags := v[changeRequestFlagsIndex]
+	c.ChangeIP = flags&changeRequestIPFlag != 0
+	c.ChangePort = flags&changeRequestPortFlag != 0
+	return nil
+}
+
+// ResponsePort represents RESPONSE-PORT attribute, the port to which the
+// response should be sent instead of the source port of request.
+//
+// RFC 5780 Section 7.5
+type ResponsePort uint16
+
+const responsePortSize = 4 // port and 2 bytes of padding
+
+func (p ResponsePort) String() string {
+	return fmt.Sprintf("%d", uint16(p))
+}
+
+// AddTo adds RESPONSE-PORT to message.
+func (p ResponsePort) AddTo(m *Message) error {
+	var v [responsePortSize]byte
+	bin.PutUint16(v[:2], uint16(p))
+	// v[2:4] are zeroes (padding)
+	m.Add(AttrResponsePort, v[:])
+	return nil
+}
+
+// GetFrom decodes RESPONSE-PORT from message.
+func (p *ResponsePort) GetFrom(m *Message) error {
+	v, err := m.Get(AttrResponsePort)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(AttrResponsePort, len(v), responsePortSize); err != nil {
+		return err
+	}
+	*p = ResponsePort(bin.Uint16(v[:2]))
+	return nil
+}
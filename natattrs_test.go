@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChangeRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value ChangeRequest
+		raw   []byte
+	}{
+		{"None", ChangeRequest{}, []byte{0, 0, 0, 0}},
+		{"Port", ChangeRequest{ChangePort: true}, []byte{0, 0, 0, 2}},
+		{"IP", ChangeRequest{ChangeIP: true}, []byte{0, 0, 0, 4}},
+		{"Both", ChangeRequest{ChangeIP: true, ChangePort: true}, []byte{0, 0, 0, 6}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New()
+			if err := tc.value.AddTo(m); err != nil {
+				t.Fatal(err)
+			}
+			v, err := m.Get(AttrChangeRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(v, tc.raw) {
+				t.Errorf("unexpected value 0x%x", v)
+			}
+			got := ChangeRequest{ChangeIP: !tc.value.ChangeIP}
+			if err = got.GetFrom(m); err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.value {
+				t.Errorf("%s != %s", got, tc.value)
+			}
+		})
+	}
+	t.Run("String", func(t *testing.T) {
+		c := ChangeRequest{ChangeIP: true}
+		if c.String() != "change ip: true, change port: false" {
+			t.Errorf("bad string %q", c)
+		}
+	})
+	t.Run("GetFrom", func(t *testing.T) {
+		var c ChangeRequest
+		m := New()
+		if err := c.GetFrom(m); !errors.Is(err, ErrAttributeNotFound) {
+			t.Errorf("unexpected error %v", err)
+		}
+		m.Add(AttrChangeRequest, []byte{1, 2, 3})
+		if err := c.GetFrom(m); !IsAttrSizeInvalid(err) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+func TestResponsePort(t *testing.T) {
+	m := New()
+	if err := ResponsePort(3478).AddTo(m); err != nil {
+		t.Fatal(err)
+	}
+	v, err := m.Get(AttrResponsePort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte{0x0d, 0x96, 0, 0}) {
+		t.Errorf("unexpected value 0x%x", v)
+	}
+	var p ResponsePort
+	if err = p.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if p != 3478 {
+		t.Errorf("unexpected port %s", p)
+	}
+	t.Run("GetFrom", func(t *testing.T) {
+		m := New()
+		if err := p.GetFrom(m); !errors.Is(err, ErrAttributeNotFound) {
+			t.Errorf("unexpected error %v", err)
+		}
+		m.Add(AttrResponsePort, []byte{1, 2})
+		if err := p.GetFrom(m); !IsAttrSizeInvalid(err) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
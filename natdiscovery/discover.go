@@ -0,0 +1,468 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package natdiscovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v2"
+	"github.com/pion/transport/v3"
+	"github.com/pion/transport/v3/stdnet"
+)
+
+const (
+	defaultTimeout           = 3 * time.Second
+	defaultRTO               = 500 * time.Millisecond
+	maxAttempts              = 7
+	defaultMaxLifetime       = 5 * time.Minute
+	defaultLifetimePrecision = time.Second
+)
+
+// Config is used to pass configuration to Discover().
+type Config struct {
+	// Server is host:port of STUN server that supports RFC 5780.
+	Server string
+
+	// Network is "udp4" or "udp6", defaults to "udp4".
+	Network string
+
+	// Timeout is the time to wait for every response, including
+	// retransmissions, defaults to 3 seconds. Filtering tests that expect
+	// no response take that long.
+	Timeout time.Duration
+
+	// RTO is the initial retransmission timeout, defaults to 500 ms.
+	// Requests are retransmitted with doubled timeout until Timeout.
+	RTO time.Duration
+
+	// MaxLifetime is the longest binding lifetime that DiscoverLifetime
+	// checks, defaults to 5 minutes. LifetimePrecision is the accuracy of
+	// its search, defaults to 1 second.
+	MaxLifetime       time.Duration
+	LifetimePrecision time.Duration
+
+	Net           transport.Net
+	LoggerFactory logging.LoggerFactory
+}
+
+// discoverer holds the state of single discovery.
+type discoverer struct {
+	nw          transport.Net
+	network     string
+	timeout     time.Duration
+	rto         time.Duration
+	maxLifetime time.Duration
+	precision   time.Duration
+	log         logging.LeveledLogger
+	server      *net.UDPAddr
+	other       *net.UDPAddr // OTHER-ADDRESS of server
+	res         *Result
+	tests       []Test
+	buf         []byte
+}
+
+func newDiscoverer(cfg *Config) (*discoverer, error) {
+	d := &discoverer{
+		nw:          cfg.Net,
+		network:     cfg.Network,
+		timeout:     cfg.Timeout,
+		rto:         cfg.RTO,
+		maxLifetime: cfg.MaxLifetime,
+		precision:   cfg.LifetimePrecision,
+		res:         new(Result),
+		buf:         make([]byte, 1500),
+	}
+	if d.network == "" {
+		d.network = "udp4"
+	}
+	if d.timeout == 0 {
+		d.timeout = defaultTimeout
+	}
+	if d.rto == 0 {
+		d.rto = defaultRTO
+	}
+	if d.maxLifetime == 0 {
+		d.maxLifetime = defaultMaxLifetime
+	}
+	if d.precision == 0 {
+		d.precision = defaultLifetimePrecision
+	}
+	loggerFactory := cfg.LoggerFactory
+	if loggerFactory == nil {
+		loggerFactory = logging.NewDefaultLoggerFactory()
+	}
+	d.log = loggerFactory.NewLogger("natdiscovery")
+	if d.nw == nil {
+		var err error
+		if d.nw, err = stdnet.NewNet(); err != nil {
+			return nil, fmt.Errorf("failed to create net: %w", err)
+		}
+	}
+	var err error
+	if d.server, err = d.nw.ResolveUDPAddr(d.network, cfg.Server); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Discover runs RFC 5780 mapping and filtering behavior tests and the
+// hairpinning test against cfg.Server. On error the partial result is
+// returned together with the error, with evidence of tests performed so
+// far.
+func Discover(cfg *Config) (*Result, error) {
+	d, err := newDiscoverer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { d.res.Tests = d.tests }()
+	conn, err := d.listen()
+	if err != nil {
+		return d.res, err
+	}
+	defer conn.Close() //nolint:errcheck
+	if err = d.mapping(conn); err != nil {
+		return d.res, err
+	}
+	if err = d.filtering(); err != nil {
+		return d.res, err
+	}
+	if err = d.hairpinning(conn); err != nil {
+		return d.res, err
+	}
+	return d.res, nil
+}
+
+// DiscoverHairpinning learns the public address of new socket from
+// cfg.Server, that is not required to support RFC 5780, and checks
+// whether NAT supports hairpinning. Only NAT, LocalAddr, PublicAddr,
+// Hairpinning and Tests of the result are set.
+func DiscoverHairpinning(cfg *Config) (*Result, error) {
+	d, err := newDiscoverer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { d.res.Tests = d.tests }()
+	conn, err := d.listen()
+	if err != nil {
+		return d.res, err
+	}
+	defer conn.Close() //nolint:errcheck
+	if _, err = d.public(conn); err != nil {
+		return d.res, err
+	}
+	return d.res, d.hairpinning(conn)
+}
+
+// public performs Test I of mapping behavior discovery, filling public
+// address of conn.
+func (d *discoverer) public(conn net.PacketConn) (Test, error) {
+	t, err := d.test(conn, MappingTestI, d.server, stun.ChangeRequest{})
+	if err != nil {
+		return t, err
+	}
+	d.res.LocalAddr, d.res.PublicAddr = t.Local, t.Mapped
+	d.res.NAT, err = d.translated(t.Local, t.Mapped)
+	return t, err
+}
+
+// mapping determines mapping behavior, sending requests from conn.
+//
+// RFC 5780 Section 4.3.
+func (d *discoverer) mapping(conn net.PacketConn) error {
+	t, err := d.public(conn)
+	if err != nil {
+		return err
+	}
+	if d.other == nil {
+		return ErrNoOtherAddress
+	}
+	if !d.res.NAT {
+		d.log.Info("no NAT detected")
+		d.res.Mapping = EndpointIndependent
+		return nil
+	}
+	// Test II: the alternate IP address and the primary port.
+	t2, err := d.test(conn, MappingTestII, &net.UDPAddr{IP: d.other.IP, Port: d.server.Port}, stun.ChangeRequest{})
+	if err != nil {
+		return err
+	}
+	if equalAddr(t2.Mapped, t.Mapped) {
+		d.res.Mapping = EndpointIndependent
+		return nil
+	}
+	// Test III: the alternate IP address and port.
+	t3, err := d.test(conn, MappingTestIII, d.other, stun.ChangeRequest{})
+	if err != nil {
+		return err
+	}
+	if equalAddr(t3.Mapped, t2.Mapped) {
+		d.res.Mapping = AddressDependent
+	} else {
+		d.res.Mapping = AddressAndPortDependent
+	}
+	return nil
+}
+
+// filtering determines filtering behavior on the new socket, so mapping
+// tests do not affect the filters.
+//
+// RFC 5780 Section 4.4.
+func (d *discoverer) filtering() error {
+	conn, err := d.listen()
+	if err != nil {
+		return err
+	}
+	defer conn.Close() //nolint:errcheck
+	if _, err = d.test(conn, FilteringTestI, d.server, stun.ChangeRequest{}); err != nil {
+		return err
+	}
+	_, err = d.test(conn, FilteringTestII, d.server, stun.ChangeRequest{ChangeIP: true, ChangePort: true})
+	switch {
+	case err == nil:
+		d.res.Filtering = EndpointIndependent
+		return nil
+	case !errors.Is(err, ErrTimeout):
+		return err
+	}
+	_, err = d.test(conn, FilteringTestIII, d.server, stun.ChangeRequest{ChangePort: true})
+	switch {
+	case err == nil:
+		d.res.Filtering = AddressDependent
+	case errors.Is(err, ErrTimeout):
+		d.res.Filtering = AddressAndPortDependent
+	default:
+		return err
+	}
+	return nil
+}
+
+// hairpinning sends request from the new socket to the public address of
+// conn and checks whether it arrives.
+//
+// RFC 4787 Section 6.
+func (d *discoverer) hairpinning(conn net.PacketConn) error {
+	from, err := d.listen()
+	if err != nil {
+		return err
+	}
+	defer from.Close() //nolint:errcheck
+	req, err := stun.Build(stun.TransactionID, stun.BindingRequest, stun.Fingerprint)
+	if err != nil {
+		return err
+	}
+	t := Test{
+		Name:  HairpinningTest,
+		Local: udpAddr(from.LocalAddr()),
+		Dst:   d.res.PublicAddr,
+	}
+	_, t.Origin, t.RTT, t.Err = d.transact(from, conn, req, t.Dst)
+	if t.Err != nil && !errors.Is(t.Err, ErrTimeout) {
+		return t.Err
+	}
+	hairpinning := t.Err == nil
+	d.res.Hairpinning = &hairpinning
+	d.record(t)
+	return nil
+}
+
+// test sends Binding request with change flags to addr from conn and
+// records the evidence. Non-nil error of test is returned.
+func (d *discoverer) test(conn net.PacketConn, name string, addr *net.UDPAddr, change stun.ChangeRequest) (Test, error) {
+	return d.do(conn, conn, Test{
+		Name:       name,
+		Local:      udpAddr(conn.LocalAddr()),
+		Dst:        addr,
+		ChangeIP:   change.ChangeIP,
+		ChangePort: change.ChangePort,
+	})
+}
+
+// do performs t, sending request from conn and waiting for response on
+// recv, and records the evidence. Non-nil error of test is returned.
+func (d *discoverer) do(conn, recv net.PacketConn, t Test) (Test, error) {
+	t.Err = d.roundTrip(conn, recv, &t)
+	d.record(t)
+	return t, t.Err
+}
+
+// roundTrip performs Binding transaction of t, filling its response
+// fields.
+func (d *discoverer) roundTrip(conn, recv net.PacketConn, t *Test) error {
+	setters := []stun.Setter{stun.TransactionID, stun.BindingRequest}
+	if t.ChangeIP || t.ChangePort {
+		setters = append(setters, stun.ChangeRequest{ChangeIP: t.ChangeIP, ChangePort: t.ChangePort})
+	}
+	if t.ResponsePort != 0 {
+		setters = append(setters, stun.ResponsePort(t.ResponsePort))
+	}
+	setters = append(setters, stun.Fingerprint)
+	req, err := stun.Build(setters...)
+	if err != nil {
+		return err
+	}
+	res, origin, rtt, err := d.transact(conn, recv, req, t.Dst)
+	if err != nil {
+		return err
+	}
+	t.RTT = rtt
+	t.Origin = origin
+	if res.Type != stun.BindingSuccess {
+		var code stun.ErrorCodeAttribute
+		if code.GetFrom(res) == nil {
+			return fmt.Errorf("%w %s: %s", ErrUnexpectedResponse, res.Type, code)
+		}
+		return fmt.Errorf("%w %s", ErrUnexpectedResponse, res.Type)
+	}
+	var mapped stun.XORMappedAddress
+	if err = mapped.GetFrom(res); err != nil {
+		return ErrNoMappedAddress
+	}
+	t.Mapped = &net.UDPAddr{IP: mapped.IP, Port: mapped.Port}
+	if err = checkOrigin(t, res); err != nil {
+		return err
+	}
+	var other stun.OtherAddress
+	if d.other == nil && other.GetFrom(res) == nil {
+		d.other = &net.UDPAddr{IP: other.IP, Port: other.Port}
+	}
+	return nil
+}
+
+// checkOrigin returns ErrChangeRequestIgnored if response to t was not
+// sent from the address that CHANGE-REQUEST asked for, judging by both
+// the source address and RESPONSE-ORIGIN. Otherwise, server that ignores
+// CHANGE-REQUEST would pass filtering tests of any NAT.
+//
+// RFC 5780 Section 7.2.
+func checkOrigin(t *Test, res *stun.Message) error {
+	if !t.ChangeIP && !t.ChangePort {
+		return nil
+	}
+	origins := []*net.UDPAddr{t.Origin}
+	var responseOrigin stun.ResponseOrigin
+	if responseOrigin.GetFrom(res) == nil {
+		origins = append(origins, &net.UDPAddr{IP: responseOrigin.IP, Port: responseOrigin.Port})
+	}
+	for _, origin := range origins {
+		if origin == nil {
+			continue
+		}
+		if (t.ChangeIP && origin.IP.Equal(t.Dst.IP)) || (t.ChangePort && origin.Port == t.Dst.Port) {
+			return fmt.Errorf("%w: response from %s", ErrChangeRequestIgnored, origin)
+		}
+	}
+	return nil
+}
+
+// transact sends req from conn to dst and waits for message with its
+// transaction ID on recv, retransmitting req with doubled RTO until
+// maxAttempts requests are sent or d.timeout passes. The returned RTT is
+// measured from the last request.
+//
+// RFC 5389 Section 7.2.1.
+func (d *discoverer) transact(conn, recv net.PacketConn, req *stun.Message, dst *net.UDPAddr) (*stun.Message, *net.UDPAddr, time.Duration, error) {
+	deadline := time.Now().Add(d.timeout)
+	rto := d.rto
+	for attempt := 1; ; attempt++ {
+		sent := time.Now()
+		if _, err := conn.WriteTo(req.Raw, dst); err != nil {
+			return nil, nil, 0, err
+		}
+		wait := sent.Add(rto)
+		if attempt == maxAttempts || wait.After(deadline) {
+			wait = deadline
+		}
+		res, origin, err := d.read(recv, req.TransactionID, wait)
+		if errors.Is(err, ErrTimeout) && wait.Before(deadline) {
+			d.log.Debugf("retransmitting request to %s", dst)
+			rto *= 2
+			continue
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		return res, origin, time.Since(sent), nil
+	}
+}
+
+// read reads from conn until message with transaction id is received or
+// deadline is reached, ignoring everything else.
+func (d *discoverer) read(conn net.PacketConn, id [stun.TransactionIDSize]byte, deadline time.Time) (*stun.Message, *net.UDPAddr, error) {
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, nil, err
+	}
+	for {
+		n, addr, err := conn.ReadFrom(d.buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, nil, ErrTimeout
+			}
+			return nil, nil, err
+		}
+		m := &stun.Message{Raw: append([]byte{}, d.buf[:n]...)}
+		if err = m.Decode(); err != nil || m.TransactionID != id {
+			d.log.Debugf("ignoring %d bytes from %s", n, addr)
+			continue
+		}
+		return m, udpAddr(addr), nil
+	}
+}
+
+// translated reports whether mapped address differs from the address of
+// local socket. Unspecified local IP matches any address of interfaces.
+func (d *discoverer) translated(local, mapped *net.UDPAddr) (bool, error) {
+	if local == nil || local.Port != mapped.Port {
+		return true, nil
+	}
+	if !local.IP.IsUnspecified() {
+		return !local.IP.Equal(mapped.IP), nil
+	}
+	interfaces, err := d.nw.Interfaces()
+	if err != nil {
+		return false, err
+	}
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			var ip net.IP
+			switch a := addr.(type) {
+			case *net.IPNet:
+				ip = a.IP
+			case *net.IPAddr:
+				ip = a.IP
+			}
+			if ip.Equal(mapped.IP) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func (d *discoverer) record(t Test) {
+	d.log.Info(t.String())
+	d.tests = append(d.tests, t)
+}
+
+// listen opens new socket on unspecified address.
+func (d *discoverer) listen() (net.PacketConn, error) {
+	return d.nw.ListenUDP(d.network, nil)
+}
+
+func udpAddr(addr net.Addr) *net.UDPAddr {
+	a, _ := addr.(*net.UDPAddr) //nolint:errcheck
+	return a
+}
+
+func equalAddr(a, b *net.UDPAddr) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
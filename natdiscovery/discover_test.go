@@ -0,0 +1,528 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package natdiscovery
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v2"
+	"github.com/pion/stun/v2/server"
+	"github.com/pion/transport/v3/vnet"
+)
+
+const (
+	testTimeout = 200 * time.Millisecond
+	primaryIP   = "1.2.3.4"
+	alternateIP = "1.2.3.5"
+	publicIP    = "5.6.7.8"
+)
+
+// network is virtual network with RFC 5780 server on WAN and client
+// behind NAT of given type, or directly on WAN if type is nil.
+type network struct {
+	wan    *vnet.Router
+	client *vnet.Net
+	server *server.Server
+}
+
+func newNetwork(t *testing.T, natType *vnet.NATType) *network {
+	t.Helper()
+	loggerFactory := logging.NewDefaultLoggerFactory()
+	wan, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "0.0.0.0/0",
+		LoggerFactory: loggerFactory,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverNet, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{primaryIP, alternateIP}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wan.AddNet(serverNet); err != nil {
+		t.Fatal(err)
+	}
+	n := &network{wan: wan}
+	if natType == nil {
+		if n.client, err = vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{publicIP}}); err != nil {
+			t.Fatal(err)
+		}
+		if err = wan.AddNet(n.client); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		lan, lanErr := vnet.NewRouter(&vnet.RouterConfig{
+			CIDR:          "192.168.0.0/24",
+			StaticIPs:     []string{publicIP},
+			NATType:       natType,
+			LoggerFactory: loggerFactory,
+		})
+		if lanErr != nil {
+			t.Fatal(lanErr)
+		}
+		if err = wan.AddRouter(lan); err != nil {
+			t.Fatal(err)
+		}
+		if n.client, err = vnet.NewNet(&vnet.NetConfig{}); err != nil {
+			t.Fatal(err)
+		}
+		if err = lan.AddNet(n.client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = wan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := server.ListenDiscovery(&server.DiscoveryConfig{
+		PrimaryAddr:   &net.UDPAddr{IP: net.ParseIP(primaryIP), Port: 3478},
+		AlternateAddr: &net.UDPAddr{IP: net.ParseIP(alternateIP), Port: 3479},
+		Net:           serverNet,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.server = server.New()
+	go func() {
+		if serveErr := n.server.ServeDiscovery(d); !errors.Is(serveErr, server.ErrServerClosed) {
+			t.Error(serveErr)
+		}
+	}()
+	t.Cleanup(func() {
+		if closeErr := n.server.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+		if stopErr := wan.Stop(); stopErr != nil {
+			t.Error(stopErr)
+		}
+	})
+	return n
+}
+
+func (n *network) config() *Config {
+	return &Config{
+		Server:  primaryIP + ":3478",
+		Timeout: testTimeout,
+		Net:     n.client,
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		natType     *vnet.NATType
+		nat         bool
+		mapping     Behavior
+		filtering   Behavior
+		hairpinning bool
+		tests       []string
+	}{
+		{
+			name:        "NoNAT",
+			mapping:     EndpointIndependent,
+			filtering:   EndpointIndependent,
+			hairpinning: true,
+			tests: []string{
+				MappingTestI,
+				FilteringTestI, FilteringTestII,
+				HairpinningTest,
+			},
+		},
+		{
+			name: "FullCone",
+			natType: &vnet.NATType{
+				MappingBehavior:   vnet.EndpointIndependent,
+				FilteringBehavior: vnet.EndpointIndependent,
+			},
+			nat:         true,
+			mapping:     EndpointIndependent,
+			filtering:   EndpointIndependent,
+			hairpinning: true,
+			tests: []string{
+				MappingTestI, MappingTestII,
+				FilteringTestI, FilteringTestII,
+				HairpinningTest,
+			},
+		},
+		{
+			name: "RestrictedCone",
+			natType: &vnet.NATType{
+				MappingBehavior:   vnet.EndpointIndependent,
+				FilteringBehavior: vnet.EndpointAddrDependent,
+			},
+			nat:       true,
+			mapping:   EndpointIndependent,
+			filtering: AddressDependent,
+			tests: []string{
+				MappingTestI, MappingTestII,
+				FilteringTestI, FilteringTestII, FilteringTestIII,
+				HairpinningTest,
+			},
+		},
+		{
+			name: "Symmetric",
+			natType: &vnet.NATType{
+				MappingBehavior:   vnet.EndpointAddrPortDependent,
+				FilteringBehavior: vnet.EndpointAddrPortDependent,
+			},
+			nat:       true,
+			mapping:   AddressAndPortDependent,
+			filtering: AddressAndPortDependent,
+			tests: []string{
+				MappingTestI, MappingTestII, MappingTestIII,
+				FilteringTestI, FilteringTestII, FilteringTestIII,
+				HairpinningTest,
+			},
+		},
+		{
+			name: "AddressDependentMapping",
+			natType: &vnet.NATType{
+				MappingBehavior:   vnet.EndpointAddrDependent,
+				FilteringBehavior: vnet.EndpointAddrPortDependent,
+			},
+			nat:       true,
+			mapping:   AddressDependent,
+			filtering: AddressAndPortDependent,
+			tests: []string{
+				MappingTestI, MappingTestII, MappingTestIII,
+				FilteringTestI, FilteringTestII, FilteringTestIII,
+				HairpinningTest,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			n := newNetwork(t, tc.natType)
+			res, err := Discover(n.config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.NAT != tc.nat {
+				t.Errorf("NAT = %v, want %v", res.NAT, tc.nat)
+			}
+			if res.Mapping != tc.mapping {
+				t.Errorf("Mapping = %s, want %s", res.Mapping, tc.mapping)
+			}
+			if res.Filtering != tc.filtering {
+				t.Errorf("Filtering = %s, want %s", res.Filtering, tc.filtering)
+			}
+			if res.Hairpinning == nil || *res.Hairpinning != tc.hairpinning {
+				t.Errorf("Hairpinning = %v, want %v", res.Hairpinning, tc.hairpinning)
+			}
+			if res.DirectConnectivity() != (tc.mapping == EndpointIndependent) {
+				t.Error("unexpected DirectConnectivity")
+			}
+			if res.PublicAddr == nil || !res.PublicAddr.IP.Equal(net.ParseIP(publicIP)) {
+				t.Errorf("unexpected public address %s", res.PublicAddr)
+			}
+			var names []string
+			for _, test := range res.Tests {
+				names = append(names, test.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tc.tests, ",") {
+				t.Errorf("tests %v, want %v", names, tc.tests)
+			}
+		})
+	}
+}
+
+func TestDiscover_NoOtherAddress(t *testing.T) {
+	wan, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "0.0.0.0/0",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverNet, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{primaryIP}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientNet, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{publicIP}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, nw := range []*vnet.Net{serverNet, clientNet} {
+		if err = wan.AddNet(nw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = wan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer wan.Stop() //nolint:errcheck
+	conn, err := serverNet.ListenPacket("udp4", primaryIP+":3478")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.New()
+	defer s.Close()        //nolint:errcheck
+	go s.ServePacket(conn) //nolint:errcheck
+
+	res, err := Discover(&Config{
+		Server:  primaryIP + ":3478",
+		Timeout: testTimeout,
+		Net:     clientNet,
+	})
+	if !errors.Is(err, ErrNoOtherAddress) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(res.Tests) != 1 || res.Tests[0].Err != nil || res.PublicAddr == nil {
+		t.Errorf("unexpected tests %v", res.Tests)
+	}
+	if res.Mapping != BehaviorUnknown || res.Filtering != BehaviorUnknown || res.Hairpinning != nil {
+		t.Error("behavior should be unknown")
+	}
+	t.Run("Hairpinning", func(t *testing.T) {
+		// RFC 5780 support is not required.
+		res, err := DiscoverHairpinning(&Config{
+			Server:  primaryIP + ":3478",
+			Timeout: testTimeout,
+			Net:     clientNet,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.NAT || res.Hairpinning == nil || !*res.Hairpinning {
+			t.Errorf("unexpected result %+v", res)
+		}
+	})
+}
+
+func TestDiscover_Retransmit(t *testing.T) {
+	n := newNetwork(t, nil)
+	var (
+		mux     sync.Mutex
+		dropped int
+	)
+	// Dropping the first request of every test.
+	n.wan.AddChunkFilter(func(c vnet.Chunk) bool {
+		dst := udpAddr(c.DestinationAddr())
+		if dst == nil || !dst.IP.Equal(net.ParseIP(primaryIP)) {
+			return true
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		dropped++
+		return dropped%2 == 0
+	})
+	cfg := n.config()
+	cfg.RTO = 20 * time.Millisecond
+	res, err := Discover(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Mapping != EndpointIndependent || res.Filtering != EndpointIndependent {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestDiscover_ChangeRequestIgnored(t *testing.T) {
+	wan, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "0.0.0.0/0",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverNet, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{primaryIP, alternateIP}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientNet, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{publicIP}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, nw := range []*vnet.Net{serverNet, clientNet} {
+		if err = wan.AddNet(nw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = wan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer wan.Stop() //nolint:errcheck
+	conn, err := serverNet.ListenPacket("udp4", primaryIP+":3478")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint:errcheck
+	// Server advertises OTHER-ADDRESS, but always responds from the
+	// primary address.
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, readErr := conn.ReadFrom(buf)
+			if readErr != nil {
+				return
+			}
+			req := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+			if req.Decode() != nil {
+				continue
+			}
+			from := udpAddr(addr)
+			res, buildErr := stun.Build(req, stun.BindingSuccess,
+				&stun.XORMappedAddress{IP: from.IP, Port: from.Port},
+				&stun.OtherAddress{IP: net.ParseIP(alternateIP), Port: 3479},
+				stun.Fingerprint,
+			)
+			if buildErr != nil {
+				t.Error(buildErr)
+				return
+			}
+			if _, writeErr := conn.WriteTo(res.Raw, addr); writeErr != nil {
+				return
+			}
+		}
+	}()
+
+	res, err := Discover(&Config{
+		Server:  primaryIP + ":3478",
+		Timeout: testTimeout,
+		Net:     clientNet,
+	})
+	if !errors.Is(err, ErrChangeRequestIgnored) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if res.Filtering != BehaviorUnknown {
+		t.Errorf("Filtering = %s, want %s", res.Filtering, BehaviorUnknown)
+	}
+	last := res.Tests[len(res.Tests)-1]
+	if last.Name != FilteringTestII || !errors.Is(last.Err, ErrChangeRequestIgnored) {
+		t.Errorf("unexpected test %s", last)
+	}
+}
+
+func TestDiscoverHairpinning(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		filtering   vnet.EndpointDependencyType
+		noHairpin   bool
+		hairpinning bool
+	}{
+		{
+			name:        "Hairpinning",
+			filtering:   vnet.EndpointIndependent,
+			hairpinning: true,
+		},
+		{
+			name:      "NoHairpinning",
+			filtering: vnet.EndpointIndependent,
+			noHairpin: true,
+		},
+		{
+			// Hairpinned request comes from the public address of other
+			// socket, that was never contacted.
+			name:      "Filtered",
+			filtering: vnet.EndpointAddrPortDependent,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			n := newNetwork(t, &vnet.NATType{
+				MappingBehavior:   vnet.EndpointIndependent,
+				FilteringBehavior: tc.filtering,
+			})
+			if tc.noHairpin {
+				// NAT that does not hairpin drops packets from its public
+				// address to itself.
+				n.wan.AddChunkFilter(func(c vnet.Chunk) bool {
+					src, dst := udpAddr(c.SourceAddr()), udpAddr(c.DestinationAddr())
+					return src == nil || dst == nil || !src.IP.Equal(dst.IP)
+				})
+			}
+			res, err := DiscoverHairpinning(n.config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Hairpinning == nil || *res.Hairpinning != tc.hairpinning {
+				t.Errorf("Hairpinning = %v, want %v", res.Hairpinning, tc.hairpinning)
+			}
+			if !res.NAT || res.Mapping != BehaviorUnknown || res.Filtering != BehaviorUnknown {
+				t.Errorf("unexpected result %+v", res)
+			}
+			if len(res.Tests) != 2 {
+				t.Fatalf("unexpected tests %v", res.Tests)
+			}
+			test := res.Tests[1]
+			if test.Name != HairpinningTest || !equalAddr(test.Dst, res.PublicAddr) {
+				t.Errorf("unexpected test %s", test)
+			}
+			if !tc.hairpinning {
+				if !errors.Is(test.Err, ErrTimeout) {
+					t.Errorf("unexpected error %v", test.Err)
+				}
+				return
+			}
+			// Request is translated by NAT, so it comes from public IP.
+			if test.Err != nil || test.Origin == nil || !test.Origin.IP.Equal(net.ParseIP(publicIP)) {
+				t.Errorf("unexpected test %s", test)
+			}
+		})
+	}
+}
+
+func TestResult_MarshalJSON(t *testing.T) {
+	res := &Result{
+		Mapping:    EndpointIndependent,
+		Filtering:  AddressAndPortDependent,
+		NAT:        true,
+		LocalAddr:  &net.UDPAddr{IP: net.IPv4zero, Port: 5000},
+		PublicAddr: &net.UDPAddr{IP: net.ParseIP(publicIP), Port: 6000},
+		Tests: []Test{
+			{
+				Name:   MappingTestI,
+				Local:  &net.UDPAddr{IP: net.IPv4zero, Port: 5000},
+				Dst:    &net.UDPAddr{IP: net.ParseIP(primaryIP), Port: 3478},
+				Origin: &net.UDPAddr{IP: net.ParseIP(primaryIP), Port: 3478},
+				Mapped: &net.UDPAddr{IP: net.ParseIP(publicIP), Port: 6000},
+				RTT:    time.Millisecond,
+			},
+			{
+				Name:       FilteringTestII,
+				Local:      &net.UDPAddr{IP: net.IPv4zero, Port: 5001},
+				Dst:        &net.UDPAddr{IP: net.ParseIP(primaryIP), Port: 3478},
+				ChangeIP:   true,
+				ChangePort: true,
+				Err:        ErrTimeout,
+			},
+		},
+	}
+	// Value receiver, so both Result and *Result are marshaled the same.
+	b, err := json.Marshal(*res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"mapping":"endpoint-independent","filtering":"address-and-port-dependent",` +
+		`"nat":true,"local_address":"0.0.0.0:5000","public_address":"5.6.7.8:6000","hairpinning":null,` +
+		`"tests":[{"name":"mapping-1","local":"0.0.0.0:5000","dst":"1.2.3.4:3478","origin":"1.2.3.4:3478",` +
+		`"mapped":"5.6.7.8:6000","rtt":1000000},{"name":"filtering-2","local":"0.0.0.0:5001",` +
+		`"dst":"1.2.3.4:3478","change_ip":true,"change_port":true,"error":"timed out waiting for response"}]}`
+	if string(b) != want {
+		t.Errorf("unexpected JSON:\n%s\nwant:\n%s", b, want)
+	}
+	hairpinning := false
+	res.Hairpinning = &hairpinning
+	if b, err = json.Marshal(res); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"hairpinning":false`) {
+		t.Errorf("unexpected JSON %s", b)
+	}
+	if s := res.Tests[1].String(); s != "filtering-2: 0.0.0.0:5001 > 1.2.3.4:3478 change IP and port: timed out waiting for response" {
+		t.Errorf("unexpected string %q", s)
+	}
+	if s := Behavior(10).String(); s != "0xa" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
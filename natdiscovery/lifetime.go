@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package natdiscovery
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/pion/stun/v2"
+)
+
+// probeAttempts is the number of probes sent before binding is
+// considered expired.
+const probeAttempts = 3
+
+// LifetimeResult is the result of binding lifetime discovery.
+type LifetimeResult struct {
+	// Lifetime is the longest checked idle time after which binding was
+	// still alive, i.e. the lower bound of binding lifetime.
+	Lifetime time.Duration `json:"lifetime"`
+	// Expired is the shortest checked idle time after which binding had
+	// expired, i.e. the upper bound of binding lifetime. Zero means that
+	// binding outlived Config.MaxLifetime.
+	Expired time.Duration `json:"expired,omitempty"`
+	// Tests are performed tests in order.
+	Tests []Test `json:"tests"`
+}
+
+// DiscoverLifetime searches for the time of inactivity after which NAT
+// drops binding, checking the binding with requests that ask server to
+// respond to it from another socket via RESPONSE-PORT. The checked idle
+// times grow twice from cfg.LifetimePrecision until the binding expires
+// or cfg.MaxLifetime is reached, and then the lifetime is narrowed with
+// binary search. This takes a while, as every check waits for the idle
+// time.
+//
+// On error the partial result is returned together with the error.
+//
+// RFC 5780 Section 4.6.
+func DiscoverLifetime(cfg *Config) (*LifetimeResult, error) {
+	d, err := newDiscoverer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	res := new(LifetimeResult)
+	defer func() { res.Tests = d.tests }()
+	conn, err := d.listen()
+	if err != nil {
+		return res, err
+	}
+	defer conn.Close() //nolint:errcheck
+	probe, err := d.listen()
+	if err != nil {
+		return res, err
+	}
+	defer probe.Close() //nolint:errcheck
+
+	// Checking that server supports RESPONSE-PORT.
+	t, err := d.test(conn, LifetimeRefresh, d.server, stun.ChangeRequest{})
+	if err != nil {
+		return res, err
+	}
+	if _, err = d.do(conn, conn, Test{
+		Name:         ResponsePortTest,
+		Local:        t.Local,
+		Dst:          d.server,
+		ResponsePort: t.Mapped.Port,
+	}); err != nil {
+		return res, err
+	}
+
+	idle := d.precision
+	for {
+		alive, err := d.checkBinding(conn, probe, idle)
+		if err != nil {
+			return res, err
+		}
+		if alive {
+			res.Lifetime = idle
+		} else {
+			res.Expired = idle
+		}
+		switch {
+		case res.Expired == 0 && idle >= d.maxLifetime:
+			return res, nil
+		case res.Expired == 0:
+			if idle *= 2; idle > d.maxLifetime {
+				idle = d.maxLifetime
+			}
+		case res.Expired-res.Lifetime <= d.precision:
+			return res, nil
+		default:
+			idle = res.Lifetime + (res.Expired-res.Lifetime)/2
+		}
+	}
+}
+
+// checkBinding refreshes binding of conn, waits for idle time and reports
+// whether the response to request from probe still reaches conn via the
+// binding. Probe is repeated up to probeAttempts times, so single lost
+// packet is not taken for the expired binding.
+func (d *discoverer) checkBinding(conn, probe net.PacketConn, idle time.Duration) (bool, error) {
+	t, err := d.test(conn, LifetimeRefresh, d.server, stun.ChangeRequest{})
+	if err != nil {
+		return false, err
+	}
+	time.Sleep(idle)
+	for i := 0; i < probeAttempts; i++ {
+		_, err = d.do(probe, conn, Test{
+			Name:         LifetimeProbe,
+			Local:        udpAddr(probe.LocalAddr()),
+			Dst:          d.server,
+			ResponsePort: t.Mapped.Port,
+			Idle:         idle,
+		})
+		switch {
+		case err == nil:
+			return true, nil
+		case !errors.Is(err, ErrTimeout):
+			return false, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package natdiscovery
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v2"
+	"github.com/pion/transport/v3/vnet"
+)
+
+func TestDiscoverLifetime(t *testing.T) {
+	const (
+		lifetime  = 300 * time.Millisecond
+		precision = 50 * time.Millisecond
+	)
+	n := newNetwork(t, &vnet.NATType{
+		MappingBehavior:   vnet.EndpointIndependent,
+		FilteringBehavior: vnet.EndpointAddrPortDependent,
+		MappingLifeTime:   lifetime,
+	})
+	cfg := n.config()
+	cfg.MaxLifetime = time.Second
+	cfg.LifetimePrecision = precision
+	res, err := DiscoverLifetime(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Lifetime >= lifetime || res.Expired < lifetime-precision || res.Expired-res.Lifetime > precision {
+		t.Errorf("unexpected lifetime between %s and %s", res.Lifetime, res.Expired)
+	}
+	if len(res.Tests) < 2 || res.Tests[0].Name != LifetimeRefresh || res.Tests[1].Name != ResponsePortTest {
+		t.Fatalf("unexpected tests %v", res.Tests)
+	}
+	for _, test := range res.Tests[2:] {
+		if test.Name != LifetimeProbe {
+			continue
+		}
+		if alive := test.Err == nil; alive != (test.Idle <= res.Lifetime) {
+			t.Errorf("unexpected probe %s", test)
+		}
+	}
+}
+
+func TestDiscoverLifetime_Max(t *testing.T) {
+	n := newNetwork(t, nil)
+	cfg := n.config()
+	cfg.MaxLifetime = 150 * time.Millisecond
+	cfg.LifetimePrecision = 50 * time.Millisecond
+	res, err := DiscoverLifetime(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Lifetime != cfg.MaxLifetime || res.Expired != 0 {
+		t.Errorf("unexpected lifetime between %s and %s", res.Lifetime, res.Expired)
+	}
+	var idle []time.Duration
+	for _, test := range res.Tests {
+		if test.Name == LifetimeProbe {
+			idle = append(idle, test.Idle)
+		}
+	}
+	if len(idle) != 3 || idle[0] != 50*time.Millisecond || idle[1] != 100*time.Millisecond || idle[2] != 150*time.Millisecond {
+		t.Errorf("unexpected idle times %v", idle)
+	}
+}
+
+func TestDiscoverLifetime_ProbeLost(t *testing.T) {
+	n := newNetwork(t, nil)
+	var (
+		mux      sync.Mutex
+		requests int
+	)
+	// Dropping the first probe, which is the second request with
+	// RESPONSE-PORT after the check of its support.
+	n.wan.AddChunkFilter(func(c vnet.Chunk) bool {
+		m := &stun.Message{Raw: append([]byte{}, c.UserData()...)}
+		if m.Decode() != nil || !m.Contains(stun.AttrResponsePort) {
+			return true
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		requests++
+		return requests != 2
+	})
+	cfg := n.config()
+	cfg.MaxLifetime = 50 * time.Millisecond
+	cfg.LifetimePrecision = 50 * time.Millisecond
+	res, err := DiscoverLifetime(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Lifetime != cfg.MaxLifetime || res.Expired != 0 {
+		t.Errorf("unexpected lifetime between %s and %s", res.Lifetime, res.Expired)
+	}
+	var probes []Test
+	for _, test := range res.Tests {
+		if test.Name == LifetimeProbe {
+			probes = append(probes, test)
+		}
+	}
+	if len(probes) != 2 || !errors.Is(probes[0].Err, ErrTimeout) || probes[1].Err != nil {
+		t.Errorf("unexpected probes %v", probes)
+	}
+}
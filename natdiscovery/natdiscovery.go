@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package natdiscovery implements RFC 5780 NAT behavior discovery. It
+// determines the mapping and filtering behavior of NAT between the client
+// and a STUN server that supports OTHER-ADDRESS and CHANGE-REQUEST, and
+// checks whether NAT supports hairpinning.
+package natdiscovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	// ErrNoOtherAddress means that server does not support NAT behavior
+	// discovery.
+	ErrNoOtherAddress = errors.New("no OTHER-ADDRESS in response")
+	// ErrNoMappedAddress means that response has no XOR-MAPPED-ADDRESS.
+	ErrNoMappedAddress = errors.New("no XOR-MAPPED-ADDRESS in response")
+	// ErrUnexpectedResponse means that server responded with error or
+	// with message of unexpected type.
+	ErrUnexpectedResponse = errors.New("unexpected response")
+	// ErrChangeRequestIgnored means that server responded to request
+	// with CHANGE-REQUEST from the address request was sent to.
+	ErrChangeRequestIgnored = errors.New("server ignored CHANGE-REQUEST")
+	// ErrTimeout means that no response was received in time.
+	ErrTimeout = errors.New("timed out waiting for response")
+)
+
+// Behavior is NAT mapping or filtering behavior.
+//
+// RFC 4787 Sections 4.1 and 5.
+type Behavior byte
+
+// Possible behaviors.
+const (
+	// BehaviorUnknown means that tests were inconclusive.
+	BehaviorUnknown Behavior = iota
+	EndpointIndependent
+	AddressDependent
+	AddressAndPortDependent
+)
+
+var behaviorNames = map[Behavior]string{ //nolint:gochecknoglobals
+	BehaviorUnknown:         "unknown",
+	EndpointIndependent:     "endpoint-independent",
+	AddressDependent:        "address-dependent",
+	AddressAndPortDependent: "address-and-port-dependent",
+}
+
+func (b Behavior) String() string {
+	if s, ok := behaviorNames[b]; ok {
+		return s
+	}
+	return fmt.Sprintf("0x%x", byte(b))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Behavior) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// Test names of Result.Tests.
+const (
+	MappingTestI     = "mapping-1"
+	MappingTestII    = "mapping-2"
+	MappingTestIII   = "mapping-3"
+	FilteringTestI   = "filtering-1"
+	FilteringTestII  = "filtering-2"
+	FilteringTestIII = "filtering-3"
+	HairpinningTest  = "hairpinning"
+	ResponsePortTest = "response-port"
+	LifetimeRefresh  = "lifetime-refresh"
+	LifetimeProbe    = "lifetime-probe"
+)
+
+// Test is the evidence of single request of discovery.
+type Test struct {
+	Name string
+	// Local is the address request was sent from, Dst is the address it
+	// was sent to.
+	Local *net.UDPAddr
+	Dst   *net.UDPAddr
+	// ChangeIP and ChangePort are flags of CHANGE-REQUEST.
+	ChangeIP   bool
+	ChangePort bool
+	// ResponsePort is the value of RESPONSE-PORT, zero if not set.
+	ResponsePort int
+	// Idle is the time binding was idle before request was sent.
+	Idle time.Duration
+	// Origin is the source address of response, and Mapped is its
+	// XOR-MAPPED-ADDRESS. Both are nil if there was no response.
+	Origin *net.UDPAddr
+	Mapped *net.UDPAddr
+	RTT    time.Duration
+	// Err is ErrTimeout if there was no response.
+	Err error
+}
+
+func (t Test) String() string {
+	s := fmt.Sprintf("%s: %s > %s", t.Name, t.Local, t.Dst)
+	switch {
+	case t.ChangeIP && t.ChangePort:
+		s += " change IP and port"
+	case t.ChangeIP:
+		s += " change IP"
+	case t.ChangePort:
+		s += " change port"
+	}
+	if t.ResponsePort != 0 {
+		s += fmt.Sprintf(" response port %d", t.ResponsePort)
+	}
+	if t.Idle != 0 {
+		s += fmt.Sprintf(" after %s idle", t.Idle)
+	}
+	if t.Err != nil {
+		return s + ": " + t.Err.Error()
+	}
+	s += fmt.Sprintf(": received from %s in %s", t.Origin, t.RTT)
+	if t.Mapped != nil {
+		s += ", mapped " + t.Mapped.String()
+	}
+	return s
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t Test) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Name         string        `json:"name"`
+		Local        string        `json:"local"`
+		Dst          string        `json:"dst"`
+		ChangeIP     bool          `json:"change_ip,omitempty"`
+		ChangePort   bool          `json:"change_port,omitempty"`
+		ResponsePort int           `json:"response_port,omitempty"`
+		Idle         time.Duration `json:"idle,omitempty"`
+		Origin       string        `json:"origin,omitempty"`
+		Mapped       string        `json:"mapped,omitempty"`
+		RTT          time.Duration `json:"rtt,omitempty"`
+		Error        string        `json:"error,omitempty"`
+	}{
+		Name:         t.Name,
+		Local:        addrString(t.Local),
+		Dst:          addrString(t.Dst),
+		ChangeIP:     t.ChangeIP,
+		ChangePort:   t.ChangePort,
+		ResponsePort: t.ResponsePort,
+		Idle:         t.Idle,
+		Origin:       addrString(t.Origin),
+		Mapped:       addrString(t.Mapped),
+		RTT:          t.RTT,
+	}
+	if t.Err != nil {
+		v.Error = t.Err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// Result of NAT behavior discovery.
+type Result struct {
+	Mapping   Behavior
+	Filtering Behavior
+	// NAT is false if the public address is the local one.
+	NAT bool
+	// LocalAddr is the address of socket used for mapping tests and
+	// PublicAddr is its XOR-MAPPED-ADDRESS reported by server.
+	LocalAddr  *net.UDPAddr
+	PublicAddr *net.UDPAddr
+	// Hairpinning reports whether request sent from another local socket
+	// to PublicAddr was received. It is nil if hairpinning was not checked
+	// or the check failed.
+	Hairpinning *bool
+	// Tests are performed tests in order.
+	Tests []Test
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Mapping     Behavior `json:"mapping"`
+		Filtering   Behavior `json:"filtering"`
+		NAT         bool     `json:"nat"`
+		LocalAddr   string   `json:"local_address,omitempty"`
+		PublicAddr  string   `json:"public_address,omitempty"`
+		Hairpinning *bool    `json:"hairpinning"`
+		Tests       []Test   `json:"tests"`
+	}{
+		Mapping:     r.Mapping,
+		Filtering:   r.Filtering,
+		NAT:         r.NAT,
+		LocalAddr:   addrString(r.LocalAddr),
+		PublicAddr:  addrString(r.PublicAddr),
+		Hairpinning: r.Hairpinning,
+		Tests:       r.Tests,
+	})
+}
+
+// DirectConnectivity reports whether peers are likely to establish direct
+// connection through this NAT with hole punching, i.e. whether NAT has
+// endpoint-independent mapping.
+//
+// RFC 4787 Section 4.1, REQ-1.
+func (r *Result) DirectConnectivity() bool {
+	return r.Mapping == EndpointIndependent
+}
+
+func addrString(a *net.UDPAddr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package pcap
+
+import (
+	"net"
+	"time"
+)
+
+// network returns "udp" or "tcp" depending on type of addr.
+func network(addr net.Addr) string {
+	if _, ok := addr.(*net.TCPAddr); ok {
+		return "tcp"
+	}
+	return "udp"
+}
+
+// packetConn is net.PacketConn that writes traffic to capture.
+type packetConn struct {
+	net.PacketConn
+	w *Writer
+}
+
+// WrapPacketConn returns net.PacketConn that writes datagrams that are
+// sent and received over conn to w. Capture errors are ignored.
+func WrapPacketConn(conn net.PacketConn, w *Writer) net.PacketConn {
+	return &packetConn{PacketConn: conn, w: w}
+}
+
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	if n > 0 {
+		_ = c.w.WritePacket(time.Now(), FiveTuple{Network: "udp", Src: addr, Dst: c.LocalAddr()}, b[:n])
+	}
+	return n, addr, err
+}
+
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(b, addr)
+	if n > 0 {
+		_ = c.w.WritePacket(time.Now(), FiveTuple{Network: "udp", Src: c.LocalAddr(), Dst: addr}, b[:n])
+	}
+	return n, err
+}
+
+// conn is net.Conn that writes traffic to capture.
+type conn struct {
+	net.Conn
+	w *Writer
+}
+
+// WrapConn returns net.Conn that writes data that is sent and received
+// over UDP or TCP connection c to w, e.g. to capture traffic of
+// stun.Client. Capture errors are ignored.
+func WrapConn(c net.Conn, w *Writer) net.Conn {
+	return &conn{Conn: c, w: w}
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		_ = c.w.WritePacket(time.Now(), FiveTuple{
+			Network: network(c.LocalAddr()),
+			Src:     c.RemoteAddr(),
+			Dst:     c.LocalAddr(),
+		}, b[:n])
+	}
+	return n, err
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		_ = c.w.WritePacket(time.Now(), FiveTuple{
+			Network: network(c.LocalAddr()),
+			Src:     c.LocalAddr(),
+			Dst:     c.RemoteAddr(),
+		}, b[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Ether types and IP protocol numbers.
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86DD
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88A8
+
+	protoTCP = 6
+	protoUDP = 17
+
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	udpHeaderSize  = 8
+	tcpHeaderSize  = 20
+
+	// maxIPPayload is the maximum size of UDP datagram or TCP segment that
+	// fits into both IPv4 and IPv6 packet.
+	maxIPPayload = 0xFFFF - ipv4HeaderSize
+)
+
+// TCP flags.
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// segment is decoded UDP datagram or TCP segment.
+type segment struct {
+	tuple   FiveTuple
+	seq     uint32
+	flags   byte
+	payload []byte
+}
+
+// linkPayload returns IP packet of frame b with link type link.
+func linkPayload(link uint32, b []byte) ([]byte, bool) {
+	switch link {
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		return b, true
+	case LinkTypeNull:
+		// Address family in host byte order, IP version is checked later.
+		if len(b) < 4 {
+			return nil, false
+		}
+		return b[4:], true
+	case LinkTypeEthernet:
+		if len(b) < 14 {
+			return nil, false
+		}
+		etherType, b := binary.BigEndian.Uint16(b[12:14]), b[14:]
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(b) < 4 {
+				return nil, false
+			}
+			etherType, b = binary.BigEndian.Uint16(b[2:4]), b[4:]
+		}
+		return b, etherType == etherTypeIPv4 || etherType == etherTypeIPv6
+	case LinkTypeLinuxSLL:
+		if len(b) < 16 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(b[14:16])
+		return b[16:], etherType == etherTypeIPv4 || etherType == etherTypeIPv6
+	case LinkTypeLinuxSLL2:
+		if len(b) < 20 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(b[0:2])
+		return b[20:], etherType == etherTypeIPv4 || etherType == etherTypeIPv6
+	default:
+		return nil, false
+	}
+}
+
+// decodeIP decodes UDP or TCP segment from IP packet b. Fragmented
+// packets are not supported.
+func decodeIP(b []byte) (segment, bool) {
+	if len(b) == 0 {
+		return segment{}, false
+	}
+	var (
+		proto    byte
+		src, dst net.IP
+	)
+	switch b[0] >> 4 {
+	case 4:
+		if len(b) < ipv4HeaderSize {
+			return segment{}, false
+		}
+		headerSize := int(b[0]&0x0F) * 4
+		total := int(binary.BigEndian.Uint16(b[2:4]))
+		if headerSize < ipv4HeaderSize || total < headerSize || len(b) < headerSize {
+			return segment{}, false
+		}
+		if flags := binary.BigEndian.Uint16(b[6:8]); flags&0x3FFF != 0 {
+			// More fragments flag or fragment offset is set.
+			return segment{}, false
+		}
+		if total < len(b) {
+			// Trimming Ethernet padding.
+			b = b[:total]
+		}
+		proto = b[9]
+		src, dst = net.IP(b[12:16]), net.IP(b[16:20])
+		b = b[headerSize:]
+	case 6:
+		if len(b) < ipv6HeaderSize {
+			return segment{}, false
+		}
+		if total := ipv6HeaderSize + int(binary.BigEndian.Uint16(b[4:6])); total < len(b) {
+			b = b[:total]
+		}
+		proto = b[6]
+		src, dst = net.IP(b[8:24]), net.IP(b[24:40])
+		b = b[ipv6HeaderSize:]
+		// Skipping Hop-by-Hop, Routing and Destination Options headers.
+		for proto == 0 || proto == 43 || proto == 60 {
+			if len(b) < 8 {
+				return segment{}, false
+			}
+			size := (int(b[1]) + 1) * 8
+			if len(b) < size {
+				return segment{}, false
+			}
+			proto, b = b[0], b[size:]
+		}
+	default:
+		return segment{}, false
+	}
+	// Copying addresses, as b can be reused by reader.
+	src = append(net.IP(nil), src...)
+	dst = append(net.IP(nil), dst...)
+	switch proto {
+	case protoUDP:
+		if len(b) < udpHeaderSize {
+			return segment{}, false
+		}
+		return segment{
+			tuple:   newTuple("udp", src, int(binary.BigEndian.Uint16(b[0:2])), dst, int(binary.BigEndian.Uint16(b[2:4]))),
+			payload: b[udpHeaderSize:],
+		}, true
+	case protoTCP:
+		if len(b) < tcpHeaderSize {
+			return segment{}, false
+		}
+		headerSize := int(b[12]>>4) * 4
+		if headerSize < tcpHeaderSize || len(b) < headerSize {
+			return segment{}, false
+		}
+		return segment{
+			tuple:   newTuple("tcp", src, int(binary.BigEndian.Uint16(b[0:2])), dst, int(binary.BigEndian.Uint16(b[2:4]))),
+			seq:     binary.BigEndian.Uint32(b[4:8]),
+			flags:   b[13],
+			payload: b[headerSize:],
+		}, true
+	default:
+		return segment{}, false
+	}
+}
+
+// encodeIP appends IP packet with UDP or TCP segment s to b. Addresses of
+// s must be of the same family.
+func encodeIP(b []byte, s segment) ([]byte, error) {
+	srcIP, srcPort, err := ipPort(s.tuple.Src)
+	if err != nil {
+		return b, err
+	}
+	dstIP, dstPort, err := ipPort(s.tuple.Dst)
+	if err != nil {
+		return b, err
+	}
+	proto, transportSize := byte(protoUDP), udpHeaderSize
+	if s.tuple.Network == "tcp" {
+		proto, transportSize = protoTCP, tcpHeaderSize
+	}
+	length := transportSize + len(s.payload)
+	if length > maxIPPayload {
+		return b, ErrPacketTooLarge
+	}
+	start := len(b)
+	if src4, dst4 := srcIP.To4(), dstIP.To4(); src4 != nil && dst4 != nil {
+		srcIP, dstIP = src4, dst4
+		b = append(b, make([]byte, ipv4HeaderSize)...)
+		h := b[start:]
+		h[0] = 0x45 // Version 4, 5 words header.
+		binary.BigEndian.PutUint16(h[2:4], uint16(ipv4HeaderSize+length))
+		h[6] = 0x40 // Don't fragment.
+		h[8] = 64   // TTL.
+		h[9] = proto
+		copy(h[12:16], srcIP)
+		copy(h[16:20], dstIP)
+		binary.BigEndian.PutUint16(h[10:12], ^fold(sum(0, h[:ipv4HeaderSize])))
+	} else {
+		if srcIP, dstIP = srcIP.To16(), dstIP.To16(); srcIP == nil || dstIP == nil {
+			return b, fmt.Errorf("%w: %s", ErrUnsupportedNetwork, s.tuple)
+		}
+		b = append(b, make([]byte, ipv6HeaderSize)...)
+		h := b[start:]
+		h[0] = 0x60 // Version 6.
+		binary.BigEndian.PutUint16(h[4:6], uint16(length))
+		h[6] = proto
+		h[7] = 64 // Hop limit.
+		copy(h[8:24], srcIP)
+		copy(h[24:40], dstIP)
+	}
+	start = len(b)
+	b = append(b, make([]byte, transportSize)...)
+	b = append(b, s.payload...)
+	h := b[start:]
+	binary.BigEndian.PutUint16(h[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(h[2:4], uint16(dstPort))
+	checksumOffset := 6
+	if proto == protoUDP {
+		binary.BigEndian.PutUint16(h[4:6], uint16(length))
+	} else {
+		binary.BigEndian.PutUint32(h[4:8], s.seq)
+		h[12] = (tcpHeaderSize / 4) << 4
+		h[13] = s.flags
+		binary.BigEndian.PutUint16(h[14:16], 65535) // Window.
+		checksumOffset = 16
+	}
+	// Pseudo-header checksum, RFC 768 and RFC 8200 Section 8.1.
+	var pseudo [4]byte
+	binary.BigEndian.PutUint16(pseudo[0:2], uint16(proto))
+	binary.BigEndian.PutUint16(pseudo[2:4], uint16(length))
+	checksum := ^fold(sum(sum(sum(sum(0, srcIP), dstIP), pseudo[:]), h))
+	if checksum == 0 && proto == protoUDP {
+		// Zero means no checksum for UDP.
+		checksum = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(h[checksumOffset:checksumOffset+2], checksum)
+	return b, nil
+}
+
+// sum adds b as 16-bit big endian words to one's complement sum c.
+func sum(c uint32, b []byte) uint32 {
+	for ; len(b) >= 2; b = b[2:] {
+		c += uint32(binary.BigEndian.Uint16(b))
+	}
+	if len(b) == 1 {
+		c += uint32(b[0]) << 8
+	}
+	return c
+}
+
+// fold folds 32-bit one's complement sum into 16 bits.
+func fold(c uint32) uint16 {
+	for c > 0xFFFF {
+		c = (c >> 16) + (c & 0xFFFF)
+	}
+	return uint16(c)
+}
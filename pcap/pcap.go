@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package pcap reads STUN and ChannelData messages from pcap and pcapng
+// captures and writes traffic to pcap files that can be opened by
+// Wireshark or tcpdump.
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/stun/v2"
+)
+
+// Link types of captured packets.
+//
+// https://www.tcpdump.org/linktypes.html
+const (
+	LinkTypeNull      uint32 = 0
+	LinkTypeEthernet  uint32 = 1
+	LinkTypeRaw       uint32 = 101
+	LinkTypeLinuxSLL  uint32 = 113
+	LinkTypeIPv4      uint32 = 228
+	LinkTypeIPv6      uint32 = 229
+	LinkTypeLinuxSLL2 uint32 = 276
+)
+
+var (
+	// ErrUnknownFormat means that input is neither pcap nor pcapng capture.
+	ErrUnknownFormat = errors.New("unknown capture format")
+	// ErrBadBlock means that pcapng block or pcap record is malformed.
+	ErrBadBlock = errors.New("malformed capture block")
+	// ErrUnsupportedNetwork means that address is neither UDP nor TCP, or
+	// addresses of packet are of different families.
+	ErrUnsupportedNetwork = errors.New("unsupported network")
+	// ErrPacketTooLarge means that packet does not fit into IP packet.
+	ErrPacketTooLarge = errors.New("packet is too large")
+)
+
+// FiveTuple identifies the flow of packet.
+type FiveTuple struct {
+	// Network is "udp" or "tcp".
+	Network string
+	// Src and Dst are *net.UDPAddr or *net.TCPAddr, depending on Network.
+	Src net.Addr
+	Dst net.Addr
+}
+
+func (t FiveTuple) String() string {
+	return fmt.Sprintf("%s %s > %s", t.Network, t.Src, t.Dst)
+}
+
+// Packet is STUN or ChannelData message found in capture.
+type Packet struct {
+	Time  time.Time
+	Tuple FiveTuple
+	// Exactly one of Message and ChannelData is set.
+	Message     *stun.Message
+	ChannelData *stun.ChannelData
+}
+
+// newTuple returns tuple of flow from src to dst over network.
+func newTuple(network string, srcIP net.IP, srcPort int, dstIP net.IP, dstPort int) FiveTuple {
+	if network == "tcp" {
+		return FiveTuple{
+			Network: network,
+			Src:     &net.TCPAddr{IP: srcIP, Port: srcPort},
+			Dst:     &net.TCPAddr{IP: dstIP, Port: dstPort},
+		}
+	}
+	return FiveTuple{
+		Network: network,
+		Src:     &net.UDPAddr{IP: srcIP, Port: srcPort},
+		Dst:     &net.UDPAddr{IP: dstIP, Port: dstPort},
+	}
+}
+
+// ipPort returns IP and port of UDP or TCP address.
+func ipPort(addr net.Addr) (net.IP, int, error) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP, a.Port, nil
+	case *net.TCPAddr:
+		return a.IP, a.Port, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnsupportedNetwork, addr)
+	}
+}
@@ -0,0 +1,435 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v2"
+)
+
+var (
+	client4 = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+	server4 = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 3478}
+	client6 = &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000}
+	server6 = &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 3478}
+	tcpA    = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5001}
+	tcpB    = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 3478}
+)
+
+func readAll(t *testing.T, r io.Reader) []*Packet {
+	t.Helper()
+	c, err := NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packets []*Packet
+	for {
+		p, err := c.Next()
+		if errors.Is(err, io.EOF) {
+			return packets
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, p)
+	}
+}
+
+func checkMessage(t *testing.T, p *Packet, m *stun.Message, tuple FiveTuple) {
+	t.Helper()
+	if p.Message == nil {
+		t.Fatalf("expected message, got %+v", p)
+	}
+	if !bytes.Equal(p.Message.Raw, m.Raw) || p.Message.Type != m.Type {
+		t.Errorf("unexpected message %s", p.Message)
+	}
+	if p.Tuple.String() != tuple.String() {
+		t.Errorf("unexpected tuple %s", p.Tuple)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var (
+		buf      bytes.Buffer
+		start    = time.Unix(1700000000, 123456789)
+		req      = stun.MustBuild(stun.TransactionID, stun.BindingRequest, stun.Fingerprint)
+		res      = stun.MustBuild(req, stun.BindingSuccess, &stun.XORMappedAddress{IP: client6.IP, Port: 5000})
+		udp4     = FiveTuple{Network: "udp", Src: client4, Dst: server4}
+		udp6     = FiveTuple{Network: "udp", Src: server6, Dst: client6}
+		tcp      = FiveTuple{Network: "tcp", Src: tcpA, Dst: tcpB}
+		data     = &stun.ChannelData{Number: 0x4000, Data: []byte{1, 2, 3}}
+		framed   = append([]byte{0, byte(len(req.Raw))}, req.Raw...)
+		combined = append(append([]byte(nil), req.Raw...), res.Raw...)
+	)
+	data.Encode()
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range []struct {
+		tuple   FiveTuple
+		payload []byte
+	}{
+		{udp4, req.Raw},
+		{udp6, res.Raw},
+		{udp4, []byte("not a STUN message")},
+		{udp4, data.Raw},
+		// Message split between segments.
+		{tcp, req.Raw[:10]},
+		{tcp, req.Raw[10:]},
+		// Multiple messages in one segment.
+		{tcp, combined},
+	} {
+		if err = w.WritePacket(start.Add(time.Duration(i)*time.Millisecond), p.tuple, p.payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.WriteMessage(start, FiveTuple{Network: "tcp", Src: tcpB, Dst: tcpA}, res); err != nil {
+		t.Fatal(err)
+	}
+	// RFC 4571 framing.
+	if err = w.WritePacket(start, FiveTuple{Network: "tcp", Src: tcpA, Dst: &net.TCPAddr{IP: tcpB.IP, Port: 3479}}, framed); err != nil {
+		t.Fatal(err)
+	}
+
+	packets := readAll(t, bytes.NewReader(buf.Bytes()))
+	if len(packets) != 8 {
+		t.Fatalf("unexpected count %d", len(packets))
+	}
+	checkMessage(t, packets[0], req, udp4)
+	if !packets[0].Time.Equal(start) {
+		t.Errorf("unexpected time %s", packets[0].Time)
+	}
+	checkMessage(t, packets[1], res, udp6)
+	if d := packets[2].ChannelData; d == nil || d.Number != 0x4000 || !bytes.Equal(d.Data, data.Data) {
+		t.Errorf("unexpected ChannelData %+v", packets[2])
+	}
+	checkMessage(t, packets[3], req, tcp)
+	if !packets[3].Time.Equal(start.Add(5 * time.Millisecond)) {
+		t.Errorf("unexpected time %s", packets[3].Time)
+	}
+	checkMessage(t, packets[4], req, tcp)
+	checkMessage(t, packets[5], res, tcp)
+	checkMessage(t, packets[6], res, FiveTuple{Network: "tcp", Src: tcpB, Dst: tcpA})
+	checkMessage(t, packets[7], req, FiveTuple{Network: "tcp", Src: tcpA, Dst: &net.TCPAddr{IP: tcpB.IP, Port: 3479}})
+
+	t.Run("Errors", func(t *testing.T) {
+		if err := w.WritePacket(start, FiveTuple{Network: "udp", Src: client4, Dst: &net.IPAddr{}}, nil); !errors.Is(err, ErrUnsupportedNetwork) {
+			t.Errorf("unexpected error %v", err)
+		}
+		if err := w.WritePacket(start, udp4, make([]byte, 0xFFFF)); !errors.Is(err, ErrPacketTooLarge) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+func TestWriter_Checksum(t *testing.T) {
+	for _, tuple := range []FiveTuple{
+		{Network: "udp", Src: client4, Dst: server4},
+		{Network: "udp", Src: client6, Dst: server6},
+		{Network: "tcp", Src: tcpA, Dst: tcpB},
+	} {
+		// Odd size to check padding.
+		b, err := encodeIP(nil, segment{tuple: tuple, payload: []byte{1, 2, 3, 4, 5}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			pseudo       [4]byte
+			ip, payload  []byte
+			proto        = b[9]
+			headerSize   = ipv4HeaderSize
+			srcIP, dstIP = b[12:16], b[16:20]
+		)
+		if b[0]>>4 == 6 {
+			proto, headerSize = b[6], ipv6HeaderSize
+			srcIP, dstIP = b[8:24], b[24:40]
+		} else if fold(sum(0, b[:ipv4HeaderSize])) != 0xFFFF {
+			t.Errorf("%s: bad IPv4 header checksum", tuple)
+		}
+		ip, payload = b[:headerSize], b[headerSize:]
+		binary.BigEndian.PutUint16(pseudo[0:2], uint16(proto))
+		binary.BigEndian.PutUint16(pseudo[2:4], uint16(len(payload)))
+		if fold(sum(sum(sum(sum(0, srcIP), dstIP), pseudo[:]), payload)) != 0xFFFF {
+			t.Errorf("%s: bad checksum of %x", tuple, ip)
+		}
+	}
+}
+
+func append16(o binary.ByteOrder, b []byte, v uint16) []byte {
+	var buf [2]byte
+	o.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func append32(o binary.ByteOrder, b []byte, v uint32) []byte {
+	var buf [4]byte
+	o.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// ngBlock returns pcapng block of type t with body in byte order o.
+func ngBlock(o binary.ByteOrder, t uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	size := uint32(len(body) + 12)
+	b := make([]byte, 8, size)
+	o.PutUint32(b[0:4], t)
+	o.PutUint32(b[4:8], size)
+	b = append(b, body...)
+	return append(b, append32(o, nil, size)...)
+}
+
+func ipPacket(t *testing.T, m *stun.Message) []byte {
+	t.Helper()
+	b, err := encodeIP(nil, segment{
+		tuple:   FiveTuple{Network: "udp", Src: client4, Dst: server4},
+		payload: m.Raw,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestReader_PCAPNG(t *testing.T) {
+	var (
+		m    = stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+		ip   = ipPacket(t, m)
+		be   = binary.BigEndian
+		le   = binary.LittleEndian
+		udp4 = FiveTuple{Network: "udp", Src: client4, Dst: server4}
+		buf  bytes.Buffer
+	)
+	// Big endian section with Ethernet interface with nanosecond
+	// resolution and VLAN tagged frame.
+	shb := func(o binary.ByteOrder) []byte {
+		body := append32(o, nil, ngByteOrder)
+		body = append16(o, body, 1)
+		body = append16(o, body, 0)
+		return ngBlock(o, ngSectionBlock, append(body, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF))
+	}
+	idb := func(o binary.ByteOrder, link uint16, options ...byte) []byte {
+		body := append16(o, nil, link)
+		body = append16(o, body, 0)
+		body = append32(o, body, 0)
+		return ngBlock(o, ngInterfaceBlock, append(body, options...))
+	}
+	epb := func(o binary.ByteOrder, id uint32, ts uint64, frame []byte) []byte {
+		body := append32(o, nil, id)
+		body = append32(o, body, uint32(ts>>32))
+		body = append32(o, body, uint32(ts))
+		body = append32(o, body, uint32(len(frame)))
+		body = append32(o, body, uint32(len(frame)))
+		return ngBlock(o, ngEnhancedPacketBlock, append(body, frame...))
+	}
+	ethernet := []byte{
+		0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 6, // MAC addresses.
+		0x81, 0x00, 0x00, 0x01, // VLAN tag.
+		0x08, 0x00, // IPv4.
+	}
+	buf.Write(shb(be))
+	// if_tsresol of 9, then end of options.
+	buf.Write(idb(be, uint16(LinkTypeEthernet), 0, 9, 0, 1, 9, 0, 0, 0, 0, 0, 0, 0))
+	buf.Write(ngBlock(be, 0xBAD, []byte{1, 2, 3}))
+	buf.Write(epb(be, 0, 1700000000123456789, append(ethernet, ip...)))
+	// Little endian section with Linux cooked interfaces with default
+	// resolution.
+	sll := make([]byte, 16)
+	binary.BigEndian.PutUint16(sll[14:16], etherTypeIPv4)
+	sll2 := make([]byte, 20)
+	binary.BigEndian.PutUint16(sll2[0:2], etherTypeIPv4)
+	buf.Write(shb(le))
+	buf.Write(idb(le, uint16(LinkTypeLinuxSLL)))
+	buf.Write(idb(le, uint16(LinkTypeLinuxSLL2)))
+	buf.Write(epb(le, 1, 1700000000123456, append(sll2, ip...)))
+	spb := append32(le, nil, uint32(len(sll)+len(ip)))
+	buf.Write(ngBlock(le, ngSimplePacketBlock, append(append(spb, sll...), ip...)))
+
+	packets := readAll(t, &buf)
+	if len(packets) != 3 {
+		t.Fatalf("unexpected count %d", len(packets))
+	}
+	for _, p := range packets {
+		checkMessage(t, p, m, udp4)
+	}
+	if !packets[0].Time.Equal(time.Unix(1700000000, 123456789)) {
+		t.Errorf("unexpected time %s", packets[0].Time)
+	}
+	if !packets[1].Time.Equal(time.Unix(1700000000, 123456000)) {
+		t.Errorf("unexpected time %s", packets[1].Time)
+	}
+	if !packets[2].Time.IsZero() {
+		t.Errorf("unexpected time %s", packets[2].Time)
+	}
+
+	t.Run("UnknownInterface", func(t *testing.T) {
+		b := append(shb(le), epb(le, 0, 0, ip)...)
+		if _, err := NewReader(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+		c, _ := NewReader(bytes.NewReader(b))
+		if _, err := c.Next(); !errors.Is(err, ErrBadBlock) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("Truncated", func(t *testing.T) {
+		b := append(shb(le), idb(le, uint16(LinkTypeRaw))...)
+		b = append(b, epb(le, 0, 0, ip)...)
+		c, err := NewReader(bytes.NewReader(b[:len(b)-1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = c.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+func TestReader_PCAP(t *testing.T) {
+	m := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	// Big endian capture with microsecond resolution and BSD loopback
+	// link type.
+	frame := append([]byte{0, 0, 0, 2}, ipPacket(t, m)...)
+	b := make([]byte, 24, 64)
+	binary.BigEndian.PutUint32(b[0:4], pcapMagic)
+	binary.BigEndian.PutUint32(b[20:24], LinkTypeNull)
+	b = append32(binary.BigEndian, b, 1700000000)
+	b = append32(binary.BigEndian, b, 123456)
+	b = append32(binary.BigEndian, b, uint32(len(frame)))
+	b = append32(binary.BigEndian, b, uint32(len(frame)))
+	b = append(b, frame...)
+
+	packets := readAll(t, bytes.NewReader(b))
+	if len(packets) != 1 {
+		t.Fatalf("unexpected count %d", len(packets))
+	}
+	checkMessage(t, packets[0], m, FiveTuple{Network: "udp", Src: client4, Dst: server4})
+	if !packets[0].Time.Equal(time.Unix(1700000000, 123456000)) {
+		t.Errorf("unexpected time %s", packets[0].Time)
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		c, err := NewReader(bytes.NewReader(b[:len(b)-1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = c.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("UnknownFormat", func(t *testing.T) {
+		for _, b := range [][]byte{nil, []byte("not a capture"), make([]byte, 24)} {
+			if _, err := NewReader(bytes.NewReader(b)); !errors.Is(err, ErrUnknownFormat) {
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+	})
+}
+
+func TestReader_TCP(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		// Zero transaction id, so the second half of a is not a message.
+		a     = stun.MustBuild(stun.NewTransactionIDSetter([stun.TransactionIDSize]byte{}), stun.BindingRequest)
+		b     = stun.MustBuild(stun.TransactionID, stun.BindingRequest, stun.NewSoftware("b"))
+		tuple = FiveTuple{Network: "tcp", Src: tcpA, Dst: tcpB}
+	)
+	if _, err := NewWriter(&buf); err != nil {
+		t.Fatal(err)
+	}
+	write := func(seq uint32, flags byte, payload []byte) {
+		t.Helper()
+		ip, err := encodeIP(nil, segment{tuple: tuple, seq: seq, flags: flags, payload: payload})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var header [16]byte
+		binary.LittleEndian.PutUint32(header[8:12], uint32(len(ip)))
+		binary.LittleEndian.PutUint32(header[12:16], uint32(len(ip)))
+		buf.Write(header[:])
+		buf.Write(ip)
+	}
+	size := uint32(len(a.Raw))
+	write(100, tcpSYN, nil)
+	write(101, tcpACK, a.Raw[:10])
+	// Retransmission with more data.
+	write(101, tcpACK, a.Raw)
+	// Retransmission of processed data.
+	write(101, tcpACK, a.Raw[:10])
+	// Segment is lost, data after it is not a message start.
+	write(101+2*size, tcpACK, a.Raw[10:])
+	write(101+3*size-10, tcpACK, b.Raw)
+	write(101+3*size-10+uint32(len(b.Raw)), tcpFIN|tcpACK, nil)
+
+	packets := readAll(t, &buf)
+	if len(packets) != 2 {
+		t.Fatalf("unexpected count %d", len(packets))
+	}
+	checkMessage(t, packets[0], a, tuple)
+	checkMessage(t, packets[1], b, tuple)
+}
+
+func TestWrapConn(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close() //nolint:errcheck
+	server = WrapPacketConn(server, w)
+	client, err := net.Dial("udp4", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() //nolint:errcheck
+	client = WrapConn(client, w)
+
+	var (
+		req = stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+		res = stun.MustBuild(req, stun.BindingSuccess)
+		b   = make([]byte, 1024)
+	)
+	if _, err = client.Write(req.Raw); err != nil {
+		t.Fatal(err)
+	}
+	_, addr, err := server.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = server.WriteTo(res.Raw, addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Read(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		toServer = FiveTuple{Network: "udp", Src: client.LocalAddr(), Dst: server.LocalAddr()}
+		toClient = FiveTuple{Network: "udp", Src: server.LocalAddr(), Dst: client.LocalAddr()}
+	)
+	packets := readAll(t, &buf)
+	if len(packets) != 4 {
+		t.Fatalf("unexpected count %d", len(packets))
+	}
+	checkMessage(t, packets[0], req, toServer)
+	checkMessage(t, packets[1], req, toServer)
+	checkMessage(t, packets[2], res, toClient)
+	checkMessage(t, packets[3], res, toClient)
+}
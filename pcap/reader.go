@@ -0,0 +1,444 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/pion/stun/v2"
+)
+
+// Magic numbers of capture formats.
+const (
+	pcapMagic      uint32 = 0xA1B2C3D4
+	pcapMagicNano  uint32 = 0xA1B23C4D
+	ngSectionBlock uint32 = 0x0A0D0D0A
+	ngByteOrder    uint32 = 0x1A2B3C4D
+)
+
+// pcapng block types.
+const (
+	ngInterfaceBlock      uint32 = 0x00000001
+	ngSimplePacketBlock   uint32 = 0x00000003
+	ngEnhancedPacketBlock uint32 = 0x00000006
+)
+
+// maxBlockSize limits the size of pcapng block or pcap record that is
+// read into memory.
+const maxBlockSize = 16 * 1024 * 1024
+
+// ngInterface is pcapng interface description.
+type ngInterface struct {
+	link uint32
+	// Timestamp resolution, if_tsresol option.
+	resolution byte
+}
+
+// Reader reads STUN and ChannelData messages from pcap or pcapng capture,
+// skipping other traffic.
+//
+// TCP streams are reassembled assuming that segments are captured in
+// order, and both plain and RFC 4571 framed messages are supported.
+// Fragmented IP packets are skipped.
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	buf   []byte
+
+	ng         bool
+	link       uint32 // pcap
+	nano       bool   // pcap
+	interfaces []ngInterface
+
+	streams map[string]*stream
+	pending []*Packet
+}
+
+// NewReader reads capture header from r and returns Reader of capture,
+// detecting its format.
+func NewReader(r io.Reader) (*Reader, error) {
+	c := &Reader{
+		r:       bufio.NewReader(r),
+		streams: make(map[string]*stream),
+	}
+	magic, err := c.r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, err)
+	}
+	if binary.BigEndian.Uint32(magic) == ngSectionBlock {
+		c.ng = true
+		// Reading the first Section Header Block.
+		if err = c.next(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	var header [24]byte
+	if _, err = io.ReadFull(c.r, header[:]); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, err)
+	}
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		switch order.Uint32(header[0:4]) {
+		case pcapMagic:
+			c.order = order
+		case pcapMagicNano:
+			c.order, c.nano = order, true
+		default:
+			continue
+		}
+		c.link = order.Uint32(header[20:24]) & 0x0FFFFFFF
+		return c, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Next returns the next STUN or ChannelData message of capture, or
+// io.EOF if there are no more messages.
+func (c *Reader) Next() (*Packet, error) {
+	for len(c.pending) == 0 {
+		if err := c.next(); err != nil {
+			return nil, err
+		}
+	}
+	p := c.pending[0]
+	c.pending[0] = nil
+	c.pending = c.pending[1:]
+	return p, nil
+}
+
+// next reads the next pcap record or pcapng block, adding its messages
+// to pending.
+func (c *Reader) next() error {
+	if c.ng {
+		return c.nextBlock()
+	}
+	var header [16]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return err
+	}
+	var (
+		sec  = c.order.Uint32(header[0:4])
+		frac = c.order.Uint32(header[4:8])
+		size = c.order.Uint32(header[8:12])
+	)
+	if size > maxBlockSize {
+		return fmt.Errorf("%w: record of %d bytes", ErrBadBlock, size)
+	}
+	if err := c.read(int(size)); err != nil {
+		return err
+	}
+	if !c.nano {
+		frac *= 1000
+	}
+	c.packet(time.Unix(int64(sec), int64(frac)), c.link, c.buf)
+	return nil
+}
+
+// nextBlock reads the next pcapng block.
+func (c *Reader) nextBlock() error {
+	var header [8]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return err
+	}
+	blockType := binary.BigEndian.Uint32(header[0:4])
+	if blockType == ngSectionBlock {
+		// Byte order of section is defined by its header.
+		bom, err := c.r.Peek(4)
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		switch ngByteOrder {
+		case binary.BigEndian.Uint32(bom):
+			c.order = binary.BigEndian
+		case binary.LittleEndian.Uint32(bom):
+			c.order = binary.LittleEndian
+		default:
+			return fmt.Errorf("%w: bad byte-order magic", ErrBadBlock)
+		}
+		// Interfaces are defined per section.
+		c.interfaces = c.interfaces[:0]
+	} else {
+		blockType = c.order.Uint32(header[0:4])
+	}
+	size := c.order.Uint32(header[4:8])
+	if size < 12 || size%4 != 0 || size > maxBlockSize {
+		return fmt.Errorf("%w: block of %d bytes", ErrBadBlock, size)
+	}
+	// Body and trailing length.
+	if err := c.read(int(size) - len(header)); err != nil {
+		return err
+	}
+	body := c.buf[:len(c.buf)-4]
+	switch blockType {
+	case ngInterfaceBlock:
+		if len(body) < 8 {
+			return fmt.Errorf("%w: short interface block", ErrBadBlock)
+		}
+		c.interfaces = append(c.interfaces, ngInterface{
+			link:       uint32(c.order.Uint16(body[0:2])),
+			resolution: c.resolution(body[8:]),
+		})
+	case ngEnhancedPacketBlock:
+		if len(body) < 20 {
+			return fmt.Errorf("%w: short packet block", ErrBadBlock)
+		}
+		id := c.order.Uint32(body[0:4])
+		if int(id) >= len(c.interfaces) {
+			return fmt.Errorf("%w: unknown interface %d", ErrBadBlock, id)
+		}
+		var (
+			iface    = c.interfaces[id]
+			ts       = uint64(c.order.Uint32(body[4:8]))<<32 | uint64(c.order.Uint32(body[8:12]))
+			captured = c.order.Uint32(body[12:16])
+		)
+		if int(captured) > len(body)-20 {
+			return fmt.Errorf("%w: packet of %d bytes", ErrBadBlock, captured)
+		}
+		c.packet(timestamp(ts, iface.resolution), iface.link, body[20:20+captured])
+		return nil
+	case ngSimplePacketBlock:
+		if len(body) < 4 || len(c.interfaces) == 0 {
+			return fmt.Errorf("%w: bad simple packet block", ErrBadBlock)
+		}
+		captured := int(c.order.Uint32(body[0:4]))
+		if captured > len(body)-4 {
+			captured = len(body) - 4
+		}
+		// Simple Packet Block has no timestamp.
+		c.packet(time.Time{}, c.interfaces[0].link, body[4:4+captured])
+		return nil
+	}
+	return nil
+}
+
+// resolution returns if_tsresol option value from interface block
+// options, or microseconds if it is not set.
+func (c *Reader) resolution(options []byte) byte {
+	const (
+		optEnd        = 0
+		optResolution = 9
+	)
+	for len(options) >= 4 {
+		code, length := c.order.Uint16(options[0:2]), int(c.order.Uint16(options[2:4]))
+		options = options[4:]
+		if code == optEnd || len(options) < length {
+			break
+		}
+		if code == optResolution && length == 1 {
+			return options[0]
+		}
+		// Options are padded to 32 bits.
+		length = (length + 3) &^ 3
+		if len(options) < length {
+			break
+		}
+		options = options[length:]
+	}
+	return 6
+}
+
+// timestamp converts pcapng timestamp in units of resolution to time.
+func timestamp(ts uint64, resolution byte) time.Time {
+	if resolution&0x80 != 0 {
+		// Negative power of 2.
+		shift := uint(resolution & 0x7F)
+		if shift > 63 {
+			return time.Time{}
+		}
+		sec := ts >> shift
+		frac := float64(ts&(1<<shift-1)) / float64(uint64(1)<<shift)
+		return time.Unix(int64(sec), int64(frac*1e9))
+	}
+	if resolution > 19 {
+		return time.Time{}
+	}
+	units := uint64(math.Pow10(int(resolution)))
+	sec, frac := ts/units, ts%units
+	if resolution <= 9 {
+		frac *= uint64(math.Pow10(9 - int(resolution)))
+	} else {
+		frac /= uint64(math.Pow10(int(resolution) - 9))
+	}
+	return time.Unix(int64(sec), int64(frac))
+}
+
+// read reads n bytes of block body to c.buf.
+func (c *Reader) read(n int) error {
+	if cap(c.buf) < n {
+		c.buf = make([]byte, n)
+	}
+	c.buf = c.buf[:n]
+	_, err := io.ReadFull(c.r, c.buf)
+	if errors.Is(err, io.EOF) {
+		// Header is already read.
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// packet adds messages from frame b with link type link to pending.
+func (c *Reader) packet(t time.Time, link uint32, b []byte) {
+	ip, ok := linkPayload(link, b)
+	if !ok {
+		return
+	}
+	s, ok := decodeIP(ip)
+	if !ok {
+		return
+	}
+	if s.tuple.Network == "udp" {
+		if p := newPacket(s.payload); p != nil {
+			p.Time, p.Tuple = t, s.tuple
+			c.pending = append(c.pending, p)
+		}
+		return
+	}
+	key := s.tuple.String()
+	st := c.streams[key]
+	if st == nil {
+		st = new(stream)
+		c.streams[key] = st
+	}
+	for _, p := range st.push(s) {
+		p.Time, p.Tuple = t, s.tuple
+		c.pending = append(c.pending, p)
+	}
+	if s.flags&(tcpFIN|tcpRST) != 0 {
+		delete(c.streams, key)
+	}
+}
+
+// newPacket decodes STUN or ChannelData message that b contains, copying
+// it. Returns nil if b is neither of them.
+func newPacket(b []byte) *Packet {
+	switch {
+	case stun.IsMessage(b):
+		m := &stun.Message{Raw: append([]byte(nil), b...)}
+		if err := m.Decode(); err != nil {
+			return nil
+		}
+		return &Packet{Message: m}
+	case stun.IsChannelData(b):
+		d := &stun.ChannelData{Raw: append([]byte(nil), b...)}
+		if err := d.Decode(); err != nil {
+			return nil
+		}
+		return &Packet{ChannelData: d}
+	default:
+		return nil
+	}
+}
+
+// stream reassembles messages of one direction of TCP connection.
+type stream struct {
+	started bool
+	// synced is true if buf starts at message boundary.
+	synced bool
+	next   uint32
+	buf    []byte
+}
+
+// stunHeaderSize is the size of STUN message header.
+const stunHeaderSize = 20
+
+// push adds segment s to stream, returning messages that are completed.
+func (st *stream) push(s segment) []*Packet {
+	payload := s.payload
+	switch {
+	case s.flags&tcpSYN != 0:
+		st.started, st.synced, st.next, st.buf = true, true, s.seq+1, st.buf[:0]
+		return nil
+	case !st.started:
+		// Capture started in the middle of connection.
+		st.started, st.next = true, s.seq
+	}
+	if d := int32(st.next - s.seq); d > 0 {
+		// Retransmission of data that is already processed.
+		if int(d) >= len(payload) {
+			return nil
+		}
+		payload = payload[d:]
+	} else if d < 0 {
+		// Lost segment.
+		st.synced, st.buf = false, st.buf[:0]
+	}
+	st.next = s.seq + uint32(len(s.payload))
+	if !st.synced {
+		// Resynchronizing on segment that starts with message.
+		if !startsMessage(payload) {
+			return nil
+		}
+		st.synced = true
+	}
+	st.buf = append(st.buf, payload...)
+	var packets []*Packet
+	for {
+		size, framed := frameSize(st.buf)
+		if size < 0 {
+			// Not a STUN stream.
+			st.synced, st.buf = false, st.buf[:0]
+			return packets
+		}
+		if size == 0 || len(st.buf) < size {
+			return packets
+		}
+		b := st.buf[:size]
+		if framed {
+			b = b[2:]
+		}
+		if p := newPacket(b); p != nil {
+			packets = append(packets, p)
+		}
+		st.buf = st.buf[:copy(st.buf, st.buf[size:])]
+	}
+}
+
+// startsMessage reports whether b looks like the start of STUN or
+// ChannelData message, plain or framed.
+func startsMessage(b []byte) bool {
+	const cookie = 0x2112A442
+	switch {
+	case len(b) >= 4 && stun.ChannelNumber(binary.BigEndian.Uint16(b)).Valid():
+		return true
+	case len(b) >= 8 && b[0]>>6 == 0 && binary.BigEndian.Uint32(b[4:8]) == cookie:
+		return true
+	default:
+		return len(b) >= 10 && b[2]>>6 == 0 && binary.BigEndian.Uint32(b[6:10]) == cookie
+	}
+}
+
+// frameSize returns size of message at the start of stream buffer b and
+// whether it has RFC 4571 framing, 0 if more data is needed to tell, or
+// -1 if b does not start with STUN or ChannelData message.
+func frameSize(b []byte) (int, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	if b[0]>>6 == 1 {
+		// ChannelData is padded on stream transports.
+		return stun.ChannelDataSize(b, true), false
+	}
+	if len(b) < stunHeaderSize {
+		return 0, false
+	}
+	if stun.IsMessage(b) {
+		return stunHeaderSize + int(binary.BigEndian.Uint16(b[2:4])), false
+	}
+	if len(b) < stunHeaderSize+2 {
+		return 0, false
+	}
+	if stun.IsMessage(b[2:]) {
+		size := stunHeaderSize + int(binary.BigEndian.Uint16(b[4:6]))
+		if int(binary.BigEndian.Uint16(b[0:2])) == size {
+			return 2 + size, true
+		}
+	}
+	return -1, false
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/stun/v2"
+)
+
+// snapLength is the maximum size of packet in written captures.
+const snapLength = 0x40000
+
+// Writer writes UDP datagrams and TCP segments to pcap capture with raw IP
+// link type and nanosecond timestamps. IP, UDP and TCP headers are
+// synthesized, TCP sequence numbers are tracked per flow. All methods are
+// goroutine-safe.
+type Writer struct {
+	mux sync.Mutex
+	w   io.Writer
+	buf []byte
+	seq map[string]uint32
+}
+
+// NewWriter writes capture header to w and returns Writer of capture.
+func NewWriter(w io.Writer) (*Writer, error) {
+	var header [24]byte
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagicNano)
+	binary.LittleEndian.PutUint16(header[4:6], 2) // Version 2.4.
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], snapLength)
+	binary.LittleEndian.PutUint32(header[20:24], LinkTypeRaw)
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:   w,
+		buf: make([]byte, 0, 2048),
+		seq: make(map[string]uint32),
+	}, nil
+}
+
+// WritePacket writes payload sent at t over tuple. Addresses of tuple must
+// be of the same IP family.
+func (w *Writer) WritePacket(t time.Time, tuple FiveTuple, payload []byte) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	s := segment{tuple: tuple, payload: payload}
+	if tuple.Network == "tcp" {
+		key := tuple.String()
+		s.seq = w.seq[key]
+		s.flags = tcpPSH | tcpACK
+		w.seq[key] = s.seq + uint32(len(payload))
+	}
+	const recordHeaderSize = 16
+	b, err := encodeIP(w.buf[:recordHeaderSize], s)
+	w.buf = b[:0]
+	if err != nil {
+		return err
+	}
+	size := uint32(len(b) - recordHeaderSize)
+	binary.LittleEndian.PutUint32(b[0:4], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(t.Nanosecond()))
+	binary.LittleEndian.PutUint32(b[8:12], size)
+	binary.LittleEndian.PutUint32(b[12:16], size)
+	_, err = w.w.Write(b)
+	return err
+}
+
+// WriteMessage writes message m sent at t over tuple.
+func (w *Writer) WriteMessage(t time.Time, tuple FiveTuple, m *stun.Message) error {
+	return w.WritePacket(t, tuple, m.Raw)
+}
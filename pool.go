@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import "sync"
+
+// Limits of buffers that are retained by released messages. Larger
+// buffers are dropped, so single large message does not make pool hold
+// memory.
+const (
+	maxPooledRawCapacity = 2048
+	maxPooledAttributes  = 32
+)
+
+var messagePool = sync.Pool{ //nolint:gochecknoglobals
+	New: func() interface{} {
+		return New()
+	},
+}
+
+// AcquireMessage returns empty message from pool, like New does.
+//
+// Release message with ReleaseMessage when it is not used anymore to
+// reduce allocations, e.g. in servers that process many packets.
+func AcquireMessage() *Message {
+	return messagePool.Get().(*Message) //nolint:forcetypeassert
+}
+
+// ReleaseMessage resets m and returns it to pool. Message, its Raw buffer
+// and attribute values must not be used after release. Does nothing if m
+// is nil.
+func ReleaseMessage(m *Message) {
+	if m == nil {
+		return
+	}
+	if cap(m.Raw) > maxPooledRawCapacity || cap(m.Raw) < messageHeaderSize {
+		m.Raw = make([]byte, messageHeaderSize, defaultRawCapacity)
+	} else {
+		m.Raw = m.Raw[:messageHeaderSize]
+		for i := range m.Raw {
+			m.Raw[i] = 0
+		}
+	}
+	if cap(m.Attributes) > maxPooledAttributes {
+		m.Attributes = nil
+	} else {
+		// Attribute values can reference dropped buffer.
+		attrs := m.Attributes[:cap(m.Attributes)]
+		for i := range attrs {
+			attrs[i] = RawAttribute{}
+		}
+		m.Attributes = attrs[:0]
+	}
+	m.index.reset()
+	m.Type = MessageType{}
+	m.Length = 0
+	m.TransactionID = [TransactionIDSize]byte{}
+	messagePool.Put(m)
+}
+
+// BuildPooled is Build that uses message from pool, see AcquireMessage.
+// The returned message should be released with ReleaseMessage.
+func BuildPooled(setters ...Setter) (*Message, error) {
+	m := AcquireMessage()
+	if err := m.Build(setters...); err != nil {
+		ReleaseMessage(m)
+		return nil, err
+	}
+	return m, nil
+}
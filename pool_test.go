@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/stun/v2/internal/testutil"
+)
+
+func TestAcquireMessage(t *testing.T) {
+	m := AcquireMessage()
+	if len(m.Raw) != messageHeaderSize || len(m.Attributes) != 0 {
+		t.Fatalf("unexpected message %s", m)
+	}
+	if err := m.Build(TransactionID, BindingRequest, NewSoftware("software"), Fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	attrs := m.Attributes
+	ReleaseMessage(m)
+	if m.Type != (MessageType{}) || m.Length != 0 || m.TransactionID != ([TransactionIDSize]byte{}) {
+		t.Errorf("message is not reset: %s", m)
+	}
+	for _, b := range m.Raw {
+		if b != 0 {
+			t.Fatalf("header is not reset: %x", m.Raw)
+		}
+	}
+	if len(m.Attributes) != 0 || attrs[:cap(attrs)][0].Value != nil {
+		t.Error("attributes are not reset")
+	}
+	ReleaseMessage(nil)
+}
+
+func TestReleaseMessage_Oversized(t *testing.T) {
+	m := AcquireMessage()
+	m.Add(AttrData, make([]byte, maxPooledRawCapacity))
+	for i := 0; i <= maxPooledAttributes; i++ {
+		m.Add(AttrSoftware, nil)
+	}
+	ReleaseMessage(m)
+	if cap(m.Raw) > maxPooledRawCapacity || len(m.Raw) != messageHeaderSize {
+		t.Errorf("unexpected raw buffer len %d cap %d", len(m.Raw), cap(m.Raw))
+	}
+	if cap(m.Attributes) > maxPooledAttributes {
+		t.Errorf("unexpected attributes capacity %d", cap(m.Attributes))
+	}
+}
+
+func TestBuildPooled(t *testing.T) {
+	m, err := BuildPooled(TransactionID, BindingRequest, NewSoftware("software"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var software Software
+	if err = software.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if software.String() != "software" {
+		t.Errorf("unexpected software %s", software)
+	}
+	ReleaseMessage(m)
+	buildErr := errors.New("failed")
+	if _, err = BuildPooled(BindingRequest, errorSetter{buildErr}); !errors.Is(err, buildErr) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+type errorSetter struct {
+	err error
+}
+
+func (s errorSetter) AddTo(*Message) error {
+	return s.err
+}
+
+func TestBuildPooledNoAllocs(t *testing.T) {
+	software := NewSoftware("software")
+	setters := []Setter{TransactionID, BindingRequest, software, Fingerprint}
+	// Warming up pool.
+	ReleaseMessage(AcquireMessage())
+	testutil.ShouldNotAllocate(t, func() {
+		m, err := BuildPooled(setters...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ReleaseMessage(m)
+	})
+}
+
+func BenchmarkBuildPooled(b *testing.B) {
+	setters := []Setter{TransactionID, BindingRequest, NewSoftware("software"), Fingerprint}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m, err := BuildPooled(setters...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ReleaseMessage(m)
+	}
+}
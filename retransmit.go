@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Default retransmission parameters.
+//
+// RFC 8489 Section 6.2.1 and 6.2.2
+const (
+	DefaultRc = 7
+	DefaultRm = 16
+	DefaultTi = 39500 * time.Millisecond
+)
+
+// maxBackoffShift limits RTO doubling to prevent overflow.
+const maxBackoffShift = 30
+
+// RetransmitPolicy controls timeouts and retransmissions of requests.
+//
+// On unreliable transports (UDP, DTLS), request is sent Rc times with the
+// timeout doubled after each send, starting from RTO. After the last send,
+// client waits Rm*RTO before failing the transaction. With RTO 500 ms,
+// requests are sent at 0, 500, 1500, 3500, 7500, 15500 and 31500 ms and
+// transaction times out at 39500 ms.
+//
+// On reliable transports (TCP, TLS), request is sent once and transaction
+// times out after Ti.
+//
+// Zero fields are replaced with defaults, so zero RetransmitPolicy is
+// the RFC 8489 policy for unreliable transports.
+//
+// RFC 8489 Section 6.2.1 and 6.2.2
+type RetransmitPolicy struct {
+	// RTO is the initial retransmission timeout. If zero, client RTO is
+	// used, see WithRTO and SetRTO.
+	RTO time.Duration
+	// MaxRTO caps doubled retransmission timeout. Zero means no cap.
+	MaxRTO time.Duration
+	// Rc is the maximum number of requests sent, including the first
+	// one. Zero means DefaultRc.
+	Rc int
+	// Rm is the multiplier of RTO for the wait after the last request.
+	// Zero means DefaultRm.
+	Rm int
+	// Jitter randomizes each timeout by up to this fraction in both
+	// directions, must be in [0, 1). Zero disables jitter.
+	Jitter float64
+	// Ti is the transaction timeout for reliable transports. If not
+	// zero, request is never retransmitted and other fields are ignored.
+	Ti time.Duration
+
+	// linear is the pre-RFC 8489 schedule of client, see
+	// linearRetransmitPolicy.
+	linear bool
+}
+
+// ReliableRetransmitPolicy returns policy for reliable transports, which
+// is used by default for TCP and TLS connections.
+func ReliableRetransmitPolicy() RetransmitPolicy {
+	return RetransmitPolicy{Ti: DefaultTi}
+}
+
+// linearRetransmitPolicy returns policy that client uses by default for
+// datagram connections: request is retransmitted defaultMaxAttempts times
+// and timeout grows linearly, (attempt+1)*RTO.
+func linearRetransmitPolicy() RetransmitPolicy {
+	return RetransmitPolicy{Rc: defaultMaxAttempts + 1, linear: true}
+}
+
+func (p RetransmitPolicy) rc() int {
+	if p.Rc <= 0 {
+		return DefaultRc
+	}
+	return p.Rc
+}
+
+func (p RetransmitPolicy) rm() int {
+	if p.Rm <= 0 {
+		return DefaultRm
+	}
+	return p.Rm
+}
+
+// retransmissions returns the maximum number of retransmissions.
+func (p RetransmitPolicy) retransmissions() int32 {
+	if p.Ti > 0 {
+		return 0
+	}
+	return int32(p.rc() - 1)
+}
+
+// timeout returns the timeout after request was sent attempt+1 times.
+// The rto is used if p.RTO is zero.
+func (p RetransmitPolicy) timeout(attempt int32, rto time.Duration) time.Duration {
+	if p.Ti > 0 {
+		return p.Ti
+	}
+	if p.RTO > 0 {
+		rto = p.RTO
+	}
+	var d time.Duration
+	switch {
+	case p.linear:
+		d = time.Duration(attempt+1) * rto
+	case attempt >= p.retransmissions():
+		d = time.Duration(p.rm()) * rto
+	default:
+		shift := attempt
+		if shift > maxBackoffShift {
+			shift = maxBackoffShift
+		}
+		d = rto << uint(shift)
+		if p.MaxRTO > 0 && d > p.MaxRTO {
+			d = p.MaxRTO
+		}
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (2*rand.Float64() - 1)) //nolint:gosec
+	}
+	return d
+}
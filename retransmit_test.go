@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetransmitPolicy_Timeout(t *testing.T) {
+	const rto = 500 * time.Millisecond
+	for _, tc := range []struct {
+		name     string
+		policy   RetransmitPolicy
+		timeouts []time.Duration
+	}{
+		{
+			name:   "Default",
+			policy: RetransmitPolicy{},
+			timeouts: []time.Duration{
+				500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second,
+				8 * time.Second, 16 * time.Second, 8 * time.Second,
+			},
+		},
+		{
+			name:   "Custom",
+			policy: RetransmitPolicy{RTO: 100 * time.Millisecond, MaxRTO: 250 * time.Millisecond, Rc: 4, Rm: 8},
+			timeouts: []time.Duration{
+				100 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond, 800 * time.Millisecond,
+			},
+		},
+		{
+			name:     "Reliable",
+			policy:   ReliableRetransmitPolicy(),
+			timeouts: []time.Duration{DefaultTi},
+		},
+		{
+			name:   "Linear",
+			policy: linearRetransmitPolicy(),
+			timeouts: []time.Duration{
+				500 * time.Millisecond, time.Second, 1500 * time.Millisecond, 2 * time.Second,
+				2500 * time.Millisecond, 3 * time.Second, 3500 * time.Millisecond, 4 * time.Second,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if r := tc.policy.retransmissions(); int(r) != len(tc.timeouts)-1 {
+				t.Errorf("unexpected retransmissions %d", r)
+			}
+			var total time.Duration
+			for i, expected := range tc.timeouts {
+				d := tc.policy.timeout(int32(i), rto)
+				if d != expected {
+					t.Errorf("%d: %s != %s", i, d, expected)
+				}
+				total += d
+			}
+			if tc.name == "Default" && total != DefaultTi {
+				t.Errorf("unexpected total %s", total)
+			}
+		})
+	}
+	t.Run("Jitter", func(t *testing.T) {
+		p := RetransmitPolicy{Jitter: 0.1}
+		for i := 0; i < 100; i++ {
+			d := p.timeout(0, rto)
+			if d < 450*time.Millisecond || d > 550*time.Millisecond {
+				t.Fatalf("%s is out of range", d)
+			}
+		}
+	})
+	t.Run("Overflow", func(t *testing.T) {
+		p := RetransmitPolicy{Rc: 100}
+		if d := p.timeout(64, rto); d <= 0 {
+			t.Errorf("unexpected timeout %s", d)
+		}
+	})
+}
+
+// tcpAddrConn is Connection with TCP local address.
+type tcpAddrConn struct {
+	Connection
+}
+
+func (tcpAddrConn) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478}
+}
+
+// TestClient_RetransmitPolicy drives retransmissions with manual clock and
+// collector, checking the request schedule.
+func TestClient_RetransmitPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		tcp     bool
+		options []ClientOption
+		sends   []time.Duration // time of each request
+		timeout time.Duration   // time of transaction timeout
+	}{
+		{
+			name: "Policy",
+			options: []ClientOption{WithRetransmitPolicy(RetransmitPolicy{
+				RTO: 100 * time.Millisecond, Rc: 3, Rm: 4,
+			})},
+			sends:   []time.Duration{0, 100 * time.Millisecond, 300 * time.Millisecond},
+			timeout: 700 * time.Millisecond,
+		},
+		{
+			name:    "ClientRTO",
+			options: []ClientOption{WithRTO(10 * time.Millisecond), WithRetransmitPolicy(RetransmitPolicy{})},
+			sends: []time.Duration{
+				0, 10 * time.Millisecond, 30 * time.Millisecond, 70 * time.Millisecond,
+				150 * time.Millisecond, 310 * time.Millisecond, 630 * time.Millisecond,
+			},
+			timeout: 790 * time.Millisecond,
+		},
+		{
+			name:    "Linear",
+			options: []ClientOption{WithRTO(10 * time.Millisecond)},
+			sends: []time.Duration{
+				0, 10 * time.Millisecond, 30 * time.Millisecond, 60 * time.Millisecond,
+				100 * time.Millisecond, 150 * time.Millisecond, 210 * time.Millisecond, 280 * time.Millisecond,
+			},
+			timeout: 360 * time.Millisecond,
+		},
+		{
+			name:    "Reliable",
+			tcp:     true,
+			sends:   []time.Duration{0},
+			timeout: DefaultTi,
+		},
+		{
+			name:    "NoRetransmit",
+			options: []ClientOption{WithRTO(time.Second), WithNoRetransmit},
+			sends:   []time.Duration{0},
+			timeout: time.Second,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				writes    int32
+				closed    = make(chan struct{})
+				collector = new(manualCollector)
+				start     = time.Now()
+				clock     = &manualClock{current: start}
+			)
+			var conn Connection = &testConnection{
+				write: func(b []byte) (int, error) {
+					atomic.AddInt32(&writes, 1)
+					return len(b), nil
+				},
+				read: func([]byte) (int, error) {
+					<-closed
+					return 0, io.EOF
+				},
+				close: func() error {
+					close(closed)
+					return nil
+				},
+			}
+			if tc.tcp {
+				conn = tcpAddrConn{Connection: conn}
+			}
+			options := append([]ClientOption{WithClock(clock), WithCollector(collector)}, tc.options...)
+			c, err := NewClient(conn, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close() //nolint:errcheck
+			var result atomic.Value
+			if err = c.Start(MustBuild(TransactionID, BindingRequest), func(e Event) {
+				result.Store(e)
+			}); err != nil {
+				t.Fatal(err)
+			}
+			// Checking state just before and after each deadline.
+			for i, at := range append(tc.sends[1:], tc.timeout) {
+				collector.Collect(start.Add(at - time.Millisecond))
+				if w := atomic.LoadInt32(&writes); int(w) != i+1 {
+					t.Fatalf("%s: unexpected writes %d", at, w)
+				}
+				clock.Add(start.Add(at).Sub(clock.Now()))
+				collector.Collect(start.Add(at + time.Nanosecond))
+			}
+			if w := atomic.LoadInt32(&writes); int(w) != len(tc.sends) {
+				t.Errorf("unexpected writes %d", w)
+			}
+			e, ok := result.Load().(Event)
+			if !ok || !errors.Is(e.Error, ErrTransactionTimeOut) {
+				t.Errorf("unexpected result %+v", e)
+			}
+		})
+	}
+}
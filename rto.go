@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// RTO estimation parameters.
+//
+// RFC 6298 Section 2 and RFC 8489 Section 6.2.1
+const (
+	// rttAlpha and rttBeta are 1/8 and 1/4 gains of SRTT and RTTVAR.
+	rttAlphaShift = 3
+	rttBetaShift  = 2
+	// rttK is RTTVAR multiplier.
+	rttK = 4
+	// Bounds of estimated RTO. The lower one is the minimum of RFC 8489,
+	// the upper one is below 60 s of RFC 6298, which is too conservative
+	// for STUN that retransmits Rc times with backoff anyway.
+	minEstimatedRTO = 500 * time.Millisecond
+	maxEstimatedRTO = 3 * time.Second
+	// rtoCacheTimeout is the time after which estimated RTO of server is
+	// considered stale and discarded.
+	rtoCacheTimeout = 10 * time.Minute
+)
+
+// rttEstimator estimates RTO of single server from RTT samples.
+//
+// RFC 6298 Section 2
+type rttEstimator struct {
+	srtt    time.Duration
+	rttvar  time.Duration
+	rto     time.Duration
+	updated time.Time
+}
+
+// sample updates estimation with rtt measured at now, g is the clock
+// granularity.
+func (e *rttEstimator) sample(rtt, g time.Duration, now time.Time) {
+	if e.updated.IsZero() {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+	} else {
+		delta := e.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		e.rttvar += (delta - e.rttvar) >> rttBetaShift
+		e.srtt += (rtt - e.srtt) >> rttAlphaShift
+	}
+	variance := rttK * e.rttvar
+	if variance < g {
+		variance = g
+	}
+	e.rto = e.srtt + variance
+	if e.rto < minEstimatedRTO {
+		e.rto = minEstimatedRTO
+	}
+	if e.rto > maxEstimatedRTO {
+		e.rto = maxEstimatedRTO
+	}
+	e.updated = now
+}
+
+// stale reports whether estimation is too old to be used at now.
+func (e *rttEstimator) stale(now time.Time) bool {
+	return now.Sub(e.updated) > rtoCacheTimeout
+}
+
+// remoteAddr returns address of server that conn is connected to, or nil
+// if conn does not provide it.
+func remoteAddr(conn Connection) net.Addr {
+	c, ok := conn.(interface{ RemoteAddr() net.Addr })
+	if !ok {
+		return nil
+	}
+	return c.RemoteAddr()
+}
+
+// remoteKey returns key of server at addr for RTO estimation. Servers are
+// identified by IP address.
+func remoteKey(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	case nil:
+		return ""
+	default:
+		return a.String()
+	}
+}
+
+// transactionRTO returns RTO for new transaction to remote, using
+// estimation if it is available.
+func (c *Client) transactionRTO(remote string, now time.Time) time.Duration {
+	c.rttMux.Lock()
+	defer c.rttMux.Unlock()
+	if e, ok := c.rtt[remote]; ok {
+		if !e.stale(now) {
+			return e.rto
+		}
+		delete(c.rtt, remote)
+	}
+	return time.Duration(atomic.LoadInt64(&c.rto))
+}
+
+// sampleRTT updates RTO estimation of remote with round-trip time of
+// transaction that completed at now. Retransmitted transactions must not
+// be sampled, as it is unknown which request the response belongs to
+// (Karn's algorithm).
+func (c *Client) sampleRTT(remote string, rtt time.Duration, now time.Time) {
+	if rtt < 0 {
+		return
+	}
+	c.rttMux.Lock()
+	e, ok := c.rtt[remote]
+	if !ok || e.stale(now) {
+		e = &rttEstimator{}
+		c.rtt[remote] = e
+	}
+	e.sample(rtt, c.rtoRate, now)
+	c.rttMux.Unlock()
+}
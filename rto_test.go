@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	var (
+		e   rttEstimator
+		now = time.Now()
+		g   = 5 * time.Millisecond
+	)
+	e.sample(200*time.Millisecond, g, now)
+	if e.srtt != 200*time.Millisecond || e.rttvar != 100*time.Millisecond || e.rto != 600*time.Millisecond {
+		t.Errorf("unexpected %+v", e)
+	}
+	e.sample(100*time.Millisecond, g, now)
+	if e.srtt != 187500*time.Microsecond || e.rttvar != 100*time.Millisecond || e.rto != 587500*time.Microsecond {
+		t.Errorf("unexpected %+v", e)
+	}
+	t.Run("Bounds", func(t *testing.T) {
+		var low, high rttEstimator
+		low.sample(time.Millisecond, g, now)
+		if low.rto != minEstimatedRTO {
+			t.Errorf("unexpected %s", low.rto)
+		}
+		high.sample(10*time.Second, g, now)
+		if high.rto != maxEstimatedRTO {
+			t.Errorf("unexpected %s", high.rto)
+		}
+	})
+	t.Run("Granularity", func(t *testing.T) {
+		var s rttEstimator
+		s.sample(time.Second, g, now)
+		for i := 0; i < 100; i++ {
+			s.sample(time.Second, g, now)
+		}
+		if s.rto < time.Second+g {
+			t.Errorf("RTO %s should include clock granularity", s.rto)
+		}
+	})
+	if e.stale(now.Add(rtoCacheTimeout)) || !e.stale(now.Add(rtoCacheTimeout+time.Second)) {
+		t.Error("unexpected staleness")
+	}
+}
+
+func TestRemoteKey(t *testing.T) {
+	if k := remoteKey(remoteAddr(noopConnection{})); k != "" {
+		t.Errorf("unexpected key %q", k)
+	}
+	conn, err := net.Dial("udp4", "127.0.0.1:3478")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer conn.Close() //nolint:errcheck
+	if k := remoteKey(remoteAddr(conn)); k != "127.0.0.1" {
+		t.Errorf("unexpected key %q", k)
+	}
+}
+
+func TestClient_AdaptiveRTO(t *testing.T) {
+	var (
+		mux       sync.Mutex
+		deadlines = make(map[transactionID]time.Time)
+		clock     = &manualClock{current: time.Now()}
+		agent     = &manualAgent{}
+		closed    = make(chan struct{})
+	)
+	agent.start = func(id [TransactionIDSize]byte, deadline time.Time) error {
+		mux.Lock()
+		deadlines[id] = deadline
+		mux.Unlock()
+		return nil
+	}
+	conn := &testConnection{
+		write: func(b []byte) (int, error) { return len(b), nil },
+		read: func([]byte) (int, error) {
+			<-closed
+			return 0, io.EOF
+		},
+		close: func() error {
+			close(closed)
+			return nil
+		},
+	}
+	c, err := NewClient(conn,
+		WithAgent(agent),
+		WithClock(clock),
+		WithCollector(new(manualCollector)),
+		WithRTO(time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close() //nolint:errcheck
+	// transaction starts transaction, returning its initial timeout.
+	transaction := func() (transactionID, time.Duration) {
+		req := MustBuild(TransactionID, BindingRequest)
+		if err := c.Start(req, func(Event) {}); err != nil {
+			t.Fatal(err)
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		return req.TransactionID, deadlines[req.TransactionID].Sub(clock.Now())
+	}
+	respond := func(id transactionID) {
+		agent.h(Event{TransactionID: id, Message: MustBuild(NewTransactionIDSetter(id), BindingSuccess)})
+	}
+
+	id, timeout := transaction()
+	if timeout != time.Second {
+		t.Errorf("unexpected initial timeout %s", timeout)
+	}
+	clock.Add(200 * time.Millisecond)
+	respond(id)
+	id, timeout = transaction()
+	if timeout != 600*time.Millisecond {
+		t.Errorf("timeout %s should be estimated from RTT", timeout)
+	}
+
+	// Karn's rule: retransmitted transaction is not sampled.
+	clock.Add(600 * time.Millisecond)
+	agent.h(Event{TransactionID: id, Error: ErrTransactionTimeOut})
+	clock.Add(2 * time.Second)
+	respond(id)
+	if _, timeout = transaction(); timeout != 600*time.Millisecond {
+		t.Errorf("timeout %s should not change", timeout)
+	}
+
+	// Estimation is discarded after inactivity.
+	clock.Add(rtoCacheTimeout + time.Second)
+	if _, timeout = transaction(); timeout != time.Second {
+		t.Errorf("timeout %s should be reset", timeout)
+	}
+
+	// SetRTO discards estimation.
+	id, _ = transaction()
+	clock.Add(200 * time.Millisecond)
+	respond(id)
+	c.SetRTO(2 * time.Second)
+	if _, timeout = transaction(); timeout != 2*time.Second {
+		t.Errorf("unexpected timeout %s", timeout)
+	}
+}
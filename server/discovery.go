@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/pion/stun/v2"
+	"github.com/pion/transport/v3"
+	"github.com/pion/transport/v3/stdnet"
+)
+
+// DiscoveryConfig is used to pass configuration to ListenDiscovery().
+type DiscoveryConfig struct {
+	// Network is "udp4" or "udp6", defaults to "udp4".
+	Network string
+
+	// PrimaryAddr is the address that clients use to reach server.
+	// Zero port means that port is chosen automatically.
+	PrimaryAddr *net.UDPAddr
+
+	// AlternateAddr must differ from PrimaryAddr in both IP address and
+	// port. Zero port means that port is chosen automatically.
+	AlternateAddr *net.UDPAddr
+
+	Net transport.Net
+}
+
+// ErrDiscoveryAddr means that DiscoveryConfig addresses are invalid.
+var ErrDiscoveryAddr = errors.New("primary and alternate addresses must differ in both IP and port")
+
+// Discovery is a set of four UDP sockets on two IP addresses and two ports
+// that is used to serve Binding requests in RFC 5780 NAT behavior discovery
+// mode.
+//
+// In this mode every Binding response contains RESPONSE-ORIGIN and
+// OTHER-ADDRESS attributes, and is sent from the alternate IP address and/or
+// port if the request contains CHANGE-REQUEST attribute that asks for it.
+// If the request contains RESPONSE-PORT attribute, the response is sent to
+// that port instead of the source port of request.
+type Discovery struct {
+	// conns are indexed as [ip][port], where 0 is primary and 1 is
+	// alternate.
+	conns [2][2]net.PacketConn
+}
+
+// ListenDiscovery binds all combinations of primary and alternate IP
+// addresses and ports from cfg. Use Server.ServeDiscovery to serve
+// requests on them.
+func ListenDiscovery(cfg *DiscoveryConfig) (*Discovery, error) {
+	if !validDiscoveryAddrs(cfg.PrimaryAddr, cfg.AlternateAddr) {
+		return nil, ErrDiscoveryAddr
+	}
+	network := cfg.Network
+	if network == "" {
+		network = "udp4"
+	}
+	nw := cfg.Net
+	if nw == nil {
+		var err error
+		if nw, err = stdnet.NewNet(); err != nil {
+			return nil, fmt.Errorf("failed to create net: %w", err)
+		}
+	}
+	var (
+		d     = new(Discovery)
+		ips   = [2]net.IP{cfg.PrimaryAddr.IP, cfg.AlternateAddr.IP}
+		ports = [2]int{cfg.PrimaryAddr.Port, cfg.AlternateAddr.Port}
+	)
+	for i, ip := range ips {
+		for j := range ports {
+			address := net.JoinHostPort(ip.String(), strconv.Itoa(ports[j]))
+			conn, err := nw.ListenPacket(network, address)
+			if err != nil {
+				_ = d.Close()
+				return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+			}
+			d.conns[i][j] = conn
+			if ports[j] == 0 {
+				// Using the chosen port for the other IP address too.
+				if _, ports[j], err = AddrIPPort(conn.LocalAddr()); err != nil {
+					_ = d.Close()
+					return nil, err
+				}
+			}
+		}
+	}
+	return d, nil
+}
+
+// validDiscoveryAddrs reports whether primary and alternate addresses form
+// the set that RFC 5780 requires: two distinct specified IP addresses of
+// the same family and two distinct ports. Zero ports are chosen
+// automatically and so are distinct.
+func validDiscoveryAddrs(primary, alternate *net.UDPAddr) bool {
+	if primary == nil || alternate == nil {
+		return false
+	}
+	for _, ip := range []net.IP{primary.IP, alternate.IP} {
+		if ip == nil || ip.IsUnspecified() {
+			return false
+		}
+	}
+	if (primary.IP.To4() == nil) != (alternate.IP.To4() == nil) || primary.IP.Equal(alternate.IP) {
+		return false
+	}
+	return primary.Port == 0 || primary.Port != alternate.Port
+}
+
+// PrimaryAddr returns the address that clients should use to reach server.
+func (d *Discovery) PrimaryAddr() net.Addr {
+	return d.conns[0][0].LocalAddr()
+}
+
+// OtherAddr returns the alternate address, that is sent to clients in
+// OTHER-ADDRESS attribute when they use the primary one.
+func (d *Discovery) OtherAddr() net.Addr {
+	return d.conns[1][1].LocalAddr()
+}
+
+// Close closes all sockets.
+func (d *Discovery) Close() error {
+	var closeErr error
+	for i := range d.conns {
+		for _, conn := range d.conns[i] {
+			if conn == nil {
+				continue
+			}
+			if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) && closeErr == nil {
+				closeErr = err
+			}
+		}
+	}
+	return closeErr
+}
+
+// index returns position of conn in d.conns.
+func (d *Discovery) index(conn net.PacketConn) (ip, port int) {
+	for i := range d.conns {
+		for j := range d.conns[i] {
+			if d.conns[i][j] == conn {
+				return i, j
+			}
+		}
+	}
+	return 0, 0
+}
+
+// route returns connection that should be used to respond to req that was
+// received on conn and the address to respond to, filling RFC 5780
+// addresses of req.
+func (d *Discovery) route(conn net.PacketConn, req *Request) (net.PacketConn, net.Addr, error) {
+	ip, port := d.index(conn)
+	req.otherAddr = d.conns[1-ip][1-port].LocalAddr()
+	if req.Message.Contains(stun.AttrChangeRequest) {
+		var c stun.ChangeRequest
+		if err := c.GetFrom(req.Message); err != nil {
+			return nil, nil, err
+		}
+		if c.ChangeIP {
+			ip = 1 - ip
+		}
+		if c.ChangePort {
+			port = 1 - port
+		}
+	}
+	out := d.conns[ip][port]
+	req.responseOrigin = out.LocalAddr()
+	to := req.RemoteAddr
+	if req.Message.Type == stun.BindingRequest && req.Message.Contains(stun.AttrResponsePort) {
+		// RFC 5780 Section 6.1: the response is sent to the source IP
+		// address of request and the port from RESPONSE-PORT.
+		var p stun.ResponsePort
+		if err := p.GetFrom(req.Message); err != nil {
+			return nil, nil, err
+		}
+		remoteIP, _, err := AddrIPPort(req.RemoteAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		to = &net.UDPAddr{IP: remoteIP, Port: int(p)}
+	}
+	return out, to, nil
+}
+
+// addDiscoveryAttributes adds RESPONSE-ORIGIN and OTHER-ADDRESS to Binding
+// responses in RFC 5780 mode.
+//
+// RFC 5780 Section 6.1.
+func (r *Request) addDiscoveryAttributes(res *stun.Message) error {
+	if r.otherAddr == nil || res.Type.Method != stun.MethodBinding {
+		return nil
+	}
+	ip, port, err := AddrIPPort(r.responseOrigin)
+	if err != nil {
+		return err
+	}
+	if err = (&stun.ResponseOrigin{IP: ip, Port: port}).AddTo(res); err != nil {
+		return err
+	}
+	if ip, port, err = AddrIPPort(r.otherAddr); err != nil {
+		return err
+	}
+	return (&stun.OtherAddress{IP: ip, Port: port}).AddTo(res)
+}
+
+// ServeDiscovery serves requests on all sockets of d in RFC 5780 mode,
+// blocking until Close is called or any of sockets fails. All sockets
+// are closed on return.
+func (s *Server) ServeDiscovery(d *Discovery) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		serveErr error
+	)
+	for i := range d.conns {
+		for _, conn := range d.conns[i] {
+			wg.Add(1)
+			go func(conn net.PacketConn) {
+				defer wg.Done()
+				if err := s.servePacket(conn, d); err != nil {
+					once.Do(func() {
+						serveErr = err
+						// Stopping other sockets.
+						_ = d.Close()
+					})
+				}
+			}(conn)
+		}
+	}
+	wg.Wait()
+	return serveErr
+}
@@ -0,0 +1,275 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package server
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v2"
+)
+
+func listenDiscovery(t *testing.T) (*Server, *Discovery) {
+	t.Helper()
+	d, err := ListenDiscovery(&DiscoveryConfig{
+		PrimaryAddr:   &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		AlternateAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2)},
+	})
+	if err != nil {
+		t.Skipf("unable to listen on loopback addresses: %s", err)
+	}
+	s := New()
+	go func() {
+		if serveErr := s.ServeDiscovery(d); !errors.Is(serveErr, ErrServerClosed) {
+			t.Error(serveErr)
+		}
+	}()
+	return s, d
+}
+
+func TestListenDiscovery(t *testing.T) {
+	for _, cfg := range []*DiscoveryConfig{
+		{},
+		{PrimaryAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}},
+		{
+			PrimaryAddr:   &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			AlternateAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1},
+		},
+		{
+			PrimaryAddr:   &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478},
+			AlternateAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 3478},
+		},
+		{
+			PrimaryAddr:   &net.UDPAddr{IP: net.IPv4zero},
+			AlternateAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2)},
+		},
+		{
+			PrimaryAddr:   &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			AlternateAddr: &net.UDPAddr{IP: net.IPv6loopback},
+		},
+	} {
+		if _, err := ListenDiscovery(cfg); !errors.Is(err, ErrDiscoveryAddr) {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+}
+
+func TestServer_ServeDiscovery(t *testing.T) {
+	s, d := listenDiscovery(t)
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	primary := d.PrimaryAddr().(*net.UDPAddr) //nolint:forcetypeassert
+	other := d.OtherAddr().(*net.UDPAddr)     //nolint:forcetypeassert
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	for _, tc := range []struct {
+		name    string
+		to      *net.UDPAddr
+		change  *stun.ChangeRequest
+		origin  *net.UDPAddr
+		otherTo *net.UDPAddr
+	}{
+		{
+			name:    "Primary",
+			to:      primary,
+			origin:  primary,
+			otherTo: other,
+		},
+		{
+			name:    "ChangePort",
+			to:      primary,
+			change:  &stun.ChangeRequest{ChangePort: true},
+			origin:  &net.UDPAddr{IP: primary.IP, Port: other.Port},
+			otherTo: other,
+		},
+		{
+			name:    "ChangeIP",
+			to:      primary,
+			change:  &stun.ChangeRequest{ChangeIP: true},
+			origin:  &net.UDPAddr{IP: other.IP, Port: primary.Port},
+			otherTo: other,
+		},
+		{
+			name:    "ChangeBoth",
+			to:      primary,
+			change:  &stun.ChangeRequest{ChangeIP: true, ChangePort: true},
+			origin:  other,
+			otherTo: other,
+		},
+		{
+			name:    "Alternate",
+			to:      other,
+			origin:  other,
+			otherTo: primary,
+		},
+		{
+			name:    "AlternatePort",
+			to:      &net.UDPAddr{IP: primary.IP, Port: other.Port},
+			change:  &stun.ChangeRequest{ChangeIP: true},
+			origin:  other,
+			otherTo: &net.UDPAddr{IP: other.IP, Port: primary.Port},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setters := []stun.Setter{stun.TransactionID, stun.BindingRequest}
+			if tc.change != nil {
+				setters = append(setters, tc.change)
+			}
+			req := stun.MustBuild(setters...)
+			if _, err := conn.WriteTo(req.Raw, tc.to); err != nil {
+				t.Fatal(err)
+			}
+			if err := conn.SetReadDeadline(time.Now().Add(time.Second * 5)); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 1024)
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if from.String() != tc.origin.String() {
+				t.Errorf("response from %s, expected %s", from, tc.origin)
+			}
+			res := new(stun.Message)
+			if err = stun.Decode(buf[:n], res); err != nil {
+				t.Fatal(err)
+			}
+			if res.TransactionID != req.TransactionID {
+				t.Error("unexpected transaction id")
+			}
+			var (
+				origin    stun.ResponseOrigin
+				otherAddr stun.OtherAddress
+				xorAddr   stun.XORMappedAddress
+			)
+			if err = res.Parse(&origin, &otherAddr, &xorAddr); err != nil {
+				t.Fatal(err)
+			}
+			if origin.String() != tc.origin.String() {
+				t.Errorf("RESPONSE-ORIGIN %s, expected %s", origin, tc.origin)
+			}
+			if otherAddr.String() != tc.otherTo.String() {
+				t.Errorf("OTHER-ADDRESS %s, expected %s", otherAddr, tc.otherTo)
+			}
+			if xorAddr.String() != conn.LocalAddr().String() {
+				t.Errorf("XOR-MAPPED-ADDRESS %s, expected %s", xorAddr, conn.LocalAddr())
+			}
+		})
+	}
+}
+
+func TestServer_ServeDiscovery_ResponsePort(t *testing.T) {
+	s, d := listenDiscovery(t)
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	var conns [2]net.PacketConn
+	for i := range conns {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close() //nolint:errcheck
+		conns[i] = conn
+	}
+	port := conns[1].LocalAddr().(*net.UDPAddr).Port //nolint:forcetypeassert
+	req := stun.MustBuild(stun.TransactionID, stun.BindingRequest, stun.ResponsePort(port))
+	if _, err := conns[0].WriteTo(req.Raw, d.PrimaryAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := conns[1].SetReadDeadline(time.Now().Add(time.Second * 5)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	n, from, err := conns[1].ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from.String() != d.PrimaryAddr().String() {
+		t.Errorf("response from %s, expected %s", from, d.PrimaryAddr())
+	}
+	res := new(stun.Message)
+	if err = stun.Decode(buf[:n], res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != stun.BindingSuccess || res.TransactionID != req.TransactionID {
+		t.Fatalf("unexpected response %s", res)
+	}
+	var xorAddr stun.XORMappedAddress
+	if err = xorAddr.GetFrom(res); err != nil {
+		t.Fatal(err)
+	}
+	if xorAddr.String() != conns[0].LocalAddr().String() {
+		t.Errorf("XOR-MAPPED-ADDRESS %s, expected %s", xorAddr, conns[0].LocalAddr())
+	}
+}
+
+func TestServer_ServeDiscovery_BadRequest(t *testing.T) {
+	s, d := listenDiscovery(t)
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	for _, tc := range []struct {
+		name string
+		attr stun.AttrType
+	}{
+		{name: "ChangeRequest", attr: stun.AttrChangeRequest},
+		{name: "ResponsePort", attr: stun.AttrResponsePort},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+			req.Add(tc.attr, []byte{1, 2})
+			if _, err := conn.WriteTo(req.Raw, d.PrimaryAddr()); err != nil {
+				t.Fatal(err)
+			}
+			if err := conn.SetReadDeadline(time.Now().Add(time.Second * 5)); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 1024)
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if from.String() != d.PrimaryAddr().String() {
+				t.Errorf("response from %s, expected %s", from, d.PrimaryAddr())
+			}
+			res := new(stun.Message)
+			if err = stun.Decode(buf[:n], res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Type != stun.BindingError || res.TransactionID != req.TransactionID {
+				t.Fatalf("unexpected response %s", res)
+			}
+			var code stun.ErrorCodeAttribute
+			if err = code.GetFrom(res); err != nil {
+				t.Fatal(err)
+			}
+			if code.Code != stun.CodeBadRequest {
+				t.Errorf("unexpected error code %d", code.Code)
+			}
+		})
+	}
+}
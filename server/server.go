@@ -0,0 +1,485 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package server implements a STUN server that answers Binding requests
+// over UDP, TCP and TLS and can be extended with handlers for other methods.
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v2"
+)
+
+// Request is an incoming STUN request or indication.
+//
+// Request and its Message are valid only during Handler call.
+type Request struct {
+	Message    *stun.Message
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+
+	// Set only in RFC 5780 mode, see Discovery.
+	responseOrigin net.Addr
+	otherAddr      net.Addr
+}
+
+// Handler processes request and writes response to res.
+//
+// Before the call res is built as success response to req with the same
+// transaction id and SOFTWARE attribute (if set), so handler only needs
+// to add attributes or change the message class via res.SetType. After
+// the call FINGERPRINT is appended to res and it is sent back to the
+// client. If handler returns error, no response is sent.
+//
+// Responses to indications are never sent.
+type Handler func(req *Request, res *stun.Message) error
+
+// Option sets some server option.
+type Option func(s *Server)
+
+// WithSoftware sets SOFTWARE attribute value that is added to
+// every response.
+func WithSoftware(software string) Option {
+	return func(s *Server) {
+		s.software = stun.NewSoftware(software)
+	}
+}
+
+// WithHandler sets handler for requests and indications with method m,
+// replacing the default one if any.
+func WithHandler(m stun.Method, h Handler) Option {
+	return func(s *Server) {
+		s.handlers[m] = h
+	}
+}
+
+// WithKnownAttributes adds comprehension-required attribute types that
+// are understood by handlers, e.g. ones of custom methods.
+//
+// Requests with other comprehension-required attributes are answered with
+// 420 (Unknown Attribute) error response and such indications are ignored.
+// By default all attributes known to the stun package are understood,
+// except PADDING, and CHANGE-REQUEST and RESPONSE-PORT that are understood
+// only in RFC 5780 mode.
+func WithKnownAttributes(types ...stun.AttrType) Option {
+	return func(s *Server) {
+		s.known.Add(types...)
+	}
+}
+
+// WithLoggerFactory sets the logger factory of server.
+func WithLoggerFactory(f logging.LoggerFactory) Option {
+	return func(s *Server) {
+		s.log = f.NewLogger("stun-server")
+	}
+}
+
+// ErrServerClosed is returned by Serve methods after Close call.
+var ErrServerClosed = errors.New("server is closed")
+
+// ErrUnsupportedNetwork means that network passed to ListenAndServe
+// is not supported.
+var ErrUnsupportedNetwork = errors.New("unsupported network")
+
+// maxPacketSize is size of buffer for reading datagrams.
+const maxPacketSize = 2048
+
+// Server answers STUN requests on any number of packet connections and
+// stream listeners. All methods are goroutine-safe.
+type Server struct {
+	software stun.Software
+	handlers map[stun.Method]Handler
+	log      logging.LeveledLogger
+
+	// Comprehension-required attributes that are understood in plain
+	// and RFC 5780 modes.
+	known          stun.AttrSet
+	discoveryKnown stun.AttrSet
+
+	closed  bool
+	closers map[io.Closer]struct{}
+	wg      sync.WaitGroup
+	mux     sync.Mutex // guards closed and closers
+}
+
+// New initializes new Server from provided options. The Binding method
+// is handled by BindingHandler unless overridden with WithHandler.
+func New(options ...Option) *Server {
+	s := &Server{
+		handlers: map[stun.Method]Handler{
+			stun.MethodBinding: BindingHandler,
+		},
+		closers: make(map[io.Closer]struct{}),
+		known:   stun.KnownAttrs(),
+	}
+	// Not implemented by server.
+	delete(s.known, stun.AttrChangeRequest)
+	delete(s.known, stun.AttrPadding)
+	delete(s.known, stun.AttrResponsePort)
+	for _, o := range options {
+		o(s)
+	}
+	s.discoveryKnown = stun.NewAttrSet(stun.AttrChangeRequest, stun.AttrResponsePort)
+	for t := range s.known {
+		s.discoveryKnown.Add(t)
+	}
+	if s.log == nil {
+		s.log = logging.NewDefaultLoggerFactory().NewLogger("stun-server")
+	}
+	return s
+}
+
+// BindingHandler adds XOR-MAPPED-ADDRESS of req.RemoteAddr to res.
+//
+// RFC 5389 Section 10.1.
+func BindingHandler(req *Request, res *stun.Message) error {
+	ip, port, err := AddrIPPort(req.RemoteAddr)
+	if err != nil {
+		return err
+	}
+	return stun.XORMappedAddress{IP: ip, Port: port}.AddTo(res)
+}
+
+// ErrUnsupportedAddr means that net.Addr is not UDP nor TCP address.
+var ErrUnsupportedAddr = errors.New("unsupported address type")
+
+// AddrIPPort returns IP and port of UDP or TCP address.
+func AddrIPPort(addr net.Addr) (net.IP, int, error) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP, a.Port, nil
+	case *net.TCPAddr:
+		return a.IP, a.Port, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: %T", ErrUnsupportedAddr, addr)
+	}
+}
+
+// track registers c to be closed on Close, returning false if server
+// is already closed.
+func (s *Server) track(c io.Closer) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return false
+	}
+	s.closers[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(c io.Closer) {
+	s.mux.Lock()
+	delete(s.closers, c)
+	s.mux.Unlock()
+	s.wg.Done()
+}
+
+func (s *Server) isClosed() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.closed
+}
+
+// ListenAndServe listens on the named network ("udp", "udp4", "udp6",
+// "tcp", "tcp4" or "tcp6") and address and then serves requests on it,
+// blocking until Close is called or error occurs.
+func (s *Server) ListenAndServe(network, address string) error {
+	switch network {
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(network, address)
+		if err != nil {
+			return err
+		}
+		return s.ServePacket(conn)
+	case "tcp", "tcp4", "tcp6":
+		l, err := net.Listen(network, address)
+		if err != nil {
+			return err
+		}
+		return s.Serve(l)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedNetwork, network)
+	}
+}
+
+// ListenAndServeTLS listens on the named TCP network and address and
+// serves requests over TLS using cfg.
+func (s *Server) ListenAndServeTLS(network, address string, cfg *tls.Config) error {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedNetwork, network)
+	}
+	l, err := tls.Listen(network, address, cfg)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// ServePacket reads datagrams from conn and answers them, blocking until
+// Close is called or conn fails. The conn is closed on return.
+func (s *Server) ServePacket(conn net.PacketConn) error {
+	return s.servePacket(conn, nil)
+}
+
+// servePacket reads datagrams from conn and answers them. If d is set,
+// requests are served in RFC 5780 mode and responses can be sent from
+// other connection of d.
+func (s *Server) servePacket(conn net.PacketConn, d *Discovery) error {
+	if !s.track(conn) {
+		_ = conn.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(conn)
+	defer conn.Close() //nolint:errcheck
+
+	var (
+		buf = make([]byte, maxPacketSize)
+		res = stun.AcquireMessage()
+		req = &Request{Message: stun.AcquireMessage(), LocalAddr: conn.LocalAddr()}
+	)
+	defer stun.ReleaseMessage(res)
+	defer stun.ReleaseMessage(req.Message)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !stun.IsMessage(buf[:n]) {
+			continue
+		}
+		if err = stun.Decode(buf[:n], req.Message); err != nil {
+			s.log.Debugf("failed to decode message from %s: %s", addr, err)
+			continue
+		}
+		req.RemoteAddr = addr
+		out, to := conn, addr
+		if d != nil {
+			out, to, err = d.route(conn, req)
+		}
+		var ok bool
+		if err != nil {
+			// Malformed CHANGE-REQUEST or RESPONSE-PORT, answering from
+			// the receiving socket.
+			s.log.Debugf("failed to route %s from %s: %s", req.Message.Type, addr, err)
+			out, to = conn, addr
+			ok = req.Message.Type.Class == stun.ClassRequest && s.errorResponse(req.Message, res, stun.CodeBadRequest)
+		} else {
+			ok = s.handle(req, res)
+		}
+		if !ok {
+			continue
+		}
+		if _, err = out.WriteTo(res.Raw, to); err != nil {
+			s.log.Warnf("failed to write response to %s: %s", to, err)
+		}
+	}
+}
+
+// Serve accepts stream connections (e.g. TCP or TLS) on l and answers
+// requests on each of them, blocking until Close is called or l fails.
+// The l is closed on return.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l) {
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(l)
+	defer l.Close() //nolint:errcheck
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(conn) {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close() //nolint:errcheck
+	var (
+		res = stun.AcquireMessage()
+		req = &Request{
+			Message:    stun.AcquireMessage(),
+			LocalAddr:  conn.LocalAddr(),
+			RemoteAddr: conn.RemoteAddr(),
+		}
+	)
+	defer stun.ReleaseMessage(res)
+	defer stun.ReleaseMessage(req.Message)
+	for {
+		if err := readStreamMessage(conn, req.Message); err != nil {
+			if !errors.Is(err, io.EOF) && !s.isClosed() {
+				s.log.Debugf("failed to read message from %s: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if !s.handle(req, res) {
+			continue
+		}
+		if _, err := conn.Write(res.Raw); err != nil {
+			s.log.Warnf("failed to write response to %s: %s", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+var errNotSTUNMessage = errors.New("not a STUN message")
+
+// messageHeaderSize is the size of STUN message header.
+const messageHeaderSize = 20
+
+// readStreamMessage reads exactly one STUN message from r into m, using
+// the length from message header to find message boundaries.
+func readStreamMessage(r io.Reader, m *stun.Message) error {
+	m.Raw = m.Raw[:cap(m.Raw)]
+	if len(m.Raw) < messageHeaderSize {
+		m.Raw = make([]byte, maxPacketSize)
+	}
+	if _, err := io.ReadFull(r, m.Raw[:messageHeaderSize]); err != nil {
+		return err
+	}
+	if !stun.IsMessage(m.Raw[:messageHeaderSize]) {
+		return errNotSTUNMessage
+	}
+	size := messageHeaderSize + int(m.Raw[2])<<8 + int(m.Raw[3])
+	if len(m.Raw) < size {
+		m.Raw = append(m.Raw, make([]byte, size-len(m.Raw))...)
+	}
+	if _, err := io.ReadFull(r, m.Raw[messageHeaderSize:size]); err != nil {
+		return err
+	}
+	m.Raw = m.Raw[:size]
+	return m.Decode()
+}
+
+// handle processes req, building response to res. Returns true if res
+// should be sent back.
+func (s *Server) handle(req *Request, res *stun.Message) bool {
+	t := req.Message.Type
+	switch t.Class {
+	case stun.ClassRequest, stun.ClassIndication:
+	default:
+		// Responses are not handled by server.
+		return false
+	}
+	h, ok := s.handlers[t.Method]
+	if !ok {
+		if t.Class == stun.ClassIndication {
+			return false
+		}
+		// Unknown method, RFC 5389 Section 7.3.1.
+		return s.errorResponse(req.Message, res, stun.CodeBadRequest)
+	}
+	known := s.known
+	if req.otherAddr != nil {
+		known = s.discoveryKnown
+	}
+	if unknown := req.Message.UnknownRequired(known); len(unknown) > 0 {
+		if t.Class == stun.ClassIndication {
+			return false
+		}
+		// RFC 8489 Section 6.3.1.1.
+		if err := s.buildResponse(req.Message, res, stun.ClassErrorResponse); err != nil {
+			s.log.Warnf("failed to build error response: %s", err)
+			return false
+		}
+		for _, setter := range []stun.Setter{stun.CodeUnknownAttribute, unknown} {
+			if err := setter.AddTo(res); err != nil {
+				s.log.Warnf("failed to build error response: %s", err)
+				return false
+			}
+		}
+		return s.addFingerprint(res)
+	}
+	if err := s.buildResponse(req.Message, res, stun.ClassSuccessResponse); err != nil {
+		s.log.Warnf("failed to build response: %s", err)
+		return false
+	}
+	if err := h(req, res); err != nil {
+		s.log.Debugf("%s from %s not handled: %s", t, req.RemoteAddr, err)
+		return false
+	}
+	if err := req.addDiscoveryAttributes(res); err != nil {
+		s.log.Warnf("failed to add NAT discovery attributes: %s", err)
+		return false
+	}
+	if t.Class == stun.ClassIndication {
+		return false
+	}
+	return s.addFingerprint(res)
+}
+
+// buildResponse resets res to response of class c to req, adding SOFTWARE
+// attribute if set.
+func (s *Server) buildResponse(req, res *stun.Message, c stun.MessageClass) error {
+	if err := res.Build(req, stun.NewType(req.Type.Method, c)); err != nil {
+		return err
+	}
+	if len(s.software) == 0 {
+		return nil
+	}
+	return s.software.AddTo(res)
+}
+
+// errorResponse builds error response to req with code to res. Returns
+// true if res should be sent back.
+func (s *Server) errorResponse(req, res *stun.Message, code stun.ErrorCode) bool {
+	if err := s.buildResponse(req, res, stun.ClassErrorResponse); err != nil {
+		s.log.Warnf("failed to build error response: %s", err)
+		return false
+	}
+	if err := code.AddTo(res); err != nil {
+		s.log.Warnf("failed to build error response: %s", err)
+		return false
+	}
+	return s.addFingerprint(res)
+}
+
+func (s *Server) addFingerprint(res *stun.Message) bool {
+	if err := stun.Fingerprint.AddTo(res); err != nil {
+		s.log.Warnf("failed to add fingerprint: %s", err)
+		return false
+	}
+	return true
+}
+
+// Close closes all connections and listeners served by s and waits until
+// all Serve calls return.
+func (s *Server) Close() error {
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return ErrServerClosed
+	}
+	s.closed = true
+	var closeErr error
+	for c := range s.closers {
+		if err := c.Close(); err != nil && !errors.Is(err, net.ErrClosed) && closeErr == nil {
+			closeErr = err
+		}
+	}
+	s.mux.Unlock()
+	s.wg.Wait()
+	return closeErr
+}
@@ -0,0 +1,298 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package server
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/pion/stun/v2"
+)
+
+var errTestHandler = errors.New("handler error")
+
+func startPacket(t *testing.T, s *Server) net.Addr {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if serveErr := s.ServePacket(conn); !errors.Is(serveErr, ErrServerClosed) {
+			t.Error(serveErr)
+		}
+	}()
+	return conn.LocalAddr()
+}
+
+func startStream(t *testing.T, s *Server) net.Addr {
+	t.Helper()
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if serveErr := s.Serve(l); !errors.Is(serveErr, ErrServerClosed) {
+			t.Error(serveErr)
+		}
+	}()
+	return l.Addr()
+}
+
+func do(t *testing.T, c *stun.Client, m *stun.Message) *stun.Message {
+	t.Helper()
+	res := new(stun.Message)
+	if err := c.Do(m, func(e stun.Event) {
+		if e.Error != nil {
+			t.Error(e.Error)
+			return
+		}
+		if err := e.Message.CloneTo(res); err != nil {
+			t.Error(err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func checkBinding(t *testing.T, res *stun.Message, local net.Addr) {
+	t.Helper()
+	if res.Type != stun.BindingSuccess {
+		t.Fatalf("unexpected type %s", res.Type)
+	}
+	if err := stun.Fingerprint.Check(res); err != nil {
+		t.Error(err)
+	}
+	var software stun.Software
+	if err := software.GetFrom(res); err != nil {
+		t.Error(err)
+	}
+	if software.String() != "test" {
+		t.Errorf("unexpected software %q", software)
+	}
+	var xorAddr stun.XORMappedAddress
+	if err := xorAddr.GetFrom(res); err != nil {
+		t.Fatal(err)
+	}
+	if xorAddr.String() != local.String() {
+		t.Errorf("XOR-MAPPED-ADDRESS %s != %s", xorAddr, local)
+	}
+}
+
+func TestServer_Binding(t *testing.T) {
+	t.Run("UDP", func(t *testing.T) {
+		s := New(WithSoftware("test"))
+		addr := startPacket(t, s)
+		conn, err := net.Dial("udp4", addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := stun.NewClient(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := do(t, c, stun.MustBuild(stun.TransactionID, stun.BindingRequest, stun.Fingerprint))
+		checkBinding(t, res, conn.LocalAddr())
+		if err = c.Close(); err != nil {
+			t.Error(err)
+		}
+		if err = s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("TCP", func(t *testing.T) {
+		s := New(WithSoftware("test"))
+		addr := startStream(t, s)
+		conn, err := net.Dial("tcp4", addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := stun.NewClient(conn, stun.WithNoRetransmit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			res := do(t, c, stun.MustBuild(stun.TransactionID, stun.BindingRequest))
+			checkBinding(t, res, conn.LocalAddr())
+		}
+		if err = c.Close(); err != nil {
+			t.Error(err)
+		}
+		if err = s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestServer_Handler(t *testing.T) {
+	var gotIndication bool
+	indicated := make(chan struct{})
+	s := New(
+		WithHandler(stun.MethodAllocate, func(req *Request, res *stun.Message) error {
+			var username stun.Username
+			if err := username.GetFrom(req.Message); err != nil {
+				res.SetType(stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse))
+				return stun.CodeBadRequest.AddTo(res)
+			}
+			return username.AddTo(res)
+		}),
+		WithHandler(stun.MethodSend, func(req *Request, res *stun.Message) error {
+			gotIndication = true
+			close(indicated)
+			return nil
+		}),
+		WithHandler(stun.MethodRefresh, func(req *Request, res *stun.Message) error {
+			return errTestHandler
+		}),
+	)
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	addr := startPacket(t, s)
+	c, err := stun.Dial("udp4", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if closeErr := c.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	}()
+	allocate := stun.NewType(stun.MethodAllocate, stun.ClassRequest)
+	t.Run("Success", func(t *testing.T) {
+		res := do(t, c, stun.MustBuild(stun.TransactionID, allocate, stun.NewUsername("user")))
+		if res.Type != stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse) {
+			t.Fatalf("unexpected type %s", res.Type)
+		}
+		if res.Contains(stun.AttrSoftware) {
+			t.Error("unexpected SOFTWARE")
+		}
+		var username stun.Username
+		if err := username.GetFrom(res); err != nil {
+			t.Fatal(err)
+		}
+		if username.String() != "user" {
+			t.Errorf("unexpected username %q", username)
+		}
+	})
+	t.Run("Error", func(t *testing.T) {
+		res := do(t, c, stun.MustBuild(stun.TransactionID, allocate))
+		var code stun.ErrorCodeAttribute
+		if err := code.GetFrom(res); err != nil {
+			t.Fatal(err)
+		}
+		if code.Code != stun.CodeBadRequest {
+			t.Errorf("unexpected code %d", code.Code)
+		}
+	})
+	t.Run("UnknownMethod", func(t *testing.T) {
+		res := do(t, c, stun.MustBuild(stun.TransactionID,
+			stun.NewType(stun.MethodChannelBind, stun.ClassRequest),
+		))
+		if res.Type.Class != stun.ClassErrorResponse {
+			t.Fatalf("unexpected type %s", res.Type)
+		}
+		var code stun.ErrorCodeAttribute
+		if err := code.GetFrom(res); err != nil {
+			t.Fatal(err)
+		}
+		if code.Code != stun.CodeBadRequest {
+			t.Errorf("unexpected code %d", code.Code)
+		}
+	})
+	t.Run("Indication", func(t *testing.T) {
+		if err := c.Indicate(stun.MustBuild(stun.TransactionID,
+			stun.NewType(stun.MethodSend, stun.ClassIndication),
+		)); err != nil {
+			t.Fatal(err)
+		}
+		<-indicated
+		if !gotIndication {
+			t.Error("indication not handled")
+		}
+	})
+}
+
+func TestServer_UnknownAttributes(t *testing.T) {
+	s := New(WithKnownAttributes(0x7001))
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	addr := startPacket(t, s)
+	c, err := stun.Dial("udp4", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if closeErr := c.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	}()
+	res := do(t, c, stun.MustBuild(stun.TransactionID, stun.BindingRequest,
+		stun.RawAttribute{Type: 0x7001}, stun.RawAttribute{Type: 0x8001},
+	))
+	if res.Type != stun.BindingSuccess {
+		t.Errorf("unexpected type %s", res.Type)
+	}
+	var unknownErr stun.UnknownAttributeError
+	if err = c.Do(stun.MustBuild(stun.TransactionID, stun.BindingRequest,
+		stun.ChangeRequest{ChangeIP: true}, stun.RawAttribute{Type: 0x7002},
+	), func(e stun.Event) {
+		if !errors.As(e.Error, &unknownErr) {
+			t.Errorf("unexpected error %v", e.Error)
+			return
+		}
+		if err := stun.Fingerprint.Check(e.Message); err != nil {
+			t.Error(err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(unknownErr.Attributes) != 2 ||
+		unknownErr.Attributes[0] != stun.AttrChangeRequest || unknownErr.Attributes[1] != 0x7002 {
+		t.Errorf("unexpected attributes: %s", unknownErr.Attributes)
+	}
+}
+
+func TestServer_Close(t *testing.T) {
+	s := New()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("unexpected error %v", err)
+	}
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ServePacket(conn); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = s.ListenAndServe("ip4", "127.0.0.1:0"); !errors.Is(err, ErrUnsupportedNetwork) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestAddrIPPort(t *testing.T) {
+	if _, _, err := AddrIPPort(&net.IPAddr{}); !errors.Is(err, ErrUnsupportedAddr) {
+		t.Errorf("unexpected error %v", err)
+	}
+	ip, port, err := AddrIPPort(&net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.IPv4(1, 2, 3, 4)) || port != 5 {
+		t.Errorf("unexpected %s:%d", ip, port)
+	}
+}
@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// Framing is the way messages are delimited on connection.
+type Framing byte
+
+// Possible framings.
+const (
+	// FramingAuto selects FramingStream for TCP connections (including
+	// TLS over TCP) and FramingDatagram otherwise.
+	FramingAuto Framing = iota
+	// FramingDatagram means that every Read returns single message,
+	// as on UDP and DTLS.
+	FramingDatagram
+	// FramingStream means that message boundaries are determined from
+	// the STUN header length and ChannelData length, as on TCP and TLS.
+	//
+	// RFC 8489 Section 6.2.2 and RFC 5766 Section 11.5
+	FramingStream
+	// FramingRFC4571 means that every message is prefixed by 16-bit
+	// length, as for ICE-TCP.
+	//
+	// RFC 4571 Section 2 and RFC 6544 Section 3
+	FramingRFC4571
+)
+
+func (f Framing) String() string {
+	switch f {
+	case FramingAuto:
+		return "auto"
+	case FramingDatagram:
+		return "datagram"
+	case FramingStream:
+		return "stream"
+	case FramingRFC4571:
+		return "RFC 4571"
+	default:
+		return "unknown"
+	}
+}
+
+// detectFraming returns framing for conn, assuming stream for
+// connections with TCP local address.
+func detectFraming(conn Connection) Framing {
+	type localAddr interface {
+		LocalAddr() net.Addr
+	}
+	if c, ok := conn.(localAddr); ok {
+		if _, isTCP := c.LocalAddr().(*net.TCPAddr); isTCP {
+			return FramingStream
+		}
+	}
+	return FramingDatagram
+}
+
+const (
+	// rfc4571HeaderSize is the size of RFC 4571 length prefix.
+	rfc4571HeaderSize = 2
+	// defaultStreamBufferSize is the initial size of StreamReader
+	// buffer, it grows if larger message is received.
+	defaultStreamBufferSize = 2048
+)
+
+// ErrInvalidFrame means that stream data is neither STUN message nor
+// ChannelData, so message boundaries are lost.
+var ErrInvalidFrame = errors.New("invalid frame: neither STUN message nor ChannelData")
+
+// StreamReader reads STUN messages and TURN ChannelData messages from
+// stream transport, where single Read can return partial message or
+// multiple messages.
+type StreamReader struct {
+	r       io.Reader
+	rfc4571 bool
+	buf     []byte
+	start   int // start of unread data in buf
+	end     int // end of unread data in buf
+}
+
+// NewStreamReader returns StreamReader that uses STUN header length
+// and ChannelData length with padding to delimit messages.
+func NewStreamReader(r io.Reader) *StreamReader {
+	return &StreamReader{
+		r:   r,
+		buf: make([]byte, defaultStreamBufferSize),
+	}
+}
+
+// NewRFC4571Reader returns StreamReader that uses RFC 4571 16-bit
+// length prefix to delimit messages.
+func NewRFC4571Reader(r io.Reader) *StreamReader {
+	s := NewStreamReader(r)
+	s.rfc4571 = true
+	return s
+}
+
+// fill reads from underlying reader until at least n unread bytes
+// are buffered.
+func (s *StreamReader) fill(n int) error {
+	if s.end-s.start >= n {
+		return nil
+	}
+	if s.start+n > len(s.buf) {
+		// Moving unread data to the beginning, growing if needed.
+		if n > len(s.buf) {
+			buf := make([]byte, n)
+			s.end = copy(buf, s.buf[s.start:s.end])
+			s.buf = buf
+		} else {
+			s.end = copy(s.buf, s.buf[s.start:s.end])
+		}
+		s.start = 0
+	}
+	for s.end-s.start < n {
+		read, err := s.r.Read(s.buf[s.end:])
+		s.end += read
+		if err != nil {
+			if errors.Is(err, io.EOF) && s.end-s.start > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// frameSize returns size of the frame that starts with header. The two
+// most significant bits are 0b00 for STUN and 0b01 for ChannelData.
+func frameSize(header []byte) (int, error) {
+	switch header[0] >> 6 {
+	case 0:
+		return messageHeaderSize + int(bin.Uint16(header[2:4])), nil
+	case 1:
+		return ChannelDataSize(header, true), nil
+	default:
+		return 0, ErrInvalidFrame
+	}
+}
+
+// Next returns next message, which is either STUN message or
+// ChannelData. The returned slice is valid only until the next call.
+// After an error, the reader can not be used as message boundaries
+// are lost. Returns io.EOF only if stream ended on message boundary.
+func (s *StreamReader) Next() ([]byte, error) {
+	var (
+		prefix int
+		size   int
+	)
+	if s.rfc4571 {
+		if err := s.fill(rfc4571HeaderSize); err != nil {
+			return nil, err
+		}
+		prefix = rfc4571HeaderSize
+		size = int(bin.Uint16(s.buf[s.start : s.start+rfc4571HeaderSize]))
+	} else {
+		if err := s.fill(channelDataHeaderSize); err != nil {
+			return nil, err
+		}
+		var err error
+		if size, err = frameSize(s.buf[s.start : s.start+channelDataHeaderSize]); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.fill(prefix + size); err != nil {
+		return nil, err
+	}
+	frame := s.buf[s.start+prefix : s.start+prefix+size]
+	s.start += prefix + size
+	if s.start == s.end {
+		s.start, s.end = 0, 0
+	}
+	return frame, nil
+}
+
+// rfc4571Conn prefixes every write with RFC 4571 length.
+type rfc4571Conn struct {
+	Connection
+}
+
+// ErrFrameTooLarge means that message does not fit into RFC 4571 frame.
+var ErrFrameTooLarge = errors.New("message is too large for RFC 4571 frame")
+
+func (c rfc4571Conn) Write(b []byte) (int, error) {
+	if len(b) > 0xFFFF {
+		return 0, ErrFrameTooLarge
+	}
+	buf := make([]byte, rfc4571HeaderSize+len(b))
+	bin.PutUint16(buf, uint16(len(b)))
+	copy(buf[rfc4571HeaderSize:], b)
+	n, err := c.Connection.Write(buf)
+	n -= rfc4571HeaderSize
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
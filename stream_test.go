@@ -0,0 +1,269 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// streamFrames returns messages for stream tests: STUN messages and
+// padded ChannelData, including one larger than the default buffer.
+func streamFrames(t *testing.T) [][]byte {
+	t.Helper()
+	large := &ChannelData{Number: MinChannelNumber, Data: make([]byte, 3001), Padded: true}
+	large.Encode()
+	small := &ChannelData{Number: MaxChannelNumber, Data: []byte{1, 2, 3}, Padded: true}
+	small.Encode()
+	empty := &ChannelData{Number: MinChannelNumber, Padded: true}
+	empty.Encode()
+	return [][]byte{
+		MustBuild(TransactionID, BindingRequest, NewSoftware("software"), Fingerprint).Raw,
+		small.Raw,
+		MustBuild(TransactionID, BindingSuccess).Raw,
+		large.Raw,
+		empty.Raw,
+		MustBuild(TransactionID, BindingRequest, NewUsername("user")).Raw,
+	}
+}
+
+func TestStreamReader(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		rfc4571 bool
+		reader  func(io.Reader) io.Reader
+	}{
+		{"OneByte", false, iotest.OneByteReader},
+		{"HalfChunks", false, iotest.HalfReader},
+		{"SingleChunk", false, func(r io.Reader) io.Reader { return r }},
+		{"RFC4571/OneByte", true, iotest.OneByteReader},
+		{"RFC4571/SingleChunk", true, func(r io.Reader) io.Reader { return r }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			frames := streamFrames(t)
+			var buf bytes.Buffer
+			for _, f := range frames {
+				if tc.rfc4571 {
+					if _, err := (rfc4571Conn{Connection: &bufferConnection{&buf}}).Write(f); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				buf.Write(f)
+			}
+			var r *StreamReader
+			if tc.rfc4571 {
+				r = NewRFC4571Reader(tc.reader(&buf))
+			} else {
+				r = NewStreamReader(tc.reader(&buf))
+			}
+			for i, f := range frames {
+				got, err := r.Next()
+				if err != nil {
+					t.Fatalf("%d: %v", i, err)
+				}
+				if !bytes.Equal(got, f) {
+					t.Fatalf("%d: unexpected frame", i)
+				}
+			}
+			if _, err := r.Next(); !errors.Is(err, io.EOF) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestStreamReader_Errors(t *testing.T) {
+	m := MustBuild(TransactionID, BindingRequest)
+	for _, tc := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"Invalid", []byte{0x80, 0, 0, 0}, ErrInvalidFrame},
+		{"TruncatedHeader", []byte{0, 1}, io.ErrUnexpectedEOF},
+		{"TruncatedMessage", m.Raw[:len(m.Raw)-1], io.ErrUnexpectedEOF},
+		// ChannelData must be padded on streams.
+		{"TruncatedPadding", []byte{0x40, 0, 0, 1, 1}, io.ErrUnexpectedEOF},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewStreamReader(bytes.NewReader(tc.data))
+			if _, err := r.Next(); !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestRFC4571Conn_Write(t *testing.T) {
+	var buf bytes.Buffer
+	c := rfc4571Conn{Connection: &bufferConnection{&buf}}
+	n, err := c.Write([]byte{1, 2, 3})
+	if err != nil || n != 3 {
+		t.Fatalf("unexpected %d, %v", n, err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{0, 3, 1, 2, 3}) {
+		t.Errorf("unexpected 0x%x", buf.Bytes())
+	}
+	if _, err = c.Write(make([]byte, 0x10000)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestFraming_String(t *testing.T) {
+	for f, s := range map[Framing]string{
+		FramingAuto:     "auto",
+		FramingDatagram: "datagram",
+		FramingStream:   "stream",
+		FramingRFC4571:  "RFC 4571",
+		Framing(100):    "unknown",
+	} {
+		if f.String() != s {
+			t.Errorf("%q != %q", f, s)
+		}
+	}
+}
+
+// bufferConnection is Connection that writes to and reads from buffer.
+type bufferConnection struct {
+	*bytes.Buffer
+}
+
+func (bufferConnection) Close() error { return nil }
+
+func TestDetectFraming(t *testing.T) {
+	if f := detectFraming(&bufferConnection{}); f != FramingDatagram {
+		t.Errorf("unexpected %s", f)
+	}
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close() //nolint:errcheck
+	conn, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint:errcheck
+	if f := detectFraming(conn); f != FramingStream {
+		t.Errorf("unexpected %s", f)
+	}
+}
+
+// TestClient_Stream checks that client handles responses that are split
+// or coalesced with ChannelData on stream connection.
+func TestClient_Stream(t *testing.T) {
+	for _, framing := range []Framing{FramingStream, FramingRFC4571} {
+		t.Run(framing.String(), func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer serverConn.Close() //nolint:errcheck
+			received := make(chan []byte, 1)
+			c, err := NewClient(clientConn,
+				WithFraming(framing),
+				WithChannelDataHandler(func(cd *ChannelData) {
+					received <- append([]byte{}, cd.Data...)
+				}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close() //nolint:errcheck
+			go func() {
+				r := NewStreamReader(serverConn)
+				if framing == FramingRFC4571 {
+					r = NewRFC4571Reader(serverConn)
+				}
+				for {
+					b, err := r.Next()
+					if err != nil {
+						return
+					}
+					req := new(Message)
+					if err = Decode(b, req); err != nil {
+						t.Error(err)
+						return
+					}
+					cd := &ChannelData{Number: MinChannelNumber, Data: []byte{1}, Padded: true}
+					cd.Encode()
+					res := MustBuild(req, BindingSuccess, NewSoftware("server"), Fingerprint)
+					// Capturing frames to write them byte by byte, so
+					// client reads are split.
+					var out bytes.Buffer
+					frameConn := Connection(&bufferConnection{&out})
+					if framing == FramingRFC4571 {
+						frameConn = rfc4571Conn{Connection: frameConn}
+					}
+					if _, err = frameConn.Write(cd.Raw); err != nil {
+						t.Error(err)
+						return
+					}
+					if _, err = frameConn.Write(res.Raw); err != nil {
+						t.Error(err)
+						return
+					}
+					for _, b := range out.Bytes() {
+						if _, err = serverConn.Write([]byte{b}); err != nil {
+							return
+						}
+					}
+				}
+			}()
+			for i := 0; i < 3; i++ {
+				if err = c.Do(MustBuild(TransactionID, BindingRequest), func(e Event) {
+					if e.Error != nil {
+						t.Error(e.Error)
+					}
+				}); err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case data := <-received:
+					if !bytes.Equal(data, []byte{1}) {
+						t.Errorf("unexpected data %v", data)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("ChannelData is not received")
+				}
+			}
+		})
+	}
+}
+
+func TestClient_WriteChannelData(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close() //nolint:errcheck
+	c, err := NewClient(clientConn, WithFraming(FramingRFC4571))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close() //nolint:errcheck
+	go func() {
+		if err := c.WriteChannelData(&ChannelData{
+			Number: MinChannelNumber,
+			Data:   []byte{1, 2, 3},
+		}); err != nil {
+			t.Error(err)
+		}
+	}()
+	b, err := NewRFC4571Reader(serverConn).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ChannelData{Number: MinChannelNumber, Data: []byte{1, 2, 3}, Padded: true}
+	expected.Encode()
+	if !bytes.Equal(b, expected.Raw) {
+		t.Errorf("unexpected frame %v", b)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.WriteChannelData(&ChannelData{Number: MinChannelNumber}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -108,6 +108,34 @@ func (n *Nonce) GetFrom(m *Message) error {
 	return (*TextAttribute)(n).GetFromAs(m, AttrNonce)
 }
 
+// NewAlternateDomain returns AlternateDomain with provided value.
+func NewAlternateDomain(domain string) AlternateDomain {
+	return AlternateDomain(domain)
+}
+
+// AlternateDomain represents ALTERNATE-DOMAIN attribute, the domain name
+// that is used to verify certificate of alternate server when using TLS
+// or DTLS.
+//
+// RFC 8489 Section 14.16
+type AlternateDomain []byte
+
+func (d AlternateDomain) String() string {
+	return string(d)
+}
+
+const maxAlternateDomainB = 255
+
+// AddTo adds ALTERNATE-DOMAIN to message.
+func (d AlternateDomain) AddTo(m *Message) error {
+	return TextAttribute(d).AddToAs(m, AttrAlternateDomain, maxAlternateDomainB)
+}
+
+// GetFrom gets ALTERNATE-DOMAIN from message.
+func (d *AlternateDomain) GetFrom(m *Message) error {
+	return (*TextAttribute)(d).GetFromAs(m, AttrAlternateDomain)
+}
+
 // TextAttribute is helper for adding and getting text attributes.
 type TextAttribute []byte
 
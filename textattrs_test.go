@@ -268,3 +268,21 @@ func BenchmarkNonce_GetFrom(b *testing.B) {
 		n.GetFrom(m) //nolint:errcheck,gosec
 	}
 }
+
+func TestAlternateDomain(t *testing.T) {
+	m := New()
+	d := NewAlternateDomain("stun.example.org")
+	if err := m.Build(d); err != nil {
+		t.Fatal(err)
+	}
+	var got AlternateDomain
+	if err := got.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "stun.example.org" {
+		t.Errorf("unexpected domain %s", got)
+	}
+	if err := AlternateDomain(make([]byte, 256)).AddTo(New()); !IsAttrSizeOverflow(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
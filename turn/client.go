@@ -0,0 +1,599 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package turn implements TURN client (RFC 5766) on top of stun.Client.
+package turn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v2"
+)
+
+// Lifetimes and refresh intervals.
+//
+// RFC 5766 Sections 8 and 11
+const (
+	// Permissions live 5 minutes and channel bindings 10 minutes.
+	permissionRefresh     = 4 * time.Minute
+	channelBindingRefresh = 5 * time.Minute
+
+	// refreshCheckInterval is the rate of checking permissions and
+	// channel bindings for refresh.
+	refreshCheckInterval = 30 * time.Second
+	// refreshRetryInterval is the delay before retrying failed
+	// allocation refresh.
+	refreshRetryInterval = 5 * time.Second
+	// minRefreshInterval limits the rate of allocation refreshes when
+	// server grants too short lifetime.
+	minRefreshInterval = time.Second
+)
+
+var (
+	// ErrAlreadyAllocated means that Allocate was called while client
+	// has an allocation.
+	ErrAlreadyAllocated = errors.New("already allocated")
+	// ErrNoAllocation means that client has no allocation.
+	ErrNoAllocation = errors.New("no allocation")
+	// ErrClientClosed means that client is closed.
+	ErrClientClosed = errors.New("client is closed")
+	// ErrNoChannelNumber means that all channel numbers are in use.
+	ErrNoChannelNumber = errors.New("no free channel number")
+	// ErrUnsupportedAddr means that address is not UDP or TCP.
+	ErrUnsupportedAddr = errors.New("unsupported address type")
+	// ErrUnexpectedResponse means that response is not valid.
+	ErrUnexpectedResponse = errors.New("unexpected response")
+)
+
+// ResponseErr is returned when server responds with error.
+//
+//nolint:errname
+type ResponseErr struct {
+	Method stun.Method
+	Code   stun.ErrorCodeAttribute
+}
+
+func (e ResponseErr) Error() string {
+	return fmt.Sprintf("%s error response: %s", e.Method, e.Code)
+}
+
+// ClientConfig is used to pass configuration to NewClient().
+type ClientConfig struct {
+	// Conn is the connection to TURN server. UDP connection should be
+	// connected, e.g. created by net.Dial.
+	Conn stun.Connection
+
+	// Username and Password are long-term credentials. If Username is
+	// empty, requests are sent without credentials.
+	Username string
+	Password string
+
+	// Software is SOFTWARE attribute value, empty to disable.
+	Software string
+
+	// Lifetime is the requested allocation lifetime, zero means server
+	// default. Server can choose another value.
+	Lifetime time.Duration
+
+	// Options are passed to stun.NewClient.
+	Options []stun.ClientOption
+
+	LoggerFactory logging.LoggerFactory
+}
+
+// Client is TURN client that manages single allocation on the server.
+type Client struct {
+	stun     *stun.Client
+	software stun.Software
+	lifetime time.Duration
+	log      logging.LeveledLogger
+	wg       sync.WaitGroup // refresh loops
+	binds    sync.Mutex     // serializes BindChannel calls
+
+	mux         sync.Mutex // guards fields below
+	closed      bool
+	allocating  bool
+	relay       *RelayConn
+	permissions map[string]time.Time       // IP -> last refresh
+	channels    map[string]*channelBinding // peer address -> binding
+	numbers     map[stun.ChannelNumber]*channelBinding
+	nextChannel stun.ChannelNumber
+}
+
+// channelBinding represents channel bound to the peer address.
+type channelBinding struct {
+	number    stun.ChannelNumber
+	peer      *net.UDPAddr
+	refreshed time.Time
+}
+
+// NewClient initializes TURN client on cfg.Conn. Call Allocate to
+// get the relay.
+func NewClient(cfg *ClientConfig) (*Client, error) {
+	c := &Client{
+		software:    stun.NewSoftware(cfg.Software),
+		lifetime:    cfg.Lifetime,
+		permissions: make(map[string]time.Time),
+		channels:    make(map[string]*channelBinding),
+		numbers:     make(map[stun.ChannelNumber]*channelBinding),
+		nextChannel: stun.MinChannelNumber,
+	}
+	loggerFactory := cfg.LoggerFactory
+	if loggerFactory == nil {
+		loggerFactory = logging.NewDefaultLoggerFactory()
+	}
+	c.log = loggerFactory.NewLogger("turn")
+	options := append([]stun.ClientOption{}, cfg.Options...)
+	options = append(options,
+		stun.WithHandler(c.handleEvent),
+		stun.WithChannelDataHandler(c.handleChannelData),
+	)
+	if cfg.Username != "" {
+		options = append(options, stun.WithCredentials(cfg.Username, cfg.Password))
+	}
+	var err error
+	if c.stun, err = stun.NewClient(cfg.Conn, options...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// do performs request transaction, returning the response or ResponseErr.
+func (c *Client) do(method stun.Method, setters ...stun.Setter) (*stun.Message, error) {
+	all := []stun.Setter{stun.TransactionID, stun.NewType(method, stun.ClassRequest)}
+	all = append(all, setters...)
+	if len(c.software) > 0 {
+		all = append(all, c.software)
+	}
+	all = append(all, stun.Fingerprint)
+	req, err := stun.Build(all...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		res    *stun.Message
+		resErr error
+	)
+	if err = c.stun.Do(req, func(e stun.Event) {
+		if e.Error != nil {
+			resErr = e.Error
+			return
+		}
+		res = new(stun.Message)
+		resErr = e.Message.CloneTo(res)
+	}); err != nil {
+		return nil, err
+	}
+	if resErr != nil {
+		return nil, resErr
+	}
+	if res.Type.Method != method {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, res.Type)
+	}
+	if res.Type.Class == stun.ClassErrorResponse {
+		var code stun.ErrorCodeAttribute
+		if err = code.GetFrom(res); err != nil {
+			return nil, err
+		}
+		return res, ResponseErr{Method: method, Code: code}
+	}
+	return res, nil
+}
+
+// Allocate requests UDP relay from the server. The allocation is refreshed
+// until RelayConn is closed or server rejects the refresh with 401, 403 or
+// 437 error, after which the allocation is considered lost.
+//
+// RFC 5766 Section 6
+func (c *Client) Allocate() (*RelayConn, error) {
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		return nil, ErrClientClosed
+	}
+	if c.relay != nil || c.allocating {
+		c.mux.Unlock()
+		return nil, ErrAlreadyAllocated
+	}
+	// Not holding the lock during transaction, because it is also
+	// used while handling indications.
+	c.allocating = true
+	c.mux.Unlock()
+	defer func() {
+		c.mux.Lock()
+		c.allocating = false
+		c.mux.Unlock()
+	}()
+	setters := []stun.Setter{stun.RequestedTransport{Protocol: stun.TransportUDP}}
+	if c.lifetime > 0 {
+		setters = append(setters, stun.Lifetime{Duration: c.lifetime})
+	}
+	res, err := c.do(stun.MethodAllocate, setters...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		relayed  stun.XORRelayedAddress
+		mapped   stun.XORMappedAddress
+		lifetime stun.Lifetime
+	)
+	if err = res.Parse(&relayed, &lifetime); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
+	}
+	r := newRelayConn(c, &net.UDPAddr{IP: relayed.IP, Port: relayed.Port})
+	if mapped.GetFrom(res) == nil {
+		r.mapped = &net.UDPAddr{IP: mapped.IP, Port: mapped.Port}
+	}
+	c.mux.Lock()
+	if c.closed {
+		// Client was closed during transaction, so refresh loop must not
+		// be started.
+		c.mux.Unlock()
+		if _, err = c.refresh(&stun.Lifetime{}); err != nil {
+			c.log.Debugf("Failed to delete allocation: %s", err)
+		}
+		return nil, ErrClientClosed
+	}
+	c.relay = r
+	c.wg.Add(1)
+	c.mux.Unlock()
+	go c.refreshLoop(r, lifetime.Duration)
+	return r, nil
+}
+
+// refresh sends Refresh request with optional LIFETIME and returns the
+// lifetime that server granted. Use zero lifetime to delete allocation.
+//
+// RFC 5766 Section 7
+func (c *Client) refresh(lifetime *stun.Lifetime) (time.Duration, error) {
+	var setters []stun.Setter
+	if lifetime != nil {
+		setters = append(setters, lifetime)
+	}
+	res, err := c.do(stun.MethodRefresh, setters...)
+	if err != nil {
+		return 0, err
+	}
+	var granted stun.Lifetime
+	if err = granted.GetFrom(res); err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
+	}
+	return granted.Duration, nil
+}
+
+// refreshLoop refreshes allocation of r before its lifetime expires,
+// along with permissions and channel bindings, until r is closed.
+func (c *Client) refreshLoop(r *RelayConn, lifetime time.Duration) {
+	defer c.wg.Done()
+	allocation := time.NewTimer(refreshInterval(lifetime))
+	defer allocation.Stop()
+	check := time.NewTicker(refreshCheckInterval)
+	defer check.Stop()
+	for {
+		select {
+		case <-r.closed:
+			return
+		case <-allocation.C:
+			var requested *stun.Lifetime
+			if c.lifetime > 0 {
+				requested = &stun.Lifetime{Duration: c.lifetime}
+			}
+			granted, err := c.refresh(requested)
+			if isAllocationLost(err) {
+				c.log.Errorf("Failed to refresh allocation, stopping: %s", err)
+				// Allocation is already gone on server, nothing to delete.
+				_ = r.close(false)
+				return
+			}
+			if err != nil {
+				c.log.Warnf("Failed to refresh allocation: %s", err)
+				allocation.Reset(refreshRetryInterval)
+				continue
+			}
+			allocation.Reset(refreshInterval(granted))
+		case now := <-check.C:
+			c.refreshPermissions(now)
+		}
+	}
+}
+
+// refreshInterval returns the delay before refreshing allocation with
+// lifetime, which is half of lifetime, but not less than
+// minRefreshInterval.
+func refreshInterval(lifetime time.Duration) time.Duration {
+	if lifetime/2 < minRefreshInterval {
+		return minRefreshInterval
+	}
+	return lifetime / 2
+}
+
+// isAllocationLost reports whether err is refresh error response after
+// which retries are pointless: the allocation does not exist or
+// credentials are rejected.
+func isAllocationLost(err error) bool {
+	var resErr ResponseErr
+	if !errors.As(err, &resErr) {
+		return false
+	}
+	switch resErr.Code.Code {
+	case stun.CodeUnauthorized, stun.CodeForbidden, stun.CodeAllocMismatch:
+		return true
+	default:
+		return false
+	}
+}
+
+// refreshPermissions refreshes permissions and channel bindings that
+// would expire soon.
+func (c *Client) refreshPermissions(now time.Time) {
+	var (
+		peers    []net.Addr
+		bindings []*channelBinding
+	)
+	c.mux.Lock()
+	for _, b := range c.channels {
+		if now.Sub(b.refreshed) >= channelBindingRefresh {
+			bindings = append(bindings, b)
+		}
+	}
+	for ip, refreshed := range c.permissions {
+		if now.Sub(refreshed) >= permissionRefresh {
+			peers = append(peers, &net.UDPAddr{IP: net.ParseIP(ip)})
+		}
+	}
+	c.mux.Unlock()
+	for _, b := range bindings {
+		if err := c.bindChannel(b.number, b.peer); err != nil {
+			c.log.Warnf("Failed to refresh channel binding %s: %s", b.number, err)
+		}
+	}
+	if len(peers) == 0 {
+		return
+	}
+	if err := c.CreatePermission(peers...); err != nil {
+		c.log.Warnf("Failed to refresh permissions: %s", err)
+	}
+}
+
+// CreatePermission installs or refreshes permissions for IP addresses of
+// peers. Client creates permissions automatically on RelayConn.WriteTo,
+// so calling it is only required to receive data from peers before
+// sending anything to them.
+//
+// RFC 5766 Section 9
+func (c *Client) CreatePermission(peers ...net.Addr) error {
+	if !c.allocated() {
+		return ErrNoAllocation
+	}
+	setters := make([]stun.Setter, 0, len(peers))
+	for _, peer := range peers {
+		ip, port, err := addrIPPort(peer)
+		if err != nil {
+			return err
+		}
+		setters = append(setters, stun.XORPeerAddress{IP: ip, Port: port})
+	}
+	if _, err := c.do(stun.MethodCreatePermission, setters...); err != nil {
+		return err
+	}
+	now := time.Now()
+	c.mux.Lock()
+	for _, peer := range peers {
+		ip, _, _ := addrIPPort(peer)
+		c.permissions[ip.String()] = now
+	}
+	c.mux.Unlock()
+	return nil
+}
+
+// allocated reports whether client has an allocation.
+func (c *Client) allocated() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.relay != nil
+}
+
+// hasPermission reports whether client has permission for peer IP.
+func (c *Client) hasPermission(ip net.IP) bool {
+	c.mux.Lock()
+	_, ok := c.permissions[ip.String()]
+	c.mux.Unlock()
+	return ok
+}
+
+// BindChannel binds channel to peer address, returning channel number.
+// If channel is already bound to peer, its number is returned. Channel
+// binding also installs permission for peer IP address. RelayConn sends
+// data to peer over bound channel, using ChannelData messages instead
+// of Send indications.
+//
+// Calls are serialized, so concurrent calls for the same peer result in
+// single binding, and channel number is only used up by successful
+// binding.
+//
+// RFC 5766 Section 11
+func (c *Client) BindChannel(peer net.Addr) (stun.ChannelNumber, error) {
+	if !c.allocated() {
+		return 0, ErrNoAllocation
+	}
+	ip, port, err := addrIPPort(peer)
+	if err != nil {
+		return 0, err
+	}
+	addr := &net.UDPAddr{IP: ip, Port: port}
+	c.binds.Lock()
+	defer c.binds.Unlock()
+	c.mux.Lock()
+	if b, ok := c.channels[addr.String()]; ok {
+		c.mux.Unlock()
+		return b.number, nil
+	}
+	if !c.nextChannel.Valid() {
+		c.mux.Unlock()
+		return 0, ErrNoChannelNumber
+	}
+	number := c.nextChannel
+	c.mux.Unlock()
+	if err = c.bindChannel(number, addr); err != nil {
+		return 0, err
+	}
+	return number, nil
+}
+
+// bindChannel sends ChannelBind request and saves the binding.
+func (c *Client) bindChannel(number stun.ChannelNumber, peer *net.UDPAddr) error {
+	if _, err := c.do(stun.MethodChannelBind, number, stun.XORPeerAddress{IP: peer.IP, Port: peer.Port}); err != nil {
+		return err
+	}
+	now := time.Now()
+	c.mux.Lock()
+	b := &channelBinding{
+		number:    number,
+		peer:      peer,
+		refreshed: now,
+	}
+	c.channels[peer.String()] = b
+	c.numbers[number] = b
+	c.permissions[peer.IP.String()] = now
+	if number >= c.nextChannel {
+		c.nextChannel = number + 1
+	}
+	c.mux.Unlock()
+	return nil
+}
+
+// channel returns channel number that is bound to peer, if any.
+func (c *Client) channel(peer *net.UDPAddr) (stun.ChannelNumber, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	b, ok := c.channels[peer.String()]
+	if !ok {
+		return 0, false
+	}
+	return b.number, true
+}
+
+// send sends data to peer via Send indication.
+//
+// RFC 5766 Section 10.1
+func (c *Client) send(data []byte, peer *net.UDPAddr) error {
+	m, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodSend, stun.ClassIndication),
+		stun.XORPeerAddress{IP: peer.IP, Port: peer.Port}, stun.Data(data),
+		stun.Fingerprint,
+	)
+	if err != nil {
+		return err
+	}
+	return c.stun.Indicate(m)
+}
+
+// sendChannelData sends data to peer over bound channel.
+//
+// RFC 5766 Section 11.5
+func (c *Client) sendChannelData(data []byte, number stun.ChannelNumber) error {
+	return c.stun.WriteChannelData(&stun.ChannelData{
+		Number: number,
+		Data:   data,
+	})
+}
+
+// handleChannelData passes data received over bound channel to relay.
+//
+// RFC 5766 Section 11.6
+func (c *Client) handleChannelData(cd *stun.ChannelData) {
+	c.mux.Lock()
+	r, b := c.relay, c.numbers[cd.Number]
+	c.mux.Unlock()
+	if r == nil || b == nil {
+		c.log.Debugf("Dropping ChannelData on unbound channel %s", cd.Number)
+		return
+	}
+	r.push(cd.Data, b.peer)
+}
+
+// handleEvent handles events that are not related to transactions,
+// passing Data indications to relay.
+//
+// RFC 5766 Section 10.4
+func (c *Client) handleEvent(e stun.Event) {
+	if e.Error != nil || e.Message == nil ||
+		e.Message.Type != stun.NewType(stun.MethodData, stun.ClassIndication) {
+		return
+	}
+	var (
+		peer stun.XORPeerAddress
+		data stun.Data
+	)
+	if err := e.Message.Parse(&peer, &data); err != nil {
+		c.log.Debugf("Failed to parse Data indication: %s", err)
+		return
+	}
+	c.mux.Lock()
+	r := c.relay
+	c.mux.Unlock()
+	if r == nil {
+		return
+	}
+	r.push(data, &net.UDPAddr{IP: peer.IP, Port: peer.Port})
+}
+
+// deallocate removes r along with permissions and channel bindings, if
+// it is current relay, and deletes allocation on server if refresh is
+// true.
+func (c *Client) deallocate(r *RelayConn, refresh bool) error {
+	c.mux.Lock()
+	if c.relay != r {
+		c.mux.Unlock()
+		return nil
+	}
+	c.relay = nil
+	c.permissions = make(map[string]time.Time)
+	c.channels = make(map[string]*channelBinding)
+	c.numbers = make(map[stun.ChannelNumber]*channelBinding)
+	c.nextChannel = stun.MinChannelNumber
+	c.mux.Unlock()
+	if !refresh {
+		return nil
+	}
+	_, err := c.refresh(&stun.Lifetime{})
+	return err
+}
+
+// Close releases allocation, if any, and closes the STUN client and
+// the underlying connection.
+func (c *Client) Close() error {
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		return ErrClientClosed
+	}
+	c.closed = true
+	r := c.relay
+	c.mux.Unlock()
+	var deallocateErr error
+	if r != nil {
+		deallocateErr = r.Close()
+	}
+	c.wg.Wait()
+	if err := c.stun.Close(); err != nil {
+		return err
+	}
+	return deallocateErr
+}
+
+// addrIPPort returns IP and port of UDP or TCP address.
+func addrIPPort(addr net.Addr) (net.IP, int, error) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP, a.Port, nil
+	case *net.TCPAddr:
+		return a.IP, a.Port, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: %T", ErrUnsupportedAddr, addr)
+	}
+}
@@ -0,0 +1,675 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v2"
+)
+
+// testRelay is minimal stand-in TURN server that supports single
+// allocation with long-term credentials.
+type testRelay struct {
+	t        *testing.T
+	conn     net.PacketConn // server socket
+	relay    net.PacketConn // relayed socket
+	lifetime time.Duration
+	key      stun.MessageIntegrity
+
+	mux         sync.Mutex
+	client      net.Addr
+	requests    map[stun.Method]int
+	permissions map[string]bool
+	channels    map[stun.ChannelNumber]string
+	channelData int // received ChannelData messages
+	deleted     bool
+	// refreshErr and channelBindErr are error codes to respond to
+	// Refresh and ChannelBind requests with, zero for success.
+	refreshErr     stun.ErrorCode
+	channelBindErr stun.ErrorCode
+}
+
+const (
+	testUsername = "user"
+	testRealm    = "realm"
+	testPassword = "pass"
+	testNonce    = "nonce"
+)
+
+func newTestRelay(t *testing.T, lifetime time.Duration) *testRelay {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &testRelay{
+		t:           t,
+		conn:        conn,
+		relay:       relay,
+		lifetime:    lifetime,
+		key:         stun.NewLongTermIntegrity(testUsername, testRealm, testPassword),
+		requests:    make(map[stun.Method]int),
+		permissions: make(map[string]bool),
+		channels:    make(map[stun.ChannelNumber]string),
+	}
+	go r.serve()
+	go r.serveRelay()
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = relay.Close()
+	})
+	return r
+}
+
+func (r *testRelay) count(method stun.Method) int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.requests[method]
+}
+
+func (r *testRelay) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if stun.IsChannelData(buf[:n]) {
+			if err = r.handleChannelData(buf[:n]); err != nil {
+				r.t.Error(err)
+			}
+			continue
+		}
+		req := new(stun.Message)
+		if err = stun.Decode(buf[:n], req); err != nil {
+			r.t.Error(err)
+			continue
+		}
+		res, err := r.handle(req, addr)
+		if err != nil {
+			r.t.Error(err)
+			continue
+		}
+		if res == nil {
+			continue
+		}
+		if _, err = r.conn.WriteTo(res.Raw, addr); err != nil {
+			return
+		}
+	}
+}
+
+func (r *testRelay) handle(req *stun.Message, addr net.Addr) (*stun.Message, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if req.Type.Class == stun.ClassIndication {
+		if req.Type.Method != stun.MethodSend {
+			return nil, nil
+		}
+		var (
+			peer stun.XORPeerAddress
+			data stun.Data
+		)
+		if err := req.Parse(&peer, &data); err != nil {
+			return nil, err
+		}
+		if !r.permissions[peer.IP.String()] {
+			return nil, nil
+		}
+		_, err := r.relay.WriteTo(data, &net.UDPAddr{IP: peer.IP, Port: peer.Port})
+		return nil, err
+	}
+	if err := stun.Fingerprint.Check(req); err != nil {
+		return nil, err
+	}
+	if req.Type.Method == stun.MethodAllocate && !req.Contains(stun.AttrMessageIntegrity) {
+		return stun.Build(req, stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+			stun.CodeUnauthorized, stun.NewRealm(testRealm), stun.NewNonce(testNonce),
+		)
+	}
+	if err := r.key.Check(req); err != nil {
+		return stun.Build(req, stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+			stun.CodeUnauthorized, stun.NewRealm(testRealm), stun.NewNonce(testNonce),
+		)
+	}
+	r.requests[req.Type.Method]++
+	success := []stun.Setter{req, stun.NewType(req.Type.Method, stun.ClassSuccessResponse)}
+	switch req.Type.Method {
+	case stun.MethodAllocate:
+		var transport stun.RequestedTransport
+		if err := transport.GetFrom(req); err != nil || transport.Protocol != stun.TransportUDP {
+			return stun.Build(req, stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+				stun.CodeBadRequest, r.key,
+			)
+		}
+		if r.client != nil {
+			return stun.Build(req, stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+				stun.CodeAllocMismatch, r.key,
+			)
+		}
+		r.client = addr
+		relayed := r.relay.LocalAddr().(*net.UDPAddr) //nolint:forcetypeassert
+		mapped := addr.(*net.UDPAddr)                 //nolint:forcetypeassert
+		success = append(success,
+			stun.XORRelayedAddress{IP: relayed.IP, Port: relayed.Port},
+			stun.XORMappedAddress{IP: mapped.IP, Port: mapped.Port},
+			stun.Lifetime{Duration: r.lifetime},
+		)
+	case stun.MethodRefresh:
+		if r.refreshErr != 0 {
+			return stun.Build(req, stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+				r.refreshErr, r.key,
+			)
+		}
+		var lifetime stun.Lifetime
+		if err := lifetime.GetFrom(req); err == nil && lifetime.Duration == 0 {
+			r.deleted = true
+			success = append(success, lifetime)
+		} else {
+			success = append(success, stun.Lifetime{Duration: r.lifetime})
+		}
+	case stun.MethodCreatePermission:
+		for _, a := range req.Attributes {
+			if a.Type != stun.AttrXORPeerAddress {
+				continue
+			}
+			var peer stun.XORPeerAddress
+			single := &stun.Message{TransactionID: req.TransactionID, Attributes: stun.Attributes{a}}
+			if err := peer.GetFrom(single); err != nil {
+				return nil, err
+			}
+			r.permissions[peer.IP.String()] = true
+		}
+	case stun.MethodChannelBind:
+		if r.channelBindErr != 0 {
+			return stun.Build(req, stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+				r.channelBindErr, r.key,
+			)
+		}
+		var (
+			number stun.ChannelNumber
+			peer   stun.XORPeerAddress
+		)
+		if err := req.Parse(&number, &peer); err != nil {
+			return nil, err
+		}
+		r.channels[number] = peer.String()
+		r.permissions[peer.IP.String()] = true
+	}
+	success = append(success, r.key, stun.Fingerprint)
+	return stun.Build(success...)
+}
+
+func (r *testRelay) handleChannelData(b []byte) error {
+	cd := &stun.ChannelData{Raw: b}
+	if err := cd.Decode(); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	peer, ok := r.channels[cd.Number]
+	r.channelData++
+	r.mux.Unlock()
+	if !ok {
+		return nil
+	}
+	addr, err := net.ResolveUDPAddr("udp4", peer)
+	if err != nil {
+		return err
+	}
+	_, err = r.relay.WriteTo(cd.Data, addr)
+	return err
+}
+
+// channel returns channel bound to peer address.
+func (r *testRelay) channel(peer net.Addr) (stun.ChannelNumber, bool) {
+	for number, addr := range r.channels {
+		if addr == peer.String() {
+			return number, true
+		}
+	}
+	return 0, false
+}
+
+// serveRelay sends data received on relayed socket to client as Data
+// indications or ChannelData messages if channel is bound.
+func (r *testRelay) serveRelay() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := r.relay.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		peer := addr.(*net.UDPAddr) //nolint:forcetypeassert
+		r.mux.Lock()
+		permitted, client := r.permissions[peer.IP.String()], r.client
+		number, bound := r.channel(peer)
+		r.mux.Unlock()
+		if !permitted || client == nil {
+			continue
+		}
+		if bound {
+			cd := &stun.ChannelData{Number: number, Data: buf[:n]}
+			cd.Encode()
+			if _, err = r.conn.WriteTo(cd.Raw, client); err != nil {
+				return
+			}
+			continue
+		}
+		m := stun.MustBuild(stun.TransactionID, stun.NewType(stun.MethodData, stun.ClassIndication),
+			stun.XORPeerAddress{IP: peer.IP, Port: peer.Port}, stun.Data(buf[:n]),
+		)
+		if _, err = r.conn.WriteTo(m.Raw, client); err != nil {
+			return
+		}
+	}
+}
+
+func newTestClient(t *testing.T, r *testRelay, lifetime time.Duration) *Client {
+	t.Helper()
+	conn, err := net.Dial("udp4", r.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(&ClientConfig{
+		Conn:     conn,
+		Username: testUsername,
+		Password: testPassword,
+		Software: "test",
+		Lifetime: lifetime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if closeErr := c.Close(); closeErr != nil && !errors.Is(closeErr, ErrClientClosed) {
+			t.Error(closeErr)
+		}
+	})
+	return c
+}
+
+func TestClient_Allocate(t *testing.T) {
+	r := newTestRelay(t, time.Minute)
+	c := newTestClient(t, r, 0)
+	relay, err := c.Allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relay.LocalAddr().String() != r.relay.LocalAddr().String() {
+		t.Errorf("unexpected relayed address %s", relay.LocalAddr())
+	}
+	if relay.MappedAddr() == nil {
+		t.Error("mapped address expected")
+	}
+	if _, err = c.Allocate(); !errors.Is(err, ErrAlreadyAllocated) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close() //nolint:errcheck
+
+	// Client to peer, permission should be created automatically.
+	if _, err = relay.WriteTo([]byte("hello"), peer.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if r.count(stun.MethodCreatePermission) != 1 {
+		t.Error("permission should be created")
+	}
+	buf := make([]byte, 2048)
+	if err = peer.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, from, err := peer.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hello" || from.String() != relay.LocalAddr().String() {
+		t.Errorf("unexpected %q from %s", buf[:n], from)
+	}
+
+	// Peer to client.
+	if _, err = peer.WriteTo([]byte("world"), relay.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if err = relay.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, from, err = relay.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "world" || from.String() != peer.LocalAddr().String() {
+		t.Errorf("unexpected %q from %s", buf[:n], from)
+	}
+
+	// Permission is already installed, sending MTU-sized data.
+	large := make([]byte, 1400)
+	if _, err = relay.WriteTo(large, peer.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if n, _, err = peer.ReadFrom(buf[:cap(buf)]); err != nil || n != len(large) {
+		t.Errorf("unexpected %d, %v", n, err)
+	}
+	if _, err = peer.WriteTo(large, relay.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if n, _, err = relay.ReadFrom(buf); err != nil || n != len(large) {
+		t.Errorf("unexpected %d, %v", n, err)
+	}
+	if r.count(stun.MethodCreatePermission) != 1 {
+		t.Error("permission should be reused")
+	}
+
+	// Read deadline.
+	if err = relay.SetReadDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var netErr net.Error
+	if _, _, err = relay.ReadFrom(buf); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Deallocation.
+	if err = relay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r.mux.Lock()
+	deleted := r.deleted
+	r.mux.Unlock()
+	if !deleted {
+		t.Error("allocation should be deleted")
+	}
+	if _, _, err = relay.ReadFrom(buf); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = c.BindChannel(peer.LocalAddr()); !errors.Is(err, ErrNoAllocation) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestClient_Refresh(t *testing.T) {
+	r := newTestRelay(t, time.Second)
+	c := newTestClient(t, r, time.Second)
+	if _, err := c.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for r.count(stun.MethodRefresh) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("allocation is not refreshed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Allocate(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestClient_Refresh_ZeroLifetime(t *testing.T) {
+	r := newTestRelay(t, 0)
+	c := newTestClient(t, r, 0)
+	if _, err := c.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(minRefreshInterval + minRefreshInterval/2)
+	if n := r.count(stun.MethodRefresh); n > 2 {
+		t.Errorf("too many refreshes: %d", n)
+	}
+}
+
+func TestClient_Refresh_AllocationLost(t *testing.T) {
+	r := newTestRelay(t, time.Second)
+	c := newTestClient(t, r, time.Second)
+	relay, err := c.Allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.mux.Lock()
+	r.refreshErr = stun.CodeAllocMismatch
+	r.mux.Unlock()
+	stopped := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh loop is not stopped")
+	}
+	if n := r.count(stun.MethodRefresh); n != 1 {
+		t.Errorf("refresh should not be retried, got %d", n)
+	}
+	if _, _, err = relay.ReadFrom(make([]byte, 10)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("unexpected read error %v", err)
+	}
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	if _, err = relay.WriteTo([]byte{1}, peer); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("unexpected write error %v", err)
+	}
+	if _, err = c.BindChannel(peer); !errors.Is(err, ErrNoAllocation) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.count(stun.MethodRefresh); n != 1 {
+		t.Errorf("lost allocation should not be deleted, got %d refreshes", n)
+	}
+}
+
+func TestClient_Close_Concurrent(t *testing.T) {
+	r := newTestRelay(t, time.Minute)
+	c := newTestClient(t, r, 0)
+	if _, err := c.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- c.Close()
+		}()
+	}
+	var closed int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; errors.Is(err, ErrClientClosed) {
+			closed++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if closed != 1 {
+		t.Errorf("exactly one Close should fail, got %d", closed)
+	}
+	if n := r.count(stun.MethodRefresh); n != 1 {
+		t.Errorf("allocation should be deleted once, got %d refreshes", n)
+	}
+	if _, err := c.Allocate(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestClient_BindChannel(t *testing.T) {
+	r := newTestRelay(t, time.Minute)
+	c := newTestClient(t, r, 0)
+	if _, err := c.BindChannel(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}); !errors.Is(err, ErrNoAllocation) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := c.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	number, err := c.BindChannel(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != stun.MinChannelNumber {
+		t.Errorf("unexpected channel number %s", number)
+	}
+	if again, _ := c.BindChannel(peer); again != number {
+		t.Errorf("channel should be reused, got %s", again)
+	}
+	other, err := c.BindChannel(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other != number+1 {
+		t.Errorf("unexpected channel number %s", other)
+	}
+	r.mux.Lock()
+	bound, permitted := r.channels[number], r.permissions["127.0.0.1"]
+	r.mux.Unlock()
+	if bound != peer.String() || !permitted {
+		t.Errorf("unexpected binding %q", bound)
+	}
+	if !c.hasPermission(peer.IP) {
+		t.Error("channel binding should install permission")
+	}
+	if _, err = c.BindChannel(&net.IPAddr{}); !errors.Is(err, ErrUnsupportedAddr) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestClient_ChannelData(t *testing.T) {
+	r := newTestRelay(t, time.Minute)
+	c := newTestClient(t, r, 0)
+	relay, err := c.Allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close() //nolint:errcheck
+	if _, err = c.BindChannel(peer.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = relay.WriteTo([]byte("hello"), peer.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2048)
+	if err = peer.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := peer.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("unexpected %q, %v", buf[:n], err)
+	}
+	r.mux.Lock()
+	channelData := r.channelData
+	r.mux.Unlock()
+	if channelData != 1 {
+		t.Errorf("data should be sent over channel, got %d", channelData)
+	}
+	if _, err = peer.WriteTo([]byte("world"), relay.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if err = relay.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, from, err := relay.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "world" || from.String() != peer.LocalAddr().String() {
+		t.Errorf("unexpected %q from %s", buf[:n], from)
+	}
+}
+
+func TestClient_ResponseErr(t *testing.T) {
+	r := newTestRelay(t, time.Minute)
+	first := newTestClient(t, r, 0)
+	if _, err := first.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+	// Stand-in relay supports only one allocation.
+	second := newTestClient(t, r, 0)
+	_, err := second.Allocate()
+	var resErr ResponseErr
+	if !errors.As(err, &resErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if resErr.Code.Code != stun.CodeAllocMismatch || resErr.Method != stun.MethodAllocate {
+		t.Errorf("unexpected error %s", resErr)
+	}
+}
+
+func TestClient_BindChannel_Failed(t *testing.T) {
+	r := newTestRelay(t, time.Minute)
+	c := newTestClient(t, r, 0)
+	if _, err := c.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+	r.mux.Lock()
+	r.channelBindErr = stun.CodeForbidden
+	r.mux.Unlock()
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	var resErr ResponseErr
+	if _, err := c.BindChannel(peer); !errors.As(err, &resErr) || resErr.Code.Code != stun.CodeForbidden {
+		t.Fatalf("unexpected error %v", err)
+	}
+	r.mux.Lock()
+	r.channelBindErr = 0
+	r.mux.Unlock()
+	// Failed binding should not use up channel number.
+	number, err := c.BindChannel(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != stun.MinChannelNumber {
+		t.Errorf("unexpected channel number %s", number)
+	}
+}
+
+func TestClient_BindChannel_Concurrent(t *testing.T) {
+	r := newTestRelay(t, time.Minute)
+	c := newTestClient(t, r, 0)
+	if _, err := c.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	var (
+		wg      sync.WaitGroup
+		numbers [4]stun.ChannelNumber
+	)
+	for i := range numbers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			number, err := c.BindChannel(peer)
+			if err != nil {
+				t.Error(err)
+			}
+			numbers[i] = number
+		}(i)
+	}
+	wg.Wait()
+	for _, number := range numbers {
+		if number != stun.MinChannelNumber {
+			t.Errorf("unexpected channel number %s", number)
+		}
+	}
+	if n := r.count(stun.MethodChannelBind); n != 1 {
+		t.Errorf("unexpected ChannelBind count %d", n)
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/transport/v3/deadline"
+)
+
+// relayQueueSize is the number of received packets that are buffered
+// until ReadFrom call. Packets are dropped when queue is full.
+const relayQueueSize = 64
+
+// packet is data received from peer.
+type packet struct {
+	data []byte
+	from *net.UDPAddr
+}
+
+// RelayConn is net.PacketConn that sends and receives data through the
+// relayed transport address of allocation.
+type RelayConn struct {
+	client       *Client
+	relayed      *net.UDPAddr
+	mapped       *net.UDPAddr
+	packets      chan packet
+	closed       chan struct{}
+	closeOnce    sync.Once
+	readDeadline *deadline.Deadline
+}
+
+var _ net.PacketConn = (*RelayConn)(nil)
+
+func newRelayConn(c *Client, relayed *net.UDPAddr) *RelayConn {
+	return &RelayConn{
+		client:       c,
+		relayed:      relayed,
+		packets:      make(chan packet, relayQueueSize),
+		closed:       make(chan struct{}),
+		readDeadline: deadline.New(),
+	}
+}
+
+// push queues data from peer, dropping it if queue is full.
+func (r *RelayConn) push(data []byte, from *net.UDPAddr) {
+	p := packet{
+		data: append([]byte{}, data...),
+		from: from,
+	}
+	select {
+	case <-r.closed:
+	case r.packets <- p:
+	default:
+		r.client.log.Debugf("Dropping packet from %s: queue is full", from)
+	}
+}
+
+// ReadFrom reads data that was received from peer.
+func (r *RelayConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case <-r.closed:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Addr: r.relayed, Err: net.ErrClosed}
+	default:
+	}
+	select {
+	case p := <-r.packets:
+		return copy(b, p.data), p.from, nil
+	case <-r.readDeadline.Done():
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Addr: r.relayed, Err: os.ErrDeadlineExceeded}
+	case <-r.closed:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Addr: r.relayed, Err: net.ErrClosed}
+	}
+}
+
+// WriteTo sends data to peer, creating permission for its IP address if
+// required. Data is sent over the channel if one is bound to addr.
+func (r *RelayConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-r.closed:
+		return 0, &net.OpError{Op: "write", Net: "udp", Addr: r.relayed, Err: net.ErrClosed}
+	default:
+	}
+	ip, port, err := addrIPPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	peer := &net.UDPAddr{IP: ip, Port: port}
+	if !r.client.hasPermission(ip) {
+		if err = r.client.CreatePermission(peer); err != nil {
+			return 0, err
+		}
+	}
+	if number, ok := r.client.channel(peer); ok {
+		err = r.client.sendChannelData(b, number)
+	} else {
+		err = r.client.send(b, peer)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close releases the allocation.
+func (r *RelayConn) Close() error {
+	return r.close(true)
+}
+
+// close stops r and removes it from client, deleting the allocation on
+// server if refresh is true.
+func (r *RelayConn) close(refresh bool) error {
+	err := net.ErrClosed
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		err = r.client.deallocate(r, refresh)
+	})
+	return err
+}
+
+// LocalAddr returns the relayed transport address.
+func (r *RelayConn) LocalAddr() net.Addr {
+	return r.relayed
+}
+
+// MappedAddr returns the server reflexive address from Allocate
+// response, or nil if server did not provide it.
+func (r *RelayConn) MappedAddr() net.Addr {
+	if r.mapped == nil {
+		return nil
+	}
+	return r.mapped
+}
+
+// SetDeadline sets read deadline, write deadline is not supported.
+func (r *RelayConn) SetDeadline(t time.Time) error {
+	return r.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets read deadline.
+func (r *RelayConn) SetReadDeadline(t time.Time) error {
+	r.readDeadline.Set(t)
+	return nil
+}
+
+// SetWriteDeadline is no-op, writes do not block except for permission
+// creation, which is limited by STUN transaction timeout.
+func (*RelayConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,394 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+const lifetimeSize = 4 // uint32 seconds
+
+// Lifetime represents LIFETIME attribute, the duration for which the
+// server will maintain an allocation in the absence of a refresh.
+//
+// RFC 5766 Section 14.2
+type Lifetime struct {
+	time.Duration
+}
+
+func (l Lifetime) String() string {
+	return l.Duration.String()
+}
+
+// ErrLifetimeOutOfRange means that Lifetime duration is negative or does
+// not fit into LIFETIME attribute.
+var ErrLifetimeOutOfRange = errors.New("lifetime is out of range")
+
+// AddTo adds LIFETIME to message, rounding duration down to seconds.
+func (l Lifetime) AddTo(m *Message) error {
+	if l.Duration < 0 || l.Duration/time.Second > math.MaxUint32 {
+		return ErrLifetimeOutOfRange
+	}
+	var v [lifetimeSize]byte
+	bin.PutUint32(v[:], uint32(l.Duration/time.Second))
+	m.Add(AttrLifetime, v[:])
+	return nil
+}
+
+// GetFrom decodes LIFETIME from message.
+func (l *Lifetime) GetFrom(m *Message) error {
+	v, err := m.Get(AttrLifetime)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(AttrLifetime, len(v), lifetimeSize); err != nil {
+		return err
+	}
+	l.Duration = time.Duration(bin.Uint32(v)) * time.Second
+	return nil
+}
+
+// Valid channel numbers.
+//
+// RFC 5766 Section 11
+const (
+	MinChannelNumber ChannelNumber = 0x4000
+	MaxChannelNumber ChannelNumber = 0x7FFF
+)
+
+const channelNumberSize = 4 // 16 bit number + 16 bit RFFU
+
+// ChannelNumber represents CHANNEL-NUMBER attribute.
+//
+// RFC 5766 Section 14.1
+type ChannelNumber uint16
+
+func (n ChannelNumber) String() string {
+	return fmt.Sprintf("0x%x", uint16(n))
+}
+
+// Valid returns true if channel number is in range that is allowed for
+// channel bindings.
+func (n ChannelNumber) Valid() bool {
+	return n >= MinChannelNumber && n <= MaxChannelNumber
+}
+
+// AddTo adds CHANNEL-NUMBER to message.
+func (n ChannelNumber) AddTo(m *Message) error {
+	var v [channelNumberSize]byte
+	bin.PutUint16(v[:2], uint16(n))
+	// v[2:4] are zeroes (RFFU = 0)
+	m.Add(AttrChannelNumber, v[:])
+	return nil
+}
+
+// GetFrom decodes CHANNEL-NUMBER from message.
+func (n *ChannelNumber) GetFrom(m *Message) error {
+	v, err := m.Get(AttrChannelNumber)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(AttrChannelNumber, len(v), channelNumberSize); err != nil {
+		return err
+	}
+	*n = ChannelNumber(bin.Uint16(v[:2]))
+	return nil
+}
+
+// getXORAddressAs decodes XOR address attribute of type t to a,
+// checking that attribute size matches the address family.
+func getXORAddressAs(a *XORMappedAddress, m *Message, t AttrType) error {
+	v, err := m.Get(t)
+	if err != nil {
+		return err
+	}
+	size := 4 + net.IPv4len
+	if len(v) >= 2 && bin.Uint16(v[0:2]) == familyIPv6 {
+		size = 4 + net.IPv6len
+	}
+	if err = CheckSize(t, len(v), size); err != nil {
+		return err
+	}
+	return a.GetFromAs(m, t)
+}
+
+// XORPeerAddress represents XOR-PEER-ADDRESS attribute, the address of the
+// peer as seen from the TURN server.
+//
+// RFC 5766 Section 14.3
+type XORPeerAddress struct {
+	IP   net.IP
+	Port int
+}
+
+func (a XORPeerAddress) String() string {
+	return XORMappedAddress(a).String()
+}
+
+// AddTo adds XOR-PEER-ADDRESS to message.
+func (a XORPeerAddress) AddTo(m *Message) error {
+	return XORMappedAddress(a).AddToAs(m, AttrXORPeerAddress)
+}
+
+// GetFrom decodes XOR-PEER-ADDRESS from message.
+func (a *XORPeerAddress) GetFrom(m *Message) error {
+	return getXORAddressAs((*XORMappedAddress)(a), m, AttrXORPeerAddress)
+}
+
+// XORRelayedAddress represents XOR-RELAYED-ADDRESS attribute, the address
+// and port that the server allocated for the client.
+//
+// RFC 5766 Section 14.5
+type XORRelayedAddress struct {
+	IP   net.IP
+	Port int
+}
+
+func (a XORRelayedAddress) String() string {
+	return XORMappedAddress(a).String()
+}
+
+// AddTo adds XOR-RELAYED-ADDRESS to message.
+func (a XORRelayedAddress) AddTo(m *Message) error {
+	return XORMappedAddress(a).AddToAs(m, AttrXORRelayedAddress)
+}
+
+// GetFrom decodes XOR-RELAYED-ADDRESS from message.
+func (a *XORRelayedAddress) GetFrom(m *Message) error {
+	return getXORAddressAs((*XORMappedAddress)(a), m, AttrXORRelayedAddress)
+}
+
+// Data represents DATA attribute, the application data that is relayed
+// in Send and Data indications.
+//
+// RFC 5766 Section 14.4
+type Data []byte
+
+func (d Data) String() string {
+	return fmt.Sprintf("%d bytes", len(d))
+}
+
+// AddTo adds DATA to message.
+func (d Data) AddTo(m *Message) error {
+	m.Add(AttrData, d)
+	return nil
+}
+
+// GetFrom decodes DATA from message. The value is not copied and is
+// valid until m.Raw is changed.
+func (d *Data) GetFrom(m *Message) error {
+	v, err := m.Get(AttrData)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// TransportProtocol is IANA assigned protocol number that is used in
+// REQUESTED-TRANSPORT attribute.
+type TransportProtocol byte
+
+// Transport protocols that are used in REQUESTED-TRANSPORT.
+const (
+	TransportTCP TransportProtocol = 6  // RFC 6062
+	TransportUDP TransportProtocol = 17 // RFC 5766
+)
+
+func (p TransportProtocol) String() string {
+	switch p {
+	case TransportTCP:
+		return "TCP"
+	case TransportUDP:
+		return "UDP"
+	default:
+		return fmt.Sprintf("%d", byte(p))
+	}
+}
+
+const requestedTransportSize = 4 // 8 bit protocol + 24 bit RFFU
+
+// RequestedTransport represents REQUESTED-TRANSPORT attribute.
+//
+// RFC 5766 Section 14.7
+type RequestedTransport struct {
+	Protocol TransportProtocol
+}
+
+func (t RequestedTransport) String() string {
+	return "protocol: " + t.Protocol.String()
+}
+
+// AddTo adds REQUESTED-TRANSPORT to message.
+func (t RequestedTransport) AddTo(m *Message) error {
+	var v [requestedTransportSize]byte
+	v[0] = byte(t.Protocol)
+	// v[1:4] are zeroes (RFFU = 0)
+	m.Add(AttrRequestedTransport, v[:])
+	return nil
+}
+
+// GetFrom decodes REQUESTED-TRANSPORT from message.
+func (t *RequestedTransport) GetFrom(m *Message) error {
+	v, err := m.Get(AttrRequestedTransport)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(AttrRequestedTransport, len(v), requestedTransportSize); err != nil {
+		return err
+	}
+	t.Protocol = TransportProtocol(v[0])
+	return nil
+}
+
+const (
+	evenPortSize    = 1
+	evenPortReserve = 0x80 // "R" flag
+)
+
+// EvenPort represents EVEN-PORT attribute, the request for an even
+// relayed port. If ReservePort is set, the next port is reserved too.
+//
+// RFC 5766 Section 14.6
+type EvenPort struct {
+	ReservePort bool
+}
+
+func (p EvenPort) String() string {
+	return fmt.Sprintf("reserve: %t", p.ReservePort)
+}
+
+// AddTo adds EVEN-PORT to message.
+func (p EvenPort) AddTo(m *Message) error {
+	var v [evenPortSize]byte
+	if p.ReservePort {
+		v[0] = evenPortReserve
+	}
+	m.Add(AttrEvenPort, v[:])
+	return nil
+}
+
+// GetFrom decodes EVEN-PORT from message.
+func (p *EvenPort) GetFrom(m *Message) error {
+	v, err := m.Get(AttrEvenPort)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(AttrEvenPort, len(v), evenPortSize); err != nil {
+		return err
+	}
+	p.ReservePort = v[0]&evenPortReserve != 0
+	return nil
+}
+
+const reservationTokenSize = 8
+
+// ReservationToken represents RESERVATION-TOKEN attribute, the token that
+// uniquely identifies a relayed transport address held in reserve.
+//
+// RFC 5766 Section 14.9
+type ReservationToken []byte
+
+func (t ReservationToken) String() string {
+	return fmt.Sprintf("0x%x", []byte(t))
+}
+
+// AddTo adds RESERVATION-TOKEN to message.
+func (t ReservationToken) AddTo(m *Message) error {
+	if err := CheckSize(AttrReservationToken, len(t), reservationTokenSize); err != nil {
+		return err
+	}
+	m.Add(AttrReservationToken, t)
+	return nil
+}
+
+// GetFrom decodes RESERVATION-TOKEN from message.
+func (t *ReservationToken) GetFrom(m *Message) error {
+	v, err := m.Get(AttrReservationToken)
+	if err != nil {
+		return err
+	}
+	if err = CheckSize(AttrReservationToken, len(v), reservationTokenSize); err != nil {
+		return err
+	}
+	*t = append((*t)[:0], v...)
+	return nil
+}
+
+// DontFragmentAttr represents DONT-FRAGMENT attribute.
+//
+// RFC 5766 Section 14.8
+type DontFragmentAttr struct{}
+
+// DontFragment is shorthand for DontFragmentAttr.
+var DontFragment DontFragmentAttr //nolint:gochecknoglobals
+
+func (DontFragmentAttr) String() string {
+	return "DONT-FRAGMENT"
+}
+
+// AddTo adds DONT-FRAGMENT to message.
+func (DontFragmentAttr) AddTo(m *Message) error {
+	m.Add(AttrDontFragment, nil)
+	return nil
+}
+
+// GetFrom returns nil if message contains valid DONT-FRAGMENT
+// attribute.
+func (DontFragmentAttr) GetFrom(m *Message) error {
+	v, err := m.Get(AttrDontFragment)
+	if err != nil {
+		return err
+	}
+	return CheckSize(AttrDontFragment, len(v), 0)
+}
+
+// IsSet returns true if DONT-FRAGMENT attribute is set.
+func (DontFragmentAttr) IsSet(m *Message) bool {
+	return m.Contains(AttrDontFragment)
+}
+
+// turnAttrString returns readable value of TURN attribute a that is
+// contained in m, or empty string if a is not a TURN attribute, has no
+// value or is malformed.
+func turnAttrString(m *Message, a RawAttribute) string {
+	var g interface {
+		Getter
+		fmt.Stringer
+	}
+	switch a.Type {
+	case AttrLifetime:
+		g = new(Lifetime)
+	case AttrChannelNumber:
+		g = new(ChannelNumber)
+	case AttrXORPeerAddress:
+		g = new(XORPeerAddress)
+	case AttrXORRelayedAddress:
+		g = new(XORRelayedAddress)
+	case AttrData:
+		g = new(Data)
+	case AttrRequestedTransport:
+		g = new(RequestedTransport)
+	case AttrEvenPort:
+		g = new(EvenPort)
+	case AttrReservationToken:
+		g = new(ReservationToken)
+	default:
+		return ""
+	}
+	// Decoding exactly a, because m can contain multiple attributes
+	// of same type, e.g. XOR-PEER-ADDRESS in CreatePermission request.
+	single := &Message{
+		TransactionID: m.TransactionID,
+		Attributes:    Attributes{a},
+	}
+	if err := g.GetFrom(single); err != nil {
+		return ""
+	}
+	return g.String()
+}
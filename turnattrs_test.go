@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package stun
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifetime(t *testing.T) {
+	m := MustBuild(Lifetime{Duration: time.Minute + time.Millisecond})
+	v, err := m.Get(AttrLifetime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte{0, 0, 0, 60}) {
+		t.Errorf("unexpected value 0x%x", v)
+	}
+	var l Lifetime
+	if err = l.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if l.Duration != time.Minute || l.String() != "1m0s" {
+		t.Errorf("unexpected lifetime %s", l)
+	}
+	m = New()
+	m.Add(AttrLifetime, []byte{1, 2})
+	if err = l.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestLifetime_AddTo(t *testing.T) {
+	t.Run("Max", func(t *testing.T) {
+		m := New()
+		if err := (Lifetime{Duration: math.MaxUint32 * time.Second}).AddTo(m); err != nil {
+			t.Fatal(err)
+		}
+		var l Lifetime
+		if err := l.GetFrom(m); err != nil {
+			t.Fatal(err)
+		}
+		if l.Duration != math.MaxUint32*time.Second {
+			t.Errorf("unexpected lifetime %s", l)
+		}
+	})
+	t.Run("Negative", func(t *testing.T) {
+		m := New()
+		if err := (Lifetime{Duration: -time.Second}).AddTo(m); !errors.Is(err, ErrLifetimeOutOfRange) {
+			t.Errorf("unexpected error %v", err)
+		}
+		if m.Contains(AttrLifetime) {
+			t.Error("LIFETIME should not be added")
+		}
+	})
+	t.Run("Overflow", func(t *testing.T) {
+		m := New()
+		if err := (Lifetime{Duration: (math.MaxUint32 + 1) * time.Second}).AddTo(m); !errors.Is(err, ErrLifetimeOutOfRange) {
+			t.Errorf("unexpected error %v", err)
+		}
+		if m.Contains(AttrLifetime) {
+			t.Error("LIFETIME should not be added")
+		}
+	})
+}
+
+func TestChannelNumber(t *testing.T) {
+	m := MustBuild(ChannelNumber(0x4001))
+	v, err := m.Get(AttrChannelNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte{0x40, 0x01, 0, 0}) {
+		t.Errorf("unexpected value 0x%x", v)
+	}
+	var n ChannelNumber
+	if err = n.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0x4001 || n.String() != "0x4001" {
+		t.Errorf("unexpected number %s", n)
+	}
+	for _, tc := range []struct {
+		n     ChannelNumber
+		valid bool
+	}{
+		{0x3FFF, false},
+		{MinChannelNumber, true},
+		{MaxChannelNumber, true},
+		{0x8000, false},
+	} {
+		if tc.n.Valid() != tc.valid {
+			t.Errorf("%s valid should be %t", tc.n, tc.valid)
+		}
+	}
+	m = New()
+	m.Add(AttrChannelNumber, []byte{0x40, 0x01})
+	if err = n.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestXORPeerAddress(t *testing.T) {
+	for _, ip := range []net.IP{
+		net.IPv4(122, 12, 34, 5),
+		net.ParseIP("2001:db8::1"),
+	} {
+		m := MustBuild(TransactionID, XORPeerAddress{IP: ip, Port: 3478})
+		var a XORPeerAddress
+		if err := a.GetFrom(m); err != nil {
+			t.Fatal(err)
+		}
+		if !a.IP.Equal(ip) || a.Port != 3478 {
+			t.Errorf("unexpected address %s", a)
+		}
+	}
+	m := MustBuild(TransactionID, XORRelayedAddress{IP: net.IPv4(1, 2, 3, 4), Port: 50000})
+	var relayed XORRelayedAddress
+	if err := relayed.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if relayed.String() != "1.2.3.4:50000" {
+		t.Errorf("unexpected address %s", relayed)
+	}
+	t.Run("Size", func(t *testing.T) {
+		var a XORPeerAddress
+		for _, v := range [][]byte{
+			{0, 1, 0, 1, 1, 2, 3, 4, 5},
+			{0, 2, 0, 1, 1, 2, 3, 4},
+		} {
+			m := New()
+			m.Add(AttrXORPeerAddress, v)
+			if err := a.GetFrom(m); !IsAttrSizeInvalid(err) {
+				t.Errorf("0x%x: unexpected error %v", v, err)
+			}
+		}
+	})
+}
+
+func TestData(t *testing.T) {
+	m := MustBuild(Data{1, 2, 3})
+	var d Data
+	if err := d.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d, []byte{1, 2, 3}) || d.String() != "3 bytes" {
+		t.Errorf("unexpected data %s", d)
+	}
+	if err := d.GetFrom(New()); !errors.Is(err, ErrAttributeNotFound) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRequestedTransport(t *testing.T) {
+	m := MustBuild(RequestedTransport{Protocol: TransportUDP})
+	v, err := m.Get(AttrRequestedTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte{17, 0, 0, 0}) {
+		t.Errorf("unexpected value 0x%x", v)
+	}
+	var r RequestedTransport
+	if err = r.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if r.Protocol != TransportUDP || r.String() != "protocol: UDP" {
+		t.Errorf("unexpected %s", r)
+	}
+	if TransportTCP.String() != "TCP" || TransportProtocol(1).String() != "1" {
+		t.Error("bad string")
+	}
+	m = New()
+	m.Add(AttrRequestedTransport, []byte{17})
+	if err = r.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestEvenPort(t *testing.T) {
+	for _, reserve := range []bool{true, false} {
+		m := MustBuild(EvenPort{ReservePort: reserve})
+		var p EvenPort
+		if err := p.GetFrom(m); err != nil {
+			t.Fatal(err)
+		}
+		if p.ReservePort != reserve {
+			t.Errorf("unexpected %s", p)
+		}
+	}
+	m := New()
+	m.Add(AttrEvenPort, []byte{0x80, 0})
+	var p EvenPort
+	if err := p.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestReservationToken(t *testing.T) {
+	token := ReservationToken{1, 2, 3, 4, 5, 6, 7, 8}
+	m := MustBuild(token)
+	var got ReservationToken
+	if err := got.GetFrom(m); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, token) || got.String() != "0x0102030405060708" {
+		t.Errorf("unexpected token %s", got)
+	}
+	if err := ReservationToken([]byte{1}).AddTo(New()); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+	m = New()
+	m.Add(AttrReservationToken, []byte{1, 2, 3})
+	if err := got.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDontFragment(t *testing.T) {
+	m := New()
+	if DontFragment.IsSet(m) {
+		t.Error("should not be set")
+	}
+	if err := m.Build(DontFragment); err != nil {
+		t.Fatal(err)
+	}
+	if !DontFragment.IsSet(m) {
+		t.Error("should be set")
+	}
+	if err := DontFragment.GetFrom(m); err != nil {
+		t.Error(err)
+	}
+	m = New()
+	m.Add(AttrDontFragment, []byte{1})
+	if err := DontFragment.GetFrom(m); !IsAttrSizeInvalid(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestMessage_StringTURN(t *testing.T) {
+	m := MustBuild(TransactionID, NewType(MethodCreatePermission, ClassRequest),
+		XORPeerAddress{IP: net.IPv4(1, 2, 3, 4), Port: 1},
+		XORPeerAddress{IP: net.IPv4(5, 6, 7, 8), Port: 2},
+		Lifetime{Duration: time.Minute},
+		DontFragment,
+		NewSoftware("software"),
+	)
+	s := m.String()
+	for _, substr := range []string{
+		"attr0=XOR-PEER-ADDRESS(1.2.3.4:1)",
+		"attr1=XOR-PEER-ADDRESS(5.6.7.8:2)",
+		"attr2=LIFETIME(1m0s)",
+		"attr3=DONT-FRAGMENT ",
+		"attr4=SOFTWARE ",
+	} {
+		if !strings.Contains(s, substr) {
+			t.Errorf("%q should contain %q", s, substr)
+		}
+	}
+}
@@ -3,7 +3,10 @@
 
 package stun
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // UnknownAttributes represents UNKNOWN-ATTRIBUTES attribute.
 //
@@ -64,3 +67,79 @@ func (a *UnknownAttributes) GetFrom(m *Message) error {
 	}
 	return nil
 }
+
+// UnknownRequired returns comprehension-required attributes of m that are
+// not in the known set, without duplicates, or nil if there are none.
+//
+// Such message should not be processed: requests should be answered with
+// 420 (Unknown Attribute) error response, see NewUnknownAttributesResponse,
+// and indications or responses should be discarded.
+//
+// RFC 8489 Section 6.3
+func (m *Message) UnknownRequired(known AttrSet) UnknownAttributes {
+	var unknown UnknownAttributes
+	for _, a := range m.Attributes {
+		if !a.Type.Required() || known.Contains(a.Type) || unknown.contains(a.Type) {
+			continue
+		}
+		unknown = append(unknown, a.Type)
+	}
+	return unknown
+}
+
+func (a UnknownAttributes) contains(t AttrType) bool {
+	for _, v := range a {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// NewUnknownAttributesResponse builds 420 (Unknown Attribute) error
+// response to request req, listing unknown attributes in
+// UNKNOWN-ATTRIBUTES and applying setters after it. Use them to add
+// MESSAGE-INTEGRITY and FINGERPRINT.
+//
+// RFC 8489 Section 6.3.1.1
+func NewUnknownAttributesResponse(req *Message, unknown UnknownAttributes, setters ...Setter) (*Message, error) {
+	res := New()
+	if err := res.Build(req, NewType(req.Type.Method, ClassErrorResponse), CodeUnknownAttribute, unknown); err != nil {
+		return nil, err
+	}
+	for _, s := range setters {
+		if err := s.AddTo(res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// UnknownAttributeError is returned by Client as event error when server
+// responds with 420 (Unknown Attribute), i.e. does not understand some
+// comprehension-required attributes of request. Such transactions are
+// not retried.
+type UnknownAttributeError struct {
+	// Attributes are listed in UNKNOWN-ATTRIBUTES of response.
+	Attributes UnknownAttributes
+}
+
+func (e UnknownAttributeError) Error() string {
+	return fmt.Sprintf("unknown attributes: %s", e.Attributes)
+}
+
+// unknownAttributeError returns UnknownAttributeError if m is 420 (Unknown
+// Attribute) error response, or nil otherwise.
+func unknownAttributeError(m *Message) error {
+	if m.Type.Class != ClassErrorResponse {
+		return nil
+	}
+	var code ErrorCodeAttribute
+	if err := code.GetFrom(m); err != nil || code.Code != CodeUnknownAttribute {
+		return nil
+	}
+	var e UnknownAttributeError
+	// Attribute is mandatory, but tolerating its absence.
+	_ = e.Attributes.GetFrom(m)
+	return e
+}
@@ -4,6 +4,7 @@
 package stun
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -43,6 +44,67 @@ func TestUnknownAttributes(t *testing.T) {
 	})
 }
 
+func TestMessage_UnknownRequired(t *testing.T) {
+	m := MustBuild(TransactionID, BindingRequest,
+		NewUsername("user"),
+		RawAttribute{Type: 0x7001, Value: []byte{1}},
+		ChangeRequest{ChangePort: true},
+		RawAttribute{Type: 0x7001, Value: []byte{2}},
+		RawAttribute{Type: 0x8fff, Value: []byte{3}},
+		Fingerprint,
+	)
+	unknown := m.UnknownRequired(KnownAttrs())
+	if len(unknown) != 1 || unknown[0] != 0x7001 {
+		t.Errorf("unexpected unknown attributes: %s", unknown)
+	}
+	unknown = m.UnknownRequired(NewAttrSet(AttrUsername))
+	if len(unknown) != 2 || unknown[0] != 0x7001 || unknown[1] != AttrChangeRequest {
+		t.Errorf("unexpected unknown attributes: %s", unknown)
+	}
+	if unknown = MustBuild(m, BindingRequest).UnknownRequired(nil); unknown != nil {
+		t.Errorf("unexpected unknown attributes: %s", unknown)
+	}
+}
+
+func TestNewUnknownAttributesResponse(t *testing.T) {
+	req := MustBuild(TransactionID, BindingRequest, RawAttribute{Type: 0x7001})
+	res, err := NewUnknownAttributesResponse(req, UnknownAttributes{0x7001}, Fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != BindingError || res.TransactionID != req.TransactionID {
+		t.Errorf("unexpected response %s", res)
+	}
+	if err = Fingerprint.Check(res); err != nil {
+		t.Error(err)
+	}
+	err = unknownAttributeError(res)
+	var unknownErr UnknownAttributeError
+	if !errors.As(err, &unknownErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(unknownErr.Attributes) != 1 || unknownErr.Attributes[0] != 0x7001 {
+		t.Errorf("unexpected attributes: %s", unknownErr.Attributes)
+	}
+	if err.Error() != "unknown attributes: 0x7001" {
+		t.Errorf("unexpected error text %q", err)
+	}
+	for _, m := range []*Message{
+		MustBuild(BindingSuccess),
+		MustBuild(BindingError),
+		MustBuild(BindingError, CodeBadRequest),
+	} {
+		if err = unknownAttributeError(m); err != nil {
+			t.Errorf("unexpected error %v for %s", err, m)
+		}
+	}
+	t.Run("BadSetter", func(t *testing.T) {
+		if _, err := NewUnknownAttributesResponse(req, nil, errorSetter{errors.New("failed")}); err == nil {
+			t.Error("should error")
+		}
+	})
+}
+
 func BenchmarkUnknownAttributes(b *testing.B) {
 	m := new(Message)
 	a := UnknownAttributes{